@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"gotrol/internal/bpjsmock"
+)
+
+func main() {
+	addr := flag.String("addr", ":8088", "listen address")
+	consID := flag.String("consid", "mock", "X-cons-id the client signs with")
+	secret := flag.String("secret", "mock", "secret key the client signs with")
+	strict := flag.Bool("strict", false, "reject kodebookings that were not registered via antrean/add")
+	latency := flag.Duration("latency", 0, "delay added to every answer")
+	errorRate := flag.Float64("error-rate", 0, "fraction of requests answered with -error-status")
+	errorStatus := flag.Int("error-status", http.StatusServiceUnavailable, "HTTP status for injected errors")
+	rulesPath := flag.String("rules", "", "YAML file with failure injection rules")
+	flag.Parse()
+
+	failures := bpjsmock.FailureConfig{
+		Latency:     *latency,
+		ErrorRate:   *errorRate,
+		ErrorStatus: *errorStatus,
+	}
+	if *rulesPath != "" {
+		data, err := os.ReadFile(*rulesPath)
+		if err != nil {
+			log.Fatalf(" Failed to read rules: %v", err)
+		}
+		var fileCfg bpjsmock.FailureConfig
+		if err := yaml.Unmarshal(data, &fileCfg); err != nil {
+			log.Fatalf(" Failed to parse rules: %v", err)
+		}
+		failures.Rules = fileCfg.Rules
+	}
+
+	server := bpjsmock.NewServer(bpjsmock.Options{
+		ConsID:       *consID,
+		SecretKey:    *secret,
+		AutoRegister: !*strict,
+		Failures:     failures,
+	})
+
+	fmt.Println()
+	fmt.Println("╔══════════════════════════════════════════════════════════════╗")
+	fmt.Println("║               GoTrol BPJS Antrean Mock Server                ║")
+	fmt.Println("╚══════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+	log.Printf(" Listening on %s", *addr)
+	log.Printf(" Set BpjsAntrianUrl to http://localhost%s/ and cons id/secret to %q/%q", *addr, *consID, *secret)
+	log.Printf(" Inspect state at http://localhost%s/_state", *addr)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Fatal(srv.ListenAndServe())
+}
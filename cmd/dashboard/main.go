@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"gotrol/internal/config"
@@ -32,6 +33,24 @@ func main() {
 	defer db.Close()
 	log.Println(" Connected to MySQL database")
 
+	if err := db.EnsureSchema(); err != nil {
+		log.Fatalf(" Failed to prepare gotrol tables: %v", err)
+	}
+
+	repo, err := database.NewRepository(db, cfg.Database.Schema, cfg.Tasks)
+	if err != nil {
+		log.Fatalf(" %v", err)
+	}
+
+	creds, err := repo.Credentials()
+	if err != nil {
+		log.Fatalf(" Failed to load settings: %v", err)
+	}
+	if err := db.LoadPayerCodes(cfg.BPJS.PayerCodes, creds.KdPjBPJS); err != nil {
+		log.Fatalf(" Failed to load payer codes: %v", err)
+	}
+	log.Printf(" JKN payer codes: %s", strings.Join(db.PayerCodes(), ", "))
+
 	store, err := report.NewStore(cfg.Report.DBPath)
 	if err != nil {
 		log.Fatalf(" Failed to initialize report store: %v", err)
@@ -43,7 +62,7 @@ func main() {
 		apiPort = 8899
 	}
 
-	apiServer := report.NewAPIServer(store, db, apiPort)
+	apiServer := report.NewAPIServer(store, db, repo, apiPort, cfg.API.Reviewers)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
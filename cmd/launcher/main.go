@@ -32,6 +32,8 @@ func main() {
 			runBatchWithDate("retrytask3", "Retry Task 3 yang Gagal")
 		case "6":
 			runDashboard()
+		case "7":
+			runReconcile()
 		case "0":
 			fmt.Println("\n👋 Sampai jumpa!")
 			os.Exit(0)
@@ -66,6 +68,7 @@ func showMainMenu() {
 	fmt.Println("  [4] ⚡ Batch All (Auto Order + Update Waktu)")
 	fmt.Println("  [5] 🔄 Retry Task 3 yang Gagal")
 	fmt.Println("  [6] 📊 Buka Dashboard")
+	fmt.Println("  [7] 🔍 Rekonsiliasi dengan BPJS")
 	fmt.Println()
 	fmt.Println("  [0] ❌ Keluar")
 	fmt.Println()
@@ -157,8 +160,13 @@ func runBatchWithDate(batchType, title string) {
 	fmt.Printf("📅 Tanggal: %s\n", date)
 	fmt.Println()
 
-	confirm := readInput("Lanjutkan? (y/n): ")
-	if strings.ToLower(confirm) != "y" {
+	args := []string{"batch", batchType, "--date", date}
+	confirm := strings.ToLower(readInput("Lanjutkan? (y/n, d = dry-run/pratinjau): "))
+	switch confirm {
+	case "y":
+	case "d":
+		args = append(args, "--dry-run")
+	default:
 		fmt.Println("\n❌ Dibatalkan.")
 		waitEnter()
 		return
@@ -168,7 +176,41 @@ func runBatchWithDate(batchType, title string) {
 	fmt.Println("⏳ Memproses...")
 	fmt.Println()
 
-	cmd := exec.Command("./GoTrol.exe", "batch", batchType, "--date", date)
+	cmd := exec.Command("./GoTrol.exe", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Run()
+
+	fmt.Println()
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Println("✅ Selesai! Tekan Enter untuk kembali ke menu...")
+	waitEnter()
+}
+
+func runReconcile() {
+	clearScreen()
+	printBanner()
+	fmt.Println("🔍 Rekonsiliasi dengan BPJS")
+	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+
+	date := showDateMenu()
+	if date == "" {
+		return
+	}
+
+	fmt.Println()
+	fix := readInput("Perbaiki status lokal yang sudah diterima BPJS? (y/n): ")
+
+	args := []string{"reconcile", "--date", date}
+	if strings.ToLower(fix) == "y" {
+		args = append(args, "--fix")
+	}
+
+	fmt.Println()
+	fmt.Println("⏳ Memproses...")
+	fmt.Println()
+
+	cmd := exec.Command("./GoTrol.exe", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Run()
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/database"
+	"gotrol/internal/wsrs"
+)
+
+func main() {
+	fmt.Println()
+	fmt.Println("╔══════════════════════════════════════════════════════════════╗")
+	fmt.Println("║          GoTrol WS RS - Web Service Mobile JKN               ║")
+	fmt.Println("║                       Version 1.0.0                          ║")
+	fmt.Println("╚══════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	cfg, err := config.Load("config.yaml")
+	if err != nil {
+		log.Fatalf(" Failed to load config: %v", err)
+	}
+	if cfg.WSRS.Username == "" || cfg.WSRS.Password == "" {
+		log.Fatalf(" wsrs.username and wsrs.password must be set in config.yaml")
+	}
+
+	db, err := database.NewMySQL(cfg.Database)
+	if err != nil {
+		log.Fatalf(" Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+	log.Println(" Connected to MySQL database")
+
+	if err := db.EnsureSchema(); err != nil {
+		log.Fatalf(" Failed to prepare gotrol tables: %v", err)
+	}
+
+	repo, err := database.NewRepository(db, cfg.Database.Schema, cfg.Tasks)
+	if err != nil {
+		log.Fatalf(" %v", err)
+	}
+
+	creds, err := repo.Credentials()
+	if err != nil {
+		log.Fatalf(" Failed to load settings: %v", err)
+	}
+	if err := db.LoadPayerCodes(cfg.BPJS.PayerCodes, creds.KdPjBPJS); err != nil {
+		log.Fatalf(" Failed to load payer codes: %v", err)
+	}
+	log.Printf(" JKN payer codes: %s", strings.Join(db.PayerCodes(), ", "))
+
+	port := cfg.WSRS.Port
+	if port == 0 {
+		port = 8898
+	}
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           wsrs.NewServer(db, repo, cfg.WSRS, db.PayerCodes()[0]),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf(" WS RS error: %v", err)
+		}
+	}()
+
+	log.Printf(" WS RS running at http://localhost:%d", port)
+	log.Println("Press Ctrl+C to stop...")
+
+	<-sigChan
+	log.Println("\n Shutting down WS RS...")
+	srv.Close()
+}
@@ -3,6 +3,7 @@ module gotrol
 go 1.25.5
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/go-sql-driver/mysql v1.9.3
 	gopkg.in/yaml.v3 v3.0.1
 )
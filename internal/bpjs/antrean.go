@@ -0,0 +1,201 @@
+package bpjs
+
+import (
+	"context"
+	"fmt"
+)
+
+func (c *Client) UpdateWaktu(kodeBooking string, taskID int, waktuMs int64) (*BPJSResponse, error) {
+	return c.UpdateWaktuContext(context.Background(), kodeBooking, taskID, waktuMs)
+}
+
+func (c *Client) UpdateWaktuContext(ctx context.Context, kodeBooking string, taskID int, waktuMs int64) (*BPJSResponse, error) {
+	return c.post(ctx, "antrean/updatewaktu", UpdateWaktuRequest{
+		KodeBooking: kodeBooking,
+		TaskID:      taskID,
+		Waktu:       waktuMs,
+	})
+}
+
+func (c *Client) TambahAntrean(req AddAntreanRequest) (*BPJSResponse, error) {
+	return c.TambahAntreanContext(context.Background(), req)
+}
+
+func (c *Client) TambahAntreanContext(ctx context.Context, req AddAntreanRequest) (*BPJSResponse, error) {
+	return c.post(ctx, "antrean/add", req)
+}
+
+func (c *Client) TambahAntreanFarmasi(req AddAntreanFarmasiRequest) (*BPJSResponse, error) {
+	return c.TambahAntreanFarmasiContext(context.Background(), req)
+}
+
+func (c *Client) TambahAntreanFarmasiContext(ctx context.Context, req AddAntreanFarmasiRequest) (*BPJSResponse, error) {
+	return c.post(ctx, "antrean/farmasi/add", req)
+}
+
+func (c *Client) BatalAntrean(kodeBooking, keterangan string) (*BPJSResponse, error) {
+	return c.BatalAntreanContext(context.Background(), kodeBooking, keterangan)
+}
+
+func (c *Client) BatalAntreanContext(ctx context.Context, kodeBooking, keterangan string) (*BPJSResponse, error) {
+	return c.post(ctx, "antrean/batal", BatalAntreanRequest{
+		KodeBooking: kodeBooking,
+		Keterangan:  keterangan,
+	})
+}
+
+func (c *Client) GetListTask(kodeBooking string) ([]ListTask, *BPJSResponse, error) {
+	return c.GetListTaskContext(context.Background(), kodeBooking)
+}
+
+func (c *Client) GetListTaskContext(ctx context.Context, kodeBooking string) ([]ListTask, *BPJSResponse, error) {
+	resp, err := c.post(ctx, "antrean/getlisttask", GetListTaskRequest{KodeBooking: kodeBooking})
+	if err != nil {
+		return nil, resp, err
+	}
+	var tasks []ListTask
+	if resp.IsSuccess() {
+		if err := resp.Decode(&tasks); err != nil {
+			return nil, resp, err
+		}
+	}
+	return tasks, resp, nil
+}
+
+func (c *Client) AntreanPerTanggal(tanggal string) ([]Antrean, *BPJSResponse, error) {
+	return c.AntreanPerTanggalContext(context.Background(), tanggal)
+}
+
+func (c *Client) AntreanPerTanggalContext(ctx context.Context, tanggal string) ([]Antrean, *BPJSResponse, error) {
+	return c.getAntrean(ctx, "antrean/pendaftaran/tanggal/"+tanggal)
+}
+
+func (c *Client) AntreanPerKodeBooking(kodeBooking string) ([]Antrean, *BPJSResponse, error) {
+	return c.AntreanPerKodeBookingContext(context.Background(), kodeBooking)
+}
+
+func (c *Client) AntreanPerKodeBookingContext(ctx context.Context, kodeBooking string) ([]Antrean, *BPJSResponse, error) {
+	return c.getAntrean(ctx, "antrean/pendaftaran/kodebooking/"+kodeBooking)
+}
+
+func (c *Client) getAntrean(ctx context.Context, path string) ([]Antrean, *BPJSResponse, error) {
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return nil, resp, err
+	}
+	var list []Antrean
+	if resp.IsSuccess() {
+		if err := resp.Decode(&list); err != nil {
+			return nil, resp, err
+		}
+	}
+	return list, resp, nil
+}
+
+func (c *Client) RefPoli() ([]Poli, *BPJSResponse, error) {
+	return c.RefPoliContext(context.Background())
+}
+
+func (c *Client) RefPoliContext(ctx context.Context) ([]Poli, *BPJSResponse, error) {
+	return c.getPoli(ctx, "ref/poli")
+}
+
+func (c *Client) RefPoliFP() ([]Poli, *BPJSResponse, error) {
+	return c.RefPoliFPContext(context.Background())
+}
+
+func (c *Client) RefPoliFPContext(ctx context.Context) ([]Poli, *BPJSResponse, error) {
+	return c.getPoli(ctx, "ref/poli/fp")
+}
+
+func (c *Client) getPoli(ctx context.Context, path string) ([]Poli, *BPJSResponse, error) {
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return nil, resp, err
+	}
+	var list []Poli
+	if resp.IsSuccess() {
+		if err := resp.Decode(&list); err != nil {
+			return nil, resp, err
+		}
+	}
+	return list, resp, nil
+}
+
+func (c *Client) RefDokter() ([]Dokter, *BPJSResponse, error) {
+	return c.RefDokterContext(context.Background())
+}
+
+func (c *Client) RefDokterContext(ctx context.Context) ([]Dokter, *BPJSResponse, error) {
+	resp, err := c.get(ctx, "ref/dokter")
+	if err != nil {
+		return nil, resp, err
+	}
+	var list []Dokter
+	if resp.IsSuccess() {
+		if err := resp.Decode(&list); err != nil {
+			return nil, resp, err
+		}
+	}
+	return list, resp, nil
+}
+
+func (c *Client) JadwalDokter(kodePoli, tanggal string) ([]JadwalDokter, *BPJSResponse, error) {
+	return c.JadwalDokterContext(context.Background(), kodePoli, tanggal)
+}
+
+func (c *Client) JadwalDokterContext(ctx context.Context, kodePoli, tanggal string) ([]JadwalDokter, *BPJSResponse, error) {
+	resp, err := c.get(ctx, fmt.Sprintf("jadwaldokter/kodepoli/%s/tanggal/%s", kodePoli, tanggal))
+	if err != nil {
+		return nil, resp, err
+	}
+	var list []JadwalDokter
+	if resp.IsSuccess() {
+		if err := resp.Decode(&list); err != nil {
+			return nil, resp, err
+		}
+	}
+	return list, resp, nil
+}
+
+func (c *Client) UpdateJadwalDokter(req UpdateJadwalDokterRequest) (*BPJSResponse, error) {
+	return c.UpdateJadwalDokterContext(context.Background(), req)
+}
+
+func (c *Client) UpdateJadwalDokterContext(ctx context.Context, req UpdateJadwalDokterRequest) (*BPJSResponse, error) {
+	return c.post(ctx, "jadwaldokter/updatejadwaldokter", req)
+}
+
+// DashboardPerTanggal returns the waiting time dashboard for one day. waktu
+// is either "rs" or "server", selecting which clock BPJS aggregates on.
+func (c *Client) DashboardPerTanggal(tanggal, waktu string) ([]DashboardWaktuTunggu, *BPJSResponse, error) {
+	return c.DashboardPerTanggalContext(context.Background(), tanggal, waktu)
+}
+
+func (c *Client) DashboardPerTanggalContext(ctx context.Context, tanggal, waktu string) ([]DashboardWaktuTunggu, *BPJSResponse, error) {
+	return c.getDashboard(ctx, fmt.Sprintf("dashboard/waktutunggu/tanggal/%s/waktu/%s", tanggal, waktu))
+}
+
+func (c *Client) DashboardPerBulan(bulan, tahun int, waktu string) ([]DashboardWaktuTunggu, *BPJSResponse, error) {
+	return c.DashboardPerBulanContext(context.Background(), bulan, tahun, waktu)
+}
+
+func (c *Client) DashboardPerBulanContext(ctx context.Context, bulan, tahun int, waktu string) ([]DashboardWaktuTunggu, *BPJSResponse, error) {
+	return c.getDashboard(ctx, fmt.Sprintf("dashboard/waktutunggu/bulan/%02d/tahun/%d/waktu/%s", bulan, tahun, waktu))
+}
+
+func (c *Client) getDashboard(ctx context.Context, path string) ([]DashboardWaktuTunggu, *BPJSResponse, error) {
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return nil, resp, err
+	}
+	var wrapper struct {
+		List []DashboardWaktuTunggu `json:"list"`
+	}
+	if resp.IsSuccess() {
+		if err := resp.Decode(&wrapper); err != nil {
+			return nil, resp, err
+		}
+	}
+	return wrapper.List, resp, nil
+}
@@ -2,28 +2,29 @@ package bpjs
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"math/rand"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
 	"time"
 
 	"gotrol/internal/config"
+	"gotrol/internal/models"
 )
 
 type Client struct {
-	creds      *config.BPJSCredentials
-	httpClient *http.Client
-}
-
-type UpdateWaktuRequest struct {
-	KodeBooking string `json:"kodebooking"`
-	TaskID      int    `json:"taskid"`
-	Waktu       int64  `json:"waktu"`
+	creds          *config.BPJSCredentials
+	httpClient     *http.Client
+	limiter        *RateLimiter
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	recorder       Recorder
 }
 
 type BPJSResponse struct {
@@ -31,78 +32,239 @@ type BPJSResponse struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 	} `json:"metadata"`
-	Response interface{} `json:"response,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
 }
 
-func NewClient(creds *config.BPJSCredentials) *Client {
+const redacted = "[redacted]"
+
+// NewClient builds a client from the bpjs section of config.yaml. Pass the
+// same limiter to every client in the process; nil disables rate limiting.
+func NewClient(creds *config.BPJSCredentials, cfg config.BPJSConfig, limiter *RateLimiter) *Client {
+	maxRetries := cfg.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
 	return &Client{
 		creds: creds,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout: cfg.GetTimeout(),
 		},
+		limiter:        limiter,
+		maxRetries:     maxRetries,
+		retryBaseDelay: cfg.GetRetryBaseDelay(),
+		retryMaxDelay:  cfg.GetRetryMaxDelay(),
 	}
 }
 
 func (c *Client) generateSignature(timestamp string) string {
-	message := c.creds.ConsID + "&" + timestamp
-	h := hmac.New(sha256.New, []byte(c.creds.SecretKey))
-	h.Write([]byte(message))
-	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return Signature(c.creds.ConsID, c.creds.SecretKey, timestamp)
 }
 
 func (c *Client) getTimestamp() string {
 	return strconv.FormatInt(time.Now().UTC().Unix(), 10)
 }
 
-func (c *Client) UpdateWaktu(kodeBooking string, taskID int, waktuMs int64) (*BPJSResponse, error) {
+// do sends the request, retrying transport errors, HTTP 5xx/429 and BPJS
+// answers classified as rate limited or server errors. A POST such as
+// antrean/add or antrean/batal may already have been applied when it fails
+// that way, so it is only retried when BPJS refused it as rate limited or
+// the connection failed before the request was written.
+func (c *Client) do(ctx context.Context, method, path string, payload interface{}) (*BPJSResponse, error) {
 	if c.creds.AntrianURL == "" {
 		return nil, fmt.Errorf("BPJS Antrian URL not configured")
 	}
 
-	url := c.creds.AntrianURL + "antrean/updatewaktu"
+	var jsonBody []byte
+	if payload != nil {
+		var err error
+		jsonBody, err = json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	var (
+		resp *BPJSResponse
+		err  error
+	)
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		var retry bool
+		resp, retry, err = c.send(ctx, method, path, jsonBody, attempt+1, method == http.MethodGet)
+		if !retry || attempt >= c.maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
 
-	reqBody := UpdateWaktuRequest{
-		KodeBooking: kodeBooking,
-		TaskID:      taskID,
-		Waktu:       waktuMs,
+		delay := c.backoff(attempt)
+		log.Printf("   │   BPJS %s attempt %d failed, retrying in %s", path, attempt+1, delay.Round(time.Millisecond))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
 	}
+}
 
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+func (c *Client) send(ctx context.Context, method, path string, jsonBody []byte, attempt int, idempotent bool) (*BPJSResponse, bool, error) {
+	url := c.creds.AntrianURL + path
+
+	var body io.Reader
+	if jsonBody != nil {
+		body = bytes.NewReader(jsonBody)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	timestamp := c.getTimestamp()
 	signature := c.generateSignature(timestamp)
 
-	req.Header.Set("Content-Type", "Application/x-www-form-urlencoded")
+	if method == http.MethodGet {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		req.Header.Set("Content-Type", "Application/x-www-form-urlencoded")
+	}
 	req.Header.Set("X-cons-id", c.creds.ConsID)
 	req.Header.Set("X-timestamp", timestamp)
 	req.Header.Set("X-signature", signature)
 	req.Header.Set("user_key", c.creds.UserKey)
 
+	record := models.BPJSAttempt{
+		Time:     time.Now(),
+		Method:   method,
+		Endpoint: path,
+		Attempt:  attempt,
+		RequestHeaders: map[string]string{
+			"Content-Type": req.Header.Get("Content-Type"),
+			"X-cons-id":    c.creds.ConsID,
+			"X-timestamp":  timestamp,
+			"X-signature":  redacted,
+			"user_key":     redacted,
+		},
+		RequestBody: string(jsonBody),
+	}
+	corr := correlationFrom(ctx)
+	record.NomorReferensi = corr.nomorReferensi
+	record.TaskID = corr.taskID
+	defer func() {
+		if c.recorder != nil {
+			record.LatencyMs = time.Since(record.Time).Milliseconds()
+			if err := c.recorder.RecordAttempt(record); err != nil {
+				log.Printf("   │   Failed to write BPJS journal: %v", err)
+			}
+		}
+	}()
+
+	var written bool
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) { written = true },
+	}))
+
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		record.Error = err.Error()
+		record.Category = string(CategoryNetworkError)
+		return nil, idempotent || !written, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	record.HTTPStatus = resp.StatusCode
 
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		record.Error = err.Error()
+		record.Category = string(CategoryNetworkError)
+		return nil, idempotent, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	transient := resp.StatusCode == http.StatusTooManyRequests || (idempotent && resp.StatusCode >= 500)
+
 	var bpjsResp BPJSResponse
-	if err := json.Unmarshal(body, &bpjsResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w, body: %s", err, string(body))
+	if err := json.Unmarshal(respBody, &bpjsResp); err != nil {
+		record.Error = fmt.Sprintf("failed to parse response: %v", err)
+		if transient {
+			record.Category = string(CategoryServerError)
+		}
+		return nil, transient, fmt.Errorf("failed to parse response: %w, body: %s", err, string(respBody))
 	}
 
-	return &bpjsResp, nil
+	category := bpjsResp.Category()
+	record.Code = bpjsResp.Metadata.Code
+	record.Message = bpjsResp.Metadata.Message
+	record.Category = string(category)
+
+	switch category {
+	case CategoryRateLimited:
+		transient = true
+	case CategoryServerError:
+		transient = idempotent
+	}
+
+	if err := c.decryptPayload(&bpjsResp, timestamp); err != nil {
+		record.Error = err.Error()
+		return &bpjsResp, false, err
+	}
+
+	return &bpjsResp, transient, nil
+}
+
+// backoff returns an exponential delay for the given attempt with jitter in
+// the upper half, so concurrent callers do not retry in lockstep.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.retryBaseDelay << uint(attempt)
+	if d <= 0 || d > c.retryMaxDelay {
+		d = c.retryMaxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// decryptPayload replaces an encrypted string payload with the JSON it
+// decodes to, so Decode can unmarshal it straight into the typed structs.
+func (c *Client) decryptPayload(r *BPJSResponse, timestamp string) error {
+	if len(r.Response) == 0 || r.Response[0] != '"' {
+		return nil
+	}
+	var encrypted string
+	if err := json.Unmarshal(r.Response, &encrypted); err != nil {
+		return fmt.Errorf("failed to read encrypted response: %w", err)
+	}
+	if encrypted == "" {
+		r.Response = nil
+		return nil
+	}
+	plain, err := decryptResponse(c.creds.ConsID, c.creds.SecretKey, timestamp, encrypted)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt response: %w", err)
+	}
+	r.Response = json.RawMessage(plain)
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string) (*BPJSResponse, error) {
+	return c.do(ctx, http.MethodGet, path, nil)
+}
+
+func (c *Client) post(ctx context.Context, path string, payload interface{}) (*BPJSResponse, error) {
+	return c.do(ctx, http.MethodPost, path, payload)
+}
+
+// Decode unmarshals the response payload into out. It is a no-op when BPJS
+// returned no payload, which is normal for non-200 metadata codes.
+func (r *BPJSResponse) Decode(out interface{}) error {
+	if len(r.Response) == 0 || string(r.Response) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(r.Response, out); err != nil {
+		return fmt.Errorf("failed to decode response payload: %w", err)
+	}
+	return nil
 }
 
 func (r *BPJSResponse) IsSuccess() bool {
@@ -0,0 +1,74 @@
+package bpjs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"gotrol/internal/config"
+	"gotrol/internal/models"
+)
+
+type countingRecorder struct{ attempts int }
+
+func (r *countingRecorder) RecordAttempt(models.BPJSAttempt) error {
+	r.attempts++
+	return nil
+}
+
+func testClient(url string) *Client {
+	creds := &config.BPJSCredentials{ConsID: testConsID, SecretKey: testSecretKey, AntrianURL: url + "/"}
+	return NewClient(creds, config.BPJSConfig{MaxRetries: 2, RetryBaseDelay: "1ms", RetryMaxDelay: "2ms"}, nil)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+		body   string
+		want   int32
+	}{
+		{"GET retried on 5xx", http.MethodGet, 503, `{"metadata":{"code":503,"message":"Service Unavailable"}}`, 3},
+		{"POST not retried on 5xx", http.MethodPost, 500, `{"metadata":{"code":500,"message":"Internal Server Error"}}`, 1},
+		{"POST not retried on a server error answer", http.MethodPost, 200, `{"metadata":{"code":500,"message":"Internal Server Error"}}`, 1},
+		{"POST retried when rate limited", http.MethodPost, 429, `{"metadata":{"code":429,"message":"Too Many Requests"}}`, 3},
+		{"POST not retried when rejected", http.MethodPost, 200, `{"metadata":{"code":201,"message":"Nomor kartu tidak valid"}}`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := testClient(srv.URL)
+			c.do(context.Background(), tt.method, "antrean/add", map[string]string{"kodebooking": "X"})
+			if got := atomic.LoadInt32(&calls); got != tt.want {
+				t.Errorf("%d requests, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPostBeforeWrite(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	rec := &countingRecorder{}
+	c := testClient(url)
+	c.SetRecorder(rec)
+	if _, err := c.post(context.Background(), "antrean/batal", BatalAntreanRequest{KodeBooking: "X"}); err == nil {
+		t.Fatal("post to a closed server succeeded")
+	}
+	if rec.attempts != 3 {
+		t.Errorf("%d attempts, want 3", rec.attempts)
+	}
+}
@@ -0,0 +1,88 @@
+package bpjs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// decryptResponse reverses the encoding BPJS applies to the "response"
+// field: AES-256-CBC keyed with sha256(consid + secretkey + timestamp),
+// using the first 16 bytes of that key as IV, over an lz-string
+// compressToEncodedURIComponent payload.
+func decryptResponse(consID, secretKey, timestamp, encrypted string) (string, error) {
+	key := sha256.Sum256([]byte(consID + secretKey + timestamp))
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted response: %w", err)
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return "", errors.New("encrypted response is not a multiple of the block size")
+	}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return "", err
+	}
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, key[:aes.BlockSize]).CryptBlocks(plain, ciphertext)
+
+	plain, err = pkcs7Unpad(plain)
+	if err != nil {
+		return "", err
+	}
+
+	decompressed, err := decompressFromEncodedURIComponent(string(plain))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress response: %w", err)
+	}
+	return decompressed, nil
+}
+
+func pkcs7Unpad(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty plaintext")
+	}
+	n := int(data[len(data)-1])
+	if n == 0 || n > aes.BlockSize || n > len(data) {
+		return nil, errors.New("invalid padding, wrong key or timestamp")
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, errors.New("invalid padding, wrong key or timestamp")
+		}
+	}
+	return data[:len(data)-n], nil
+}
+
+// EncryptResponse produces a "response" value the way BPJS does. It exists
+// for the mock server; production code only ever decrypts.
+func EncryptResponse(consID, secretKey, timestamp, plain string) (string, error) {
+	key := sha256.Sum256([]byte(consID + secretKey + timestamp))
+
+	data := []byte(compressToEncodedURIComponent(plain))
+	n := aes.BlockSize - len(data)%aes.BlockSize
+	for i := 0; i < n; i++ {
+		data = append(data, byte(n))
+	}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(ciphertext, data)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Signature computes X-signature: base64(HMAC-SHA256(secretKey, consID&timestamp)).
+func Signature(consID, secretKey, timestamp string) string {
+	h := hmac.New(sha256.New, []byte(secretKey))
+	h.Write([]byte(consID + "&" + timestamp))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
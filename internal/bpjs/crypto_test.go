@@ -0,0 +1,70 @@
+package bpjs
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+const (
+	testConsID    = "12345"
+	testSecretKey = "s3cr3t"
+	testTimestamp = "1766885400"
+	testPlain     = `{"list":[{"taskid":3,"taskname":"Akhir waktu layan admisi","wakturs":"28-12-2025 08:30:00 WIB","waktu":"28-12-2025 08:30:00 WIB","kodebooking":"20251228000001"}]}`
+
+	// testCiphertext is testPlain as BPJS would send it for the
+	// credentials and timestamp above.
+	testSignature  = "t0VtoHaUz18K9ip08SiFIH8A4AiTWkx3glDqUBiJ9m8="
+	testCiphertext = "rks76QjHQo8K9WfqD8aJCie02L2Jfl1u8ZeNZSJyf7Tg6boTapLBpldRYZ8ZywdbT78PjsK7RgpJhmpoL4rrylDTRfgfwxuvxLoMHJzUWnLHRhV2NCM2DQxP51kArq8vZzOw9Q9EOhd6MtlKBdDaeFBmyShO6GUBHTCsybNPbTx+fC/9+xepcfMbGBC8XPqqwbzDJrDwM1j9n4phHTI9smtFHgSOHi54n4ivTl0d+ht2wYLlrC3WdIFSUIiFxlTo"
+)
+
+func TestDecryptResponse(t *testing.T) {
+	got, err := decryptResponse(testConsID, testSecretKey, testTimestamp, testCiphertext)
+	if err != nil {
+		t.Fatalf("decryptResponse: %v", err)
+	}
+	if got != testPlain {
+		t.Errorf("decryptResponse = %s\nwant %s", got, testPlain)
+	}
+}
+
+func TestEncryptResponse(t *testing.T) {
+	got, err := EncryptResponse(testConsID, testSecretKey, testTimestamp, testPlain)
+	if err != nil {
+		t.Fatalf("EncryptResponse: %v", err)
+	}
+	if got != testCiphertext {
+		t.Errorf("EncryptResponse = %s\nwant %s", got, testCiphertext)
+	}
+}
+
+func TestDecryptResponseErrors(t *testing.T) {
+	raw, _ := base64.StdEncoding.DecodeString(testCiphertext)
+	truncated := base64.StdEncoding.EncodeToString(raw[:len(raw)-16])
+
+	tests := []struct {
+		name      string
+		timestamp string
+		encrypted string
+	}{
+		{"wrong timestamp", "1766885401", testCiphertext},
+		{"empty", testTimestamp, ""},
+		{"not base64", testTimestamp, "not base64!"},
+		{"not a block multiple", testTimestamp, testCiphertext[:20]},
+		{"last block missing", testTimestamp, truncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptResponse(testConsID, testSecretKey, tt.timestamp, tt.encrypted)
+			if err == nil {
+				t.Errorf("decryptResponse = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestSignature(t *testing.T) {
+	got := Signature(testConsID, testSecretKey, testTimestamp)
+	if got != testSignature {
+		t.Errorf("Signature = %s, want %s", got, testSignature)
+	}
+}
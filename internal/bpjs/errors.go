@@ -0,0 +1,90 @@
+package bpjs
+
+import "strings"
+
+// Category is a stable classification of a BPJS answer. BPJS reports most
+// failures as metadata code 201 with a free-text Indonesian message that is
+// reworded from time to time, so callers should switch on Category instead
+// of matching the message themselves.
+type Category string
+
+const (
+	CategorySuccess             Category = "success"
+	CategoryAlreadyExists       Category = "already_exists"
+	CategoryOrderingViolation   Category = "ordering_violation"
+	CategoryKodeBookingNotFound Category = "kodebooking_not_found"
+	CategoryAlreadyCancelled    Category = "already_cancelled"
+	CategoryAuthFailed          Category = "auth_failed"
+	CategoryRateLimited         Category = "rate_limited"
+	CategoryServerError         Category = "server_error"
+	CategoryNetworkError        Category = "network_error"
+	CategoryRejected            Category = "rejected"
+)
+
+// Classify maps a metadata code and message to a Category. Message checks
+// come first because BPJS returns code 201 for almost every rejection.
+func Classify(code int, message string) Category {
+	msg := strings.ToLower(message)
+
+	switch {
+	case code == 200:
+		return CategorySuccess
+	case code == 208 || strings.Contains(msg, "sudah ada"):
+		return CategoryAlreadyExists
+	case strings.Contains(msg, "tidak boleh kurang"),
+		strings.Contains(msg, "tidak boleh lebih kecil"),
+		strings.Contains(msg, "tidak sesuai urutan"):
+		return CategoryOrderingViolation
+	case strings.Contains(msg, "sudah dibatalkan"),
+		strings.Contains(msg, "telah dibatalkan"):
+		return CategoryAlreadyCancelled
+	case strings.Contains(msg, "kodebooking tidak ditemukan"),
+		strings.Contains(msg, "kode booking tidak ditemukan"),
+		strings.Contains(msg, "antrean tidak ditemukan"),
+		strings.Contains(msg, "data tidak ditemukan"):
+		return CategoryKodeBookingNotFound
+	case code == 401 || code == 403,
+		strings.Contains(msg, "signature"),
+		strings.Contains(msg, "unauthorized"),
+		strings.Contains(msg, "authentication failed"),
+		strings.Contains(msg, "cons id"),
+		strings.Contains(msg, "user key"):
+		return CategoryAuthFailed
+	case code == 429,
+		strings.Contains(msg, "too many request"),
+		strings.Contains(msg, "rate limit"):
+		return CategoryRateLimited
+	case code >= 500:
+		return CategoryServerError
+	default:
+		return CategoryRejected
+	}
+}
+
+// ClassifyError categorizes a transport error returned by the client, where
+// no metadata was received at all.
+func ClassifyError(err error) Category {
+	if err == nil {
+		return CategorySuccess
+	}
+	return CategoryNetworkError
+}
+
+func (r *BPJSResponse) Category() Category {
+	return Classify(r.Metadata.Code, r.Metadata.Message)
+}
+
+// IsAccepted reports whether BPJS holds the submitted data after the call,
+// either because it was stored now or because it already was.
+func (c Category) IsAccepted() bool {
+	return c == CategorySuccess || c == CategoryAlreadyExists
+}
+
+// Retryable reports whether sending the same task again can succeed.
+func (c Category) Retryable() bool {
+	switch c {
+	case CategorySuccess, CategoryAlreadyExists, CategoryKodeBookingNotFound, CategoryAlreadyCancelled:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package bpjs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		code    int
+		message string
+		want    Category
+	}{
+		{200, "Ok.", CategorySuccess},
+		{208, "TaskId=3 sudah ada", CategoryAlreadyExists},
+		{201, "TaskId=3 Sudah Ada", CategoryAlreadyExists},
+		{201, "waktu TaskId=4 tidak boleh kurang atau sama dengan waktu TaskId=3", CategoryOrderingViolation},
+		{201, "Waktu tidak boleh lebih kecil dari TaskId sebelumnya", CategoryOrderingViolation},
+		{201, "TaskId tidak sesuai urutan", CategoryOrderingViolation},
+		{201, "Antrean sudah dibatalkan", CategoryAlreadyCancelled},
+		{201, "Antrean Telah Dibatalkan sebelumnya", CategoryAlreadyCancelled},
+		{201, "Antrean Tidak Ditemukan.", CategoryKodeBookingNotFound},
+		{201, "Kodebooking tidak ditemukan", CategoryKodeBookingNotFound},
+		{201, "Kode Booking tidak ditemukan", CategoryKodeBookingNotFound},
+		{201, "Data tidak ditemukan", CategoryKodeBookingNotFound},
+		{401, "", CategoryAuthFailed},
+		{403, "Forbidden", CategoryAuthFailed},
+		{201, "Invalid signature", CategoryAuthFailed},
+		{201, "Cons ID tidak terdaftar", CategoryAuthFailed},
+		{201, "User Key tidak valid", CategoryAuthFailed},
+		{201, "Authentication failed", CategoryAuthFailed},
+		{429, "", CategoryRateLimited},
+		{201, "Too Many Requests", CategoryRateLimited},
+		{500, "Internal Server Error", CategoryServerError},
+		{503, "", CategoryServerError},
+		{201, "Nomor kartu tidak valid", CategoryRejected},
+		{400, "Bad Request", CategoryRejected},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.code, tt.message); got != tt.want {
+			t.Errorf("Classify(%d, %q) = %s, want %s", tt.code, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	if got := ClassifyError(nil); got != CategorySuccess {
+		t.Errorf("ClassifyError(nil) = %s, want %s", got, CategorySuccess)
+	}
+	if got := ClassifyError(errors.New("connection refused")); got != CategoryNetworkError {
+		t.Errorf("ClassifyError(err) = %s, want %s", got, CategoryNetworkError)
+	}
+}
+
+func TestCategoryPredicates(t *testing.T) {
+	tests := []struct {
+		category  Category
+		accepted  bool
+		retryable bool
+	}{
+		{CategorySuccess, true, false},
+		{CategoryAlreadyExists, true, false},
+		{CategoryKodeBookingNotFound, false, false},
+		{CategoryAlreadyCancelled, false, false},
+		{CategoryOrderingViolation, false, true},
+		{CategoryServerError, false, true},
+		{CategoryNetworkError, false, true},
+		{CategoryRateLimited, false, true},
+	}
+	for _, tt := range tests {
+		if got := tt.category.IsAccepted(); got != tt.accepted {
+			t.Errorf("%s.IsAccepted() = %v, want %v", tt.category, got, tt.accepted)
+		}
+		if got := tt.category.Retryable(); got != tt.retryable {
+			t.Errorf("%s.Retryable() = %v, want %v", tt.category, got, tt.retryable)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package bpjs
+
+import (
+	"context"
+
+	"gotrol/internal/models"
+)
+
+// Recorder receives every outbound attempt the client makes.
+type Recorder interface {
+	RecordAttempt(models.BPJSAttempt) error
+}
+
+type correlationKey struct{}
+
+type correlation struct {
+	nomorReferensi string
+	taskID         int
+}
+
+// WithCorrelation tags calls made with ctx so their journal entries can be
+// found by nomor_referensi and task.
+func WithCorrelation(ctx context.Context, nomorReferensi string, taskID int) context.Context {
+	return context.WithValue(ctx, correlationKey{}, correlation{nomorReferensi: nomorReferensi, taskID: taskID})
+}
+
+func correlationFrom(ctx context.Context) correlation {
+	c, _ := ctx.Value(correlationKey{}).(correlation)
+	return c
+}
+
+// SetRecorder enables the request journal. It must be called before the
+// client is shared between goroutines.
+func (c *Client) SetRecorder(r Recorder) {
+	c.recorder = r
+}
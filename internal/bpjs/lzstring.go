@@ -0,0 +1,248 @@
+package bpjs
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+const keyStrURISafe = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+-$"
+
+var errInvalidLZString = errors.New("invalid lz-string input")
+
+// decompressFromEncodedURIComponent is a port of the function of the same
+// name in the lz-string JavaScript library, which BPJS uses to compress the
+// response payload before encrypting it.
+func decompressFromEncodedURIComponent(input string) (string, error) {
+	if input == "" {
+		return "", nil
+	}
+	input = strings.ReplaceAll(input, " ", "+")
+
+	var baseReverse [128]int
+	for i := range baseReverse {
+		baseReverse[i] = -1
+	}
+	for i := 0; i < len(keyStrURISafe); i++ {
+		baseReverse[keyStrURISafe[i]] = i
+	}
+
+	for i := 0; i < len(input); i++ {
+		if input[i] >= 128 || baseReverse[input[i]] < 0 {
+			return "", errInvalidLZString
+		}
+	}
+
+	getNextValue := func(index int) int {
+		if index >= len(input) {
+			return 0
+		}
+		return baseReverse[input[index]]
+	}
+
+	return lzDecompress(len(input), 32, getNextValue)
+}
+
+func lzDecompress(length int, resetValue int, getNextValue func(int) int) (string, error) {
+	dictionary := make([][]uint16, 0, 256)
+	enlargeIn := 4
+	dictSize := 4
+	numBits := 3
+	var result []uint16
+
+	dataVal := getNextValue(0)
+	dataPosition := resetValue
+	dataIndex := 1
+
+	readBits := func(n int) int {
+		bits := 0
+		maxpower := 1 << n
+		power := 1
+		for power != maxpower {
+			resb := dataVal & dataPosition
+			dataPosition >>= 1
+			if dataPosition == 0 {
+				dataPosition = resetValue
+				dataVal = getNextValue(dataIndex)
+				dataIndex++
+			}
+			if resb > 0 {
+				bits |= power
+			}
+			power <<= 1
+		}
+		return bits
+	}
+
+	for i := 0; i < 3; i++ {
+		dictionary = append(dictionary, []uint16{uint16(i)})
+	}
+
+	var c []uint16
+	switch readBits(2) {
+	case 0:
+		c = []uint16{uint16(readBits(8))}
+	case 1:
+		c = []uint16{uint16(readBits(16))}
+	case 2:
+		return "", nil
+	default:
+		return "", errInvalidLZString
+	}
+	dictionary = append(dictionary, c)
+	w := c
+	result = append(result, c...)
+
+	for {
+		if dataIndex > length {
+			return "", errInvalidLZString
+		}
+
+		code := readBits(numBits)
+		switch code {
+		case 0:
+			dictionary = append(dictionary, []uint16{uint16(readBits(8))})
+			dictSize++
+			code = dictSize - 1
+			enlargeIn--
+		case 1:
+			dictionary = append(dictionary, []uint16{uint16(readBits(16))})
+			dictSize++
+			code = dictSize - 1
+			enlargeIn--
+		case 2:
+			return string(utf16.Decode(result)), nil
+		}
+
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+
+		var entry []uint16
+		if code < len(dictionary) {
+			entry = dictionary[code]
+		} else if code == dictSize {
+			entry = append(append([]uint16{}, w...), w[0])
+		} else {
+			return "", errInvalidLZString
+		}
+		result = append(result, entry...)
+
+		dictionary = append(dictionary, append(append([]uint16{}, w...), entry[0]))
+		dictSize++
+		enlargeIn--
+		w = entry
+
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+	}
+}
+
+// compressToEncodedURIComponent is the inverse of
+// decompressFromEncodedURIComponent.
+func compressToEncodedURIComponent(input string) string {
+	if input == "" {
+		return ""
+	}
+	units := utf16.Encode([]rune(input))
+
+	key := func(s []uint16) string {
+		b := make([]byte, 0, len(s)*2)
+		for _, u := range s {
+			b = append(b, byte(u>>8), byte(u))
+		}
+		return string(b)
+	}
+
+	dictionary := make(map[string]int)
+	toCreate := make(map[string]bool)
+	var w []uint16
+	enlargeIn := 2
+	dictSize := 3
+	numBits := 2
+
+	var out strings.Builder
+	dataVal := 0
+	dataPosition := 0
+	const bitsPerChar = 6
+
+	writeBit := func(bit int) {
+		dataVal = (dataVal << 1) | bit
+		if dataPosition == bitsPerChar-1 {
+			dataPosition = 0
+			out.WriteByte(keyStrURISafe[dataVal])
+			dataVal = 0
+		} else {
+			dataPosition++
+		}
+	}
+	writeValue := func(value, n int) {
+		for i := 0; i < n; i++ {
+			writeBit(value & 1)
+			value >>= 1
+		}
+	}
+	decrementEnlarge := func() {
+		enlargeIn--
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+	}
+	emitW := func() {
+		wk := key(w)
+		if toCreate[wk] {
+			if w[0] < 256 {
+				writeValue(0, numBits)
+				writeValue(int(w[0]), 8)
+			} else {
+				writeValue(1, numBits)
+				writeValue(int(w[0]), 16)
+			}
+			decrementEnlarge()
+			delete(toCreate, wk)
+		} else {
+			writeValue(dictionary[wk], numBits)
+		}
+		decrementEnlarge()
+	}
+
+	for _, u := range units {
+		c := []uint16{u}
+		ck := key(c)
+		if _, ok := dictionary[ck]; !ok {
+			dictionary[ck] = dictSize
+			dictSize++
+			toCreate[ck] = true
+		}
+
+		wc := append(append([]uint16{}, w...), u)
+		if _, ok := dictionary[key(wc)]; ok {
+			w = wc
+			continue
+		}
+		emitW()
+		dictionary[key(wc)] = dictSize
+		dictSize++
+		w = c
+	}
+
+	if len(w) > 0 {
+		emitW()
+	}
+
+	writeValue(2, numBits)
+
+	for {
+		dataVal <<= 1
+		if dataPosition == bitsPerChar-1 {
+			out.WriteByte(keyStrURISafe[dataVal])
+			break
+		}
+		dataPosition++
+	}
+	return out.String()
+}
@@ -0,0 +1,59 @@
+package bpjs
+
+import "testing"
+
+// The compressed values were produced by lz-string's
+// compressToEncodedURIComponent.
+var lzVectors = []struct {
+	plain      string
+	compressed string
+}{
+	{"Hello, world", "BIUwNmD2A0AEDukBOYAmQ"},
+	{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "IY18ZZA"},
+	{"Antrean Rawat Jalan – poli 内科 ✓", "IIOwLgTgpghiAEAlGB3GZ4CkYBs70GQCeABwHscBLeQUMVBFz3kGRyIA"},
+	{`{"list":[{"taskid":3,"waktu":"28-12-2025 08:30:00 WIB"}]}`, "N4IgNglgzgLiBcBtUMCGUDWEAmCDMANCAO6oYwCuCIATABwC0AjDQzQAw0CsABO3fDzt47djwDqASQBCIAL4BdOUA"},
+}
+
+func TestDecompressFromEncodedURIComponent(t *testing.T) {
+	for _, v := range lzVectors {
+		got, err := decompressFromEncodedURIComponent(v.compressed)
+		if err != nil || got != v.plain {
+			t.Errorf("decompress(%q) = %q, %v, want %q", v.compressed, got, err, v.plain)
+		}
+	}
+}
+
+func TestCompressToEncodedURIComponent(t *testing.T) {
+	for _, v := range lzVectors {
+		if got := compressToEncodedURIComponent(v.plain); got != v.compressed {
+			t.Errorf("compress(%q) = %q, want %q", v.plain, got, v.compressed)
+		}
+	}
+}
+
+func TestDecompressEmpty(t *testing.T) {
+	if got, err := decompressFromEncodedURIComponent(""); got != "" || err != nil {
+		t.Errorf("decompress(\"\") = %q, %v, want \"\", nil", got, err)
+	}
+}
+
+func TestDecompressMalformed(t *testing.T) {
+	for _, input := range []string{
+		"!!!!",
+		"BIUwNmD2A0AEDukB",
+		"////",
+		"BIUwNmD2A0AEDukBOYAmQé",
+		"$",
+	} {
+		if got, err := decompressFromEncodedURIComponent(input); err == nil {
+			t.Errorf("decompress(%q) = %q, want an error", input, got)
+		}
+	}
+
+	// Every truncation must fail cleanly rather than panic.
+	for _, v := range lzVectors {
+		for n := 1; n < len(v.compressed); n++ {
+			decompressFromEncodedURIComponent(v.compressed[:n])
+		}
+	}
+}
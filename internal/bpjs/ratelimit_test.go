@@ -0,0 +1,85 @@
+package bpjs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := NewRateLimiter(10, 2)
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(expired); err != nil {
+			t.Fatalf("Wait %d with a full bucket: %v", i+1, err)
+		}
+	}
+	if err := l.Wait(expired); err == nil {
+		t.Fatal("Wait on an empty bucket did not block")
+	}
+
+	// 150ms at 10/s refills one and a half tokens.
+	l.last = l.last.Add(-150 * time.Millisecond)
+	if err := l.Wait(expired); err != nil {
+		t.Fatalf("Wait after a refill: %v", err)
+	}
+	if err := l.Wait(expired); err == nil {
+		t.Fatal("Wait used more tokens than were refilled")
+	}
+
+	// The bucket never holds more than the burst.
+	l.last = l.last.Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(expired); err != nil {
+			t.Fatalf("Wait %d after an idle hour: %v", i+1, err)
+		}
+	}
+	if err := l.Wait(expired); err == nil {
+		t.Fatal("bucket refilled past the burst")
+	}
+}
+
+func TestRateLimiterWaits(t *testing.T) {
+	l := NewRateLimiter(50, 1)
+	l.Wait(context.Background())
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 15*time.Millisecond {
+		t.Errorf("waited %s for a token at 50/s, want about 20ms", waited)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	if l := NewRateLimiter(0, 5); l != nil {
+		t.Fatal("NewRateLimiter(0) returned a limiter")
+	}
+	var l *RateLimiter
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("nil limiter Wait = %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{retryBaseDelay: 100 * time.Millisecond, retryMaxDelay: time.Second}
+	ceilings := []time.Duration{100, 200, 400, 800, 1000, 1000}
+
+	for attempt, ceiling := range ceilings {
+		ceiling *= time.Millisecond
+		for i := 0; i < 200; i++ {
+			d := c.backoff(attempt)
+			if d < ceiling/2 || d > ceiling {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, d, ceiling/2, ceiling)
+			}
+		}
+	}
+
+	// A shift past the width of Duration still lands on the maximum.
+	if d := c.backoff(70); d < c.retryMaxDelay/2 || d > c.retryMaxDelay {
+		t.Errorf("backoff(70) = %s, want at most %s", d, c.retryMaxDelay)
+	}
+}
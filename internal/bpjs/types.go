@@ -0,0 +1,139 @@
+package bpjs
+
+type UpdateWaktuRequest struct {
+	KodeBooking string `json:"kodebooking"`
+	TaskID      int    `json:"taskid"`
+	Waktu       int64  `json:"waktu"`
+}
+
+type AddAntreanRequest struct {
+	KodeBooking      string `json:"kodebooking"`
+	JenisPasien      string `json:"jenispasien"`
+	NomorKartu       string `json:"nomorkartu"`
+	NIK              string `json:"nik"`
+	NoHP             string `json:"nohp"`
+	KodePoli         string `json:"kodepoli"`
+	NamaPoli         string `json:"namapoli"`
+	PasienBaru       int    `json:"pasienbaru"`
+	NoRM             string `json:"norm"`
+	TanggalPeriksa   string `json:"tanggalperiksa"`
+	KodeDokter       int    `json:"kodedokter"`
+	NamaDokter       string `json:"namadokter"`
+	JamPraktek       string `json:"jampraktek"`
+	JenisKunjungan   int    `json:"jeniskunjungan"`
+	NomorReferensi   string `json:"nomorreferensi"`
+	NomorAntrean     string `json:"nomorantrean"`
+	AngkaAntrean     int    `json:"angkaantrean"`
+	EstimasiDilayani int64  `json:"estimasidilayani"`
+	SisaKuotaJKN     int    `json:"sisakuotajkn"`
+	KuotaJKN         int    `json:"kuotajkn"`
+	SisaKuotaNonJKN  int    `json:"sisakuotanonjkn"`
+	KuotaNonJKN      int    `json:"kuotanonjkn"`
+	Keterangan       string `json:"keterangan"`
+}
+
+type AddAntreanFarmasiRequest struct {
+	KodeBooking  string `json:"kodebooking"`
+	JenisResep   string `json:"jenisresep"`
+	NomorAntrean int    `json:"nomorantrean"`
+	Keterangan   string `json:"keterangan"`
+}
+
+type BatalAntreanRequest struct {
+	KodeBooking string `json:"kodebooking"`
+	Keterangan  string `json:"keterangan"`
+}
+
+type GetListTaskRequest struct {
+	KodeBooking string `json:"kodebooking"`
+}
+
+type ListTask struct {
+	WaktuRS     string `json:"wakturs"`
+	Waktu       string `json:"waktu"`
+	TaskName    string `json:"taskname"`
+	TaskID      int    `json:"taskid"`
+	KodeBooking string `json:"kodebooking"`
+}
+
+type Poli struct {
+	NamaPoli         string `json:"nmpoli"`
+	NamaSubspesialis string `json:"nmsubspesialis"`
+	KodeSubspesialis string `json:"kdsubspesialis"`
+	KodePoli         string `json:"kdpoli"`
+	Finger           int    `json:"finger,omitempty"`
+}
+
+type Dokter struct {
+	NamaDokter string `json:"namadokter"`
+	KodeDokter int    `json:"kodedokter"`
+}
+
+type JadwalDokter struct {
+	KodeSubspesialis string `json:"kodesubspesialis"`
+	Hari             int    `json:"hari"`
+	KapasitasPasien  int    `json:"kapasitaspasien"`
+	Libur            int    `json:"libur"`
+	NamaHari         string `json:"namahari"`
+	Jadwal           string `json:"jadwal"`
+	NamaSubspesialis string `json:"namasubspesialis"`
+	NamaDokter       string `json:"namadokter"`
+	KodePoli         string `json:"kodepoli"`
+	NamaPoli         string `json:"namapoli"`
+	KodeDokter       int    `json:"kodedokter"`
+}
+
+type JadwalHari struct {
+	Hari  string `json:"hari"`
+	Buka  string `json:"buka"`
+	Tutup string `json:"tutup"`
+}
+
+type UpdateJadwalDokterRequest struct {
+	KodePoli         string       `json:"kodepoli"`
+	KodeSubspesialis string       `json:"kodesubspesialis"`
+	KodeDokter       int          `json:"kodedokter"`
+	Jadwal           []JadwalHari `json:"jadwal"`
+}
+
+type DashboardWaktuTunggu struct {
+	KodePPK       string `json:"kdppk"`
+	WaktuTask1    int64  `json:"waktu_task1"`
+	AvgWaktuTask1 int64  `json:"avg_waktu_task1"`
+	WaktuTask2    int64  `json:"waktu_task2"`
+	AvgWaktuTask2 int64  `json:"avg_waktu_task2"`
+	WaktuTask3    int64  `json:"waktu_task3"`
+	AvgWaktuTask3 int64  `json:"avg_waktu_task3"`
+	WaktuTask4    int64  `json:"waktu_task4"`
+	AvgWaktuTask4 int64  `json:"avg_waktu_task4"`
+	WaktuTask5    int64  `json:"waktu_task5"`
+	AvgWaktuTask5 int64  `json:"avg_waktu_task5"`
+	WaktuTask6    int64  `json:"waktu_task6"`
+	AvgWaktuTask6 int64  `json:"avg_waktu_task6"`
+	JumlahAntrean int    `json:"jumlah_antrean"`
+	NamaPoli      string `json:"namapoli"`
+	KodePoli      string `json:"kodepoli"`
+	Tanggal       string `json:"tanggal"`
+	NamaPPK       string `json:"nmppk"`
+	InsertDate    int64  `json:"insertdate"`
+}
+
+type Antrean struct {
+	KodeBooking      string `json:"kodebooking"`
+	Tanggal          string `json:"tanggal"`
+	KodePoli         string `json:"kodepoli"`
+	KodeDokter       int    `json:"kodedokter"`
+	JamPraktek       string `json:"jampraktek"`
+	NIK              string `json:"nik"`
+	NoKaPst          string `json:"nokapst"`
+	NoHP             string `json:"nohp"`
+	NoRekamMedis     string `json:"norekammedis"`
+	JenisKunjungan   int    `json:"jeniskunjungan"`
+	NomorReferensi   string `json:"nomorreferensi"`
+	SumberData       string `json:"sumberdata"`
+	IsPeserta        int    `json:"ispeserta"`
+	NoAntrean        string `json:"noantrean"`
+	EstimasiDilayani int64  `json:"estimasidilayani"`
+	CreatedTime      int64  `json:"createdtime"`
+	Status           string `json:"status"`
+}
@@ -0,0 +1,421 @@
+package bpjsmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gotrol/internal/bpjs"
+)
+
+// Options configures the mock. ConsID and SecretKey must match the
+// credentials the client under test signs with.
+type Options struct {
+	ConsID    string
+	SecretKey string
+
+	// MaxClockSkew bounds how far X-timestamp may drift from the mock's
+	// clock. Zero means 5 minutes.
+	MaxClockSkew time.Duration
+
+	// AutoRegister accepts updatewaktu, batal and getlisttask for
+	// kodebookings that never went through antrean/add. Real BPJS does not,
+	// but SIMRS test databases are full of bookings made elsewhere.
+	AutoRegister bool
+
+	Failures FailureConfig
+}
+
+// FailureConfig injects faults ahead of the normal BPJS semantics.
+type FailureConfig struct {
+	// Latency is added before every answer.
+	Latency time.Duration `yaml:"latency"`
+	// ErrorRate is the fraction of requests answered with HTTP ErrorStatus
+	// and no BPJS body, simulating gateway failures.
+	ErrorRate   float64 `yaml:"error_rate"`
+	ErrorStatus int     `yaml:"error_status"`
+	// Rules force a specific BPJS answer for matching requests.
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule matches on endpoint (e.g. "antrean/updatewaktu"), and optionally on
+// kodebooking and task. Times limits how often the rule fires; 0 means
+// always.
+type Rule struct {
+	Endpoint    string `yaml:"endpoint"`
+	KodeBooking string `yaml:"kodebooking"`
+	TaskID      int    `yaml:"taskid"`
+	Code        int    `yaml:"code"`
+	Message     string `yaml:"message"`
+	HTTPStatus  int    `yaml:"http_status"`
+	Times       int    `yaml:"times"`
+
+	fired int
+}
+
+type taskRecord struct {
+	Waktu    int64     `json:"waktu"`
+	Received time.Time `json:"received"`
+}
+
+type booking struct {
+	Antrean *bpjs.AddAntreanRequest `json:"antrean,omitempty"`
+	Tasks   map[int]taskRecord      `json:"tasks"`
+	Batal   bool                    `json:"batal"`
+	Alasan  string                  `json:"alasan,omitempty"`
+}
+
+// Server emulates the BPJS Antrean RS endpoints gotrol uses and keeps task
+// state per kodebooking in memory.
+type Server struct {
+	opts     Options
+	mu       sync.Mutex
+	bookings map[string]*booking
+}
+
+func NewServer(opts Options) *Server {
+	if opts.MaxClockSkew == 0 {
+		opts.MaxClockSkew = 5 * time.Minute
+	}
+	if opts.Failures.ErrorStatus == 0 {
+		opts.Failures.ErrorStatus = http.StatusServiceUnavailable
+	}
+	return &Server{
+		opts:     opts,
+		bookings: make(map[string]*booking),
+	}
+}
+
+// NewTestServer starts the mock on a loopback port. Use ts.URL + "/" as
+// AntrianURL.
+func NewTestServer(opts Options) (*httptest.Server, *Server) {
+	s := NewServer(opts)
+	return httptest.NewServer(s), s
+}
+
+// Tasks returns the waktu BPJS would hold for each task of a kodebooking.
+func (s *Server) Tasks(kodeBooking string) map[int]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make(map[int]int64)
+	if b, ok := s.bookings[kodeBooking]; ok {
+		for id, t := range b.Tasks {
+			result[id] = t.Waktu
+		}
+	}
+	return result
+}
+
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bookings = make(map[string]*booking)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/_state" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.bookings)
+		return
+	}
+
+	if s.opts.Failures.Latency > 0 {
+		time.Sleep(s.opts.Failures.Latency)
+	}
+
+	if s.opts.Failures.ErrorRate > 0 && rand.Float64() < s.opts.Failures.ErrorRate {
+		http.Error(w, "injected failure", s.opts.Failures.ErrorStatus)
+		return
+	}
+
+	timestamp := r.Header.Get("X-timestamp")
+	if code, msg := s.authenticate(r); code != 0 {
+		writeMeta(w, code, msg)
+		return
+	}
+
+	endpoint := endpointOf(r.URL.Path)
+
+	var body map[string]interface{}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeMeta(w, 201, "Format request tidak valid")
+			return
+		}
+	}
+	kodeBooking, _ := body["kodebooking"].(string)
+	taskID := 0
+	if v, ok := body["taskid"].(float64); ok {
+		taskID = int(v)
+	}
+
+	if rule := s.matchRule(endpoint, kodeBooking, taskID); rule != nil {
+		if rule.HTTPStatus != 0 && rule.HTTPStatus != http.StatusOK {
+			http.Error(w, rule.Message, rule.HTTPStatus)
+			return
+		}
+		writeMeta(w, rule.Code, rule.Message)
+		return
+	}
+
+	switch endpoint {
+	case "antrean/add":
+		s.handleAdd(w, body)
+	case "antrean/updatewaktu":
+		s.handleUpdateWaktu(w, kodeBooking, taskID, body)
+	case "antrean/batal":
+		keterangan, _ := body["keterangan"].(string)
+		s.handleBatal(w, kodeBooking, keterangan)
+	case "antrean/getlisttask":
+		s.handleGetListTask(w, kodeBooking, timestamp)
+	default:
+		writeMeta(w, 201, "Endpoint tidak tersedia di mock: "+endpoint)
+	}
+}
+
+func (s *Server) authenticate(r *http.Request) (int, string) {
+	consID := r.Header.Get("X-cons-id")
+	timestamp := r.Header.Get("X-timestamp")
+	signature := r.Header.Get("X-signature")
+
+	if consID == "" || timestamp == "" || signature == "" {
+		return 401, "Authentication failed: header X-cons-id, X-timestamp dan X-signature wajib diisi"
+	}
+	if consID != s.opts.ConsID {
+		return 401, "Authentication failed: cons id tidak dikenal"
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return 401, "Authentication failed: X-timestamp tidak valid"
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	if skew < -s.opts.MaxClockSkew || skew > s.opts.MaxClockSkew {
+		return 401, "Authentication failed: X-timestamp kadaluarsa"
+	}
+	if signature != bpjs.Signature(s.opts.ConsID, s.opts.SecretKey, timestamp) {
+		return 401, "Authentication failed: signature tidak valid"
+	}
+	return 0, ""
+}
+
+func (s *Server) matchRule(endpoint, kodeBooking string, taskID int) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.opts.Failures.Rules {
+		rule := &s.opts.Failures.Rules[i]
+		if rule.Endpoint != "" && rule.Endpoint != endpoint {
+			continue
+		}
+		if rule.KodeBooking != "" && rule.KodeBooking != kodeBooking {
+			continue
+		}
+		if rule.TaskID != 0 && rule.TaskID != taskID {
+			continue
+		}
+		if rule.Times > 0 && rule.fired >= rule.Times {
+			continue
+		}
+		rule.fired++
+		return rule
+	}
+	return nil
+}
+
+// lookup returns the booking, registering it first when AutoRegister is on.
+// Callers must hold s.mu.
+func (s *Server) lookup(kodeBooking string) *booking {
+	b, ok := s.bookings[kodeBooking]
+	if !ok && s.opts.AutoRegister && kodeBooking != "" {
+		b = &booking{Tasks: make(map[int]taskRecord)}
+		s.bookings[kodeBooking] = b
+	}
+	return b
+}
+
+func (s *Server) handleAdd(w http.ResponseWriter, body map[string]interface{}) {
+	raw, _ := json.Marshal(body)
+	var req bpjs.AddAntreanRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		writeMeta(w, 201, "Format request tidak valid")
+		return
+	}
+	if req.KodeBooking == "" {
+		writeMeta(w, 201, "Kode Booking tidak boleh kosong")
+		return
+	}
+	if req.TanggalPeriksa == "" {
+		writeMeta(w, 201, "Tanggal Periksa tidak boleh kosong")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bookings[req.KodeBooking]; ok {
+		writeMeta(w, 208, "Terdapat duplikasi Kode Booking")
+		return
+	}
+	s.bookings[req.KodeBooking] = &booking{
+		Antrean: &req,
+		Tasks:   make(map[int]taskRecord),
+	}
+	writeMeta(w, 200, "Ok.")
+}
+
+func (s *Server) handleUpdateWaktu(w http.ResponseWriter, kodeBooking string, taskID int, body map[string]interface{}) {
+	waktuF, _ := body["waktu"].(float64)
+	waktu := int64(waktuF)
+
+	if (taskID < 1 || taskID > 7) && taskID != 99 {
+		writeMeta(w, 201, "TaskId tidak valid")
+		return
+	}
+	if waktu <= 0 {
+		writeMeta(w, 201, "Waktu tidak valid")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.lookup(kodeBooking)
+	if b == nil {
+		writeMeta(w, 201, "Antrean Tidak Ditemukan.")
+		return
+	}
+	if b.Batal {
+		writeMeta(w, 201, "Antrean sudah dibatalkan")
+		return
+	}
+	if _, ok := b.Tasks[taskID]; ok {
+		writeMeta(w, 208, fmt.Sprintf("TaskId=%d sudah ada", taskID))
+		return
+	}
+
+	if taskID != 99 {
+		for prev := taskID - 1; prev >= 1; prev-- {
+			t, ok := b.Tasks[prev]
+			if !ok {
+				continue
+			}
+			if waktu <= t.Waktu {
+				writeMeta(w, 201, fmt.Sprintf("waktu TaskId=%d tidak boleh kurang atau sama dengan waktu TaskId=%d", taskID, prev))
+				return
+			}
+			break
+		}
+	}
+
+	b.Tasks[taskID] = taskRecord{Waktu: waktu, Received: time.Now()}
+	if taskID == 99 {
+		b.Batal = true
+	}
+	writeMeta(w, 200, "OK")
+}
+
+func (s *Server) handleBatal(w http.ResponseWriter, kodeBooking, keterangan string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.lookup(kodeBooking)
+	if b == nil {
+		writeMeta(w, 201, "Antrean Tidak Ditemukan.")
+		return
+	}
+	if b.Batal {
+		writeMeta(w, 201, "Antrean Sudah Dibatalkan sebelumnya")
+		return
+	}
+	if _, ok := b.Tasks[5]; ok {
+		writeMeta(w, 201, "Antrean tidak dapat dibatalkan, pasien sudah dilayani")
+		return
+	}
+	b.Batal = true
+	b.Alasan = keterangan
+	writeMeta(w, 200, "Ok")
+}
+
+var taskNames = map[int]string{
+	1:  "mulai waktu tunggu admisi",
+	2:  "akhir waktu tunggu admisi/mulai waktu layan admisi",
+	3:  "akhir waktu layan admisi/mulai waktu tunggu poli",
+	4:  "akhir waktu tunggu poli/mulai waktu layan poli",
+	5:  "akhir waktu layan poli/mulai waktu tunggu farmasi",
+	6:  "akhir waktu tunggu farmasi/mulai waktu layan farmasi membuat obat",
+	7:  "akhir waktu obat selesai dibuat",
+	99: "tidak hadir/batal",
+}
+
+func (s *Server) handleGetListTask(w http.ResponseWriter, kodeBooking, timestamp string) {
+	s.mu.Lock()
+	b := s.lookup(kodeBooking)
+	var list []bpjs.ListTask
+	if b != nil {
+		ids := make([]int, 0, len(b.Tasks))
+		for id := range b.Tasks {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			t := b.Tasks[id]
+			list = append(list, bpjs.ListTask{
+				WaktuRS:     time.UnixMilli(t.Waktu).Format("02-01-2006 15:04:05") + " WIB",
+				Waktu:       t.Received.Format("02-01-2006 15:04:05") + " WIB",
+				TaskName:    taskNames[id],
+				TaskID:      id,
+				KodeBooking: kodeBooking,
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	if b == nil {
+		writeMeta(w, 201, "Antrean Tidak Ditemukan.")
+		return
+	}
+
+	plain, _ := json.Marshal(list)
+	encrypted, err := bpjs.EncryptResponse(s.opts.ConsID, s.opts.SecretKey, timestamp, string(plain))
+	if err != nil {
+		writeMeta(w, 500, err.Error())
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"response": encrypted,
+		"metadata": map[string]interface{}{"code": 200, "message": "Ok."},
+	})
+}
+
+// endpointOf strips whatever base path the AntrianURL carries, e.g.
+// "/antreanrs/antrean/updatewaktu" becomes "antrean/updatewaktu".
+func endpointOf(path string) string {
+	for _, ep := range []string{"antrean/add", "antrean/updatewaktu", "antrean/batal", "antrean/getlisttask"} {
+		if strings.HasSuffix(path, "/"+ep) {
+			return ep
+		}
+	}
+	return strings.TrimPrefix(path, "/")
+}
+
+func writeMeta(w http.ResponseWriter, code int, message string) {
+	if code != 200 {
+		log.Printf("   mock → %d %s", code, message)
+	}
+	writeJSON(w, map[string]interface{}{
+		"metadata": map[string]interface{}{"code": code, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
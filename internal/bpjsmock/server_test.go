@@ -0,0 +1,176 @@
+package bpjsmock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/config"
+)
+
+const (
+	testConsID = "1234"
+	testSecret = "secret"
+)
+
+func newTestClient(t *testing.T, opts Options) (*bpjs.Client, *Server) {
+	t.Helper()
+	opts.ConsID, opts.SecretKey = testConsID, testSecret
+	ts, s := NewTestServer(opts)
+	t.Cleanup(ts.Close)
+	creds := &config.BPJSCredentials{ConsID: testConsID, SecretKey: testSecret, AntrianURL: ts.URL + "/"}
+	return bpjs.NewClient(creds, config.BPJSConfig{}, nil), s
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := NewServer(Options{ConsID: testConsID, SecretKey: testSecret})
+	now := time.Now().Unix()
+	stamp := func(offset time.Duration) string { return strconv.FormatInt(now+int64(offset.Seconds()), 10) }
+
+	tests := []struct {
+		name      string
+		consID    string
+		timestamp string
+		signature string
+		wantCode  int
+	}{
+		{"valid", testConsID, stamp(0), bpjs.Signature(testConsID, testSecret, stamp(0)), 0},
+		{"missing headers", "", "", "", 401},
+		{"unknown cons id", "9999", stamp(0), bpjs.Signature("9999", testSecret, stamp(0)), 401},
+		{"timestamp not a number", testConsID, "kemarin", bpjs.Signature(testConsID, testSecret, "kemarin"), 401},
+		{"clock behind", testConsID, stamp(-10 * time.Minute), bpjs.Signature(testConsID, testSecret, stamp(-10*time.Minute)), 401},
+		{"clock ahead", testConsID, stamp(10 * time.Minute), bpjs.Signature(testConsID, testSecret, stamp(10*time.Minute)), 401},
+		{"small skew", testConsID, stamp(-time.Minute), bpjs.Signature(testConsID, testSecret, stamp(-time.Minute)), 0},
+		{"wrong secret", testConsID, stamp(0), bpjs.Signature(testConsID, "other", stamp(0)), 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/antrean/getlisttask", nil)
+			r.Header.Set("X-cons-id", tt.consID)
+			r.Header.Set("X-timestamp", tt.timestamp)
+			r.Header.Set("X-signature", tt.signature)
+			if code, msg := s.authenticate(r); code != tt.wantCode {
+				t.Errorf("authenticate = %d %q, want %d", code, msg, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRuleTimes(t *testing.T) {
+	client, _ := newTestClient(t, Options{
+		AutoRegister: true,
+		Failures: FailureConfig{Rules: []Rule{
+			{Endpoint: "antrean/updatewaktu", KodeBooking: "KB1", TaskID: 3, Code: 201, Message: "forced", Times: 2},
+		}},
+	})
+	waktu := time.Date(2025, 12, 28, 8, 0, 0, 0, time.Local).UnixMilli()
+
+	steps := []struct {
+		kodeBooking string
+		taskID      int
+		wantCode    int
+	}{
+		{"KB1", 1, 200},
+		{"KB2", 3, 200},
+		{"KB1", 3, 201},
+		{"KB1", 3, 201},
+		{"KB1", 3, 200},
+	}
+	for i, st := range steps {
+		resp, err := client.UpdateWaktu(st.kodeBooking, st.taskID, waktu+int64(i)*60000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Metadata.Code != st.wantCode {
+			t.Errorf("step %d %s task %d = %d %q, want %d", i, st.kodeBooking, st.taskID, resp.Metadata.Code, resp.Metadata.Message, st.wantCode)
+		}
+	}
+}
+
+func TestRuleTimesConcurrent(t *testing.T) {
+	s := NewServer(Options{Failures: FailureConfig{Rules: []Rule{{Endpoint: "antrean/updatewaktu", Code: 201, Times: 5}}}})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	fired := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.matchRule("antrean/updatewaktu", "KB1", 1) != nil {
+				mu.Lock()
+				fired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if fired != 5 {
+		t.Errorf("rule fired %d times, want 5", fired)
+	}
+}
+
+func TestUpdateWaktuAndGetListTask(t *testing.T) {
+	client, s := newTestClient(t, Options{})
+	base := time.Date(2025, 12, 28, 8, 0, 0, 0, time.Local)
+	at := func(minutes int) int64 { return base.Add(time.Duration(minutes) * time.Minute).UnixMilli() }
+
+	if _, resp, err := client.GetListTask("KB1"); err != nil || resp.Metadata.Code != 201 {
+		t.Fatalf("unknown kodebooking: %v %+v", err, resp)
+	}
+	if resp, err := client.UpdateWaktu("KB1", 1, at(0)); err != nil || resp.Metadata.Code != 201 {
+		t.Fatalf("updatewaktu before antrean/add: %v %+v", err, resp)
+	}
+	if resp, err := client.TambahAntrean(bpjs.AddAntreanRequest{KodeBooking: "KB1", TanggalPeriksa: "2025-12-28"}); err != nil || resp.Metadata.Code != 200 {
+		t.Fatalf("antrean/add: %v %+v", err, resp)
+	}
+
+	steps := []struct {
+		name     string
+		taskID   int
+		waktu    int64
+		wantCode int
+	}{
+		{"task 1", 1, at(0), 200},
+		{"task 3 skipping 2", 3, at(10), 200},
+		{"task 1 again", 1, at(1), 208},
+		{"task 4 before task 3", 4, at(5), 201},
+		{"task 4", 4, at(20), 200},
+		{"unknown task", 8, at(30), 201},
+	}
+	for _, st := range steps {
+		resp, err := client.UpdateWaktu("KB1", st.taskID, st.waktu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Metadata.Code != st.wantCode {
+			t.Errorf("%s = %d %q, want %d", st.name, resp.Metadata.Code, resp.Metadata.Message, st.wantCode)
+		}
+	}
+
+	want := map[int]int64{1: at(0), 3: at(10), 4: at(20)}
+	got := s.Tasks("KB1")
+	if len(got) != len(want) {
+		t.Fatalf("tasks = %v, want %v", got, want)
+	}
+	for id, waktu := range want {
+		if got[id] != waktu {
+			t.Errorf("task %d = %d, want %d", id, got[id], waktu)
+		}
+	}
+
+	list, resp, err := client.GetListTask("KB1")
+	if err != nil || resp.Metadata.Code != 200 {
+		t.Fatalf("getlisttask: %v %+v", err, resp)
+	}
+	if len(list) != 3 || list[0].TaskID != 1 || list[2].TaskID != 4 {
+		t.Fatalf("list = %+v", list)
+	}
+	if list[1].WaktuRS != "28-12-2025 08:10:00 WIB" {
+		t.Errorf("task 3 wakturs = %q", list[1].WaktuRS)
+	}
+}
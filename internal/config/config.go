@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"regexp"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,29 +14,155 @@ type Config struct {
 	Watcher  WatcherConfig  `yaml:"watcher"`
 	API      APIConfig      `yaml:"api"`
 	Report   ReportConfig   `yaml:"report"`
+	BPJS     BPJSConfig     `yaml:"bpjs"`
+	Tasks    TasksConfig    `yaml:"tasks"`
+	WSRS     WSRSConfig     `yaml:"wsrs"`
+	Events   EventsConfig   `yaml:"events"`
 }
 
+// DatabaseConfig is the SIMRS database. Schema names the SIMRS whose tables
+// GoTrol reads: mlite (the default) or khanza.
 type DatabaseConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Name     string `yaml:"name"`
+	Schema   string `yaml:"schema"`
 }
 
+// WatcherConfig controls the polling loop. With Incremental on, each task is
+// sent as soon as its source record appears instead of all at once after
+// the entry is complete; progress is the per-task status in the task table.
+// WalkIn registers JKN visits made at the counter with antrean/add so they
+// are reported too; it needs the mLITE schema.
 type WatcherConfig struct {
 	PollInterval string `yaml:"poll_interval"`
+	Incremental  bool   `yaml:"incremental"`
+	WalkIn       bool   `yaml:"walk_in"`
 }
 
+// APIConfig is the dashboard API. Reviewers are the supervisors who may
+// decide the review queue; each sends its own key in X-Api-Key and its
+// decisions are recorded under its Name.
 type APIConfig struct {
-	Enabled bool `yaml:"enabled"`
-	Port    int  `yaml:"port"`
+	Enabled   bool       `yaml:"enabled"`
+	Port      int        `yaml:"port"`
+	Reviewers []Reviewer `yaml:"reviewers"`
+}
+
+type Reviewer struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
 }
 
 type ReportConfig struct {
 	DBPath string `yaml:"db_path"`
 }
 
+// BPJSConfig tunes the transport to the BPJS Antrean API. Durations use
+// time.ParseDuration syntax; RateLimit is in requests per second for each
+// gotrol process and a value of 0 disables limiting. PayerCodes are the
+// penjab codes treated as JKN; when empty kd_pj_bpjs from mlite_settings is
+// used, then BPJ. The credentials, when set, replace the ones in the SIMRS
+// settings; Khanza keeps none in its database.
+type BPJSConfig struct {
+	Timeout        string   `yaml:"timeout"`
+	MaxRetries     int      `yaml:"max_retries"`
+	RetryBaseDelay string   `yaml:"retry_base_delay"`
+	RetryMaxDelay  string   `yaml:"retry_max_delay"`
+	RateLimit      float64  `yaml:"rate_limit"`
+	RateBurst      int      `yaml:"rate_burst"`
+	PayerCodes     []string `yaml:"payer_codes"`
+	ConsID         string   `yaml:"cons_id"`
+	SecretKey      string   `yaml:"secret_key"`
+	UserKey        string   `yaml:"user_key"`
+	AntrianURL     string   `yaml:"antrian_url"`
+}
+
+// TasksConfig controls how task times are derived. In faithful mode GoTrol
+// never writes or sends a time that was generated or defaulted instead of
+// read from a SIMRS record; such entries are reported as needing data. With
+// review on, entries whose times were changed or made up, or that BPJS
+// rejected or would reject for ordering, wait for a supervisor before they
+// are sent.
+//
+// Before an entry is sent its times are checked against the tasks BPJS
+// already accepted; VerifyRemote reads those from antrean/getlisttask rather
+// than trusting the local Sudah rows alone.
+//
+// Sources replace the built-in candidates of the tasks they list, tried in
+// order until one has a time; PoliSources do the same for a single kd_poli.
+type TasksConfig struct {
+	Faithful     bool                            `yaml:"faithful"`
+	Review       bool                            `yaml:"review"`
+	VerifyRemote bool                            `yaml:"verify_remote"`
+	Sources      map[int][]TaskSource            `yaml:"sources"`
+	PoliSources  map[string]map[int][]TaskSource `yaml:"poli_sources"`
+}
+
+// TaskSource is a column a task time can be read from. Time is a TIME column
+// combined with the DATE column Date, or a DATETIME when Date is empty. Rows
+// are matched to the visit on Key, no_rawat by default; a source keyed on
+// no_rkm_medis only sees rows whose Date is the visit date.
+//
+// Pick chooses among several rows: earliest (the default), latest, or final,
+// the latest once every row has a time. ID names the column recorded as the
+// row chosen. Racikan keeps only prescriptions with (only) or without
+// (exclude) a resep_dokter_racikan row; the table needs a no_resep column.
+type TaskSource struct {
+	Table   string `yaml:"table"`
+	Date    string `yaml:"date"`
+	Time    string `yaml:"time"`
+	Key     string `yaml:"key"`
+	Pick    string `yaml:"pick"`
+	ID      string `yaml:"id"`
+	Racikan string `yaml:"racikan"`
+}
+
+// Row picks and racikan filters of a TaskSource.
+const (
+	PickEarliest   = "earliest"
+	PickLatest     = "latest"
+	PickFinal      = "final"
+	RacikanOnly    = "only"
+	RacikanExclude = "exclude"
+)
+
+func (s TaskSource) String() string {
+	return s.Table + "." + s.Time
+}
+
+// WSRSConfig is the hospital-side web service Mobile JKN calls. Username and
+// Password are what BPJS sends to the token endpoint; Secret signs the
+// tokens and is random per start when empty. MinutesPerPatient drives the
+// estimated service times.
+type WSRSConfig struct {
+	Port              int    `yaml:"port"`
+	Username          string `yaml:"username"`
+	Password          string `yaml:"password"`
+	Secret            string `yaml:"secret"`
+	TokenTTL          string `yaml:"token_ttl"`
+	MinutesPerPatient int    `yaml:"minutes_per_patient"`
+}
+
+// EventsConfig is the ingest API the loket, poli and apotek apps post task
+// events to while the watcher runs. Each client has its own key and may only
+// report its Tasks (all when empty). Forward sends an event to BPJS as soon
+// as it is stored instead of waiting for the next poll.
+type EventsConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Port    int           `yaml:"port"`
+	Forward bool          `yaml:"forward"`
+	Clients []EventClient `yaml:"clients"`
+}
+
+type EventClient struct {
+	Name  string `yaml:"name"`
+	Key   string `yaml:"key"`
+	Tasks []int  `yaml:"tasks"`
+}
+
 type BPJSCredentials struct {
 	ConsID     string
 	SecretKey  string
@@ -51,16 +179,139 @@ func (w *WatcherConfig) GetPollDuration() time.Duration {
 	return d
 }
 
+func (b *BPJSConfig) GetTimeout() time.Duration {
+	return parseDurationOr(b.Timeout, 10*time.Second)
+}
+
+func (b *BPJSConfig) GetRetryBaseDelay() time.Duration {
+	return parseDurationOr(b.RetryBaseDelay, 500*time.Millisecond)
+}
+
+func (b *BPJSConfig) GetRetryMaxDelay() time.Duration {
+	return parseDurationOr(b.RetryMaxDelay, 10*time.Second)
+}
+
+// ApplyCredentials overrides creds with the credentials set in config.yaml.
+func (b *BPJSConfig) ApplyCredentials(creds *BPJSCredentials) {
+	if b.ConsID != "" {
+		creds.ConsID = b.ConsID
+	}
+	if b.SecretKey != "" {
+		creds.SecretKey = b.SecretKey
+	}
+	if b.UserKey != "" {
+		creds.UserKey = b.UserKey
+	}
+	if b.AntrianURL != "" {
+		creds.AntrianURL = b.AntrianURL
+	}
+}
+
+func (w *WSRSConfig) GetTokenTTL() time.Duration {
+	return parseDurationOr(w.TokenTTL, time.Hour)
+}
+
+func (w *WSRSConfig) GetMinutesPerPatient() int {
+	if w.MinutesPerPatient <= 0 {
+		return 10
+	}
+	return w.MinutesPerPatient
+}
+
+var columnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks the task source mapping. The columns are only checked
+// against the database once it is connected.
+func (t *TasksConfig) Validate() error {
+	for task, sources := range t.Sources {
+		if err := validateSources(fmt.Sprintf("tasks.sources.%d", task), task, sources); err != nil {
+			return err
+		}
+	}
+	for poli, tasks := range t.PoliSources {
+		for task, sources := range tasks {
+			if err := validateSources(fmt.Sprintf("tasks.poli_sources.%s.%d", poli, task), task, sources); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSources(path string, task int, sources []TaskSource) error {
+	if task < 1 || task > 7 {
+		return fmt.Errorf("%s: task must be 1 to 7", path)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("%s: no sources", path)
+	}
+	for i, s := range sources {
+		at := fmt.Sprintf("%s[%d]", path, i)
+		if s.Table == "" || s.Time == "" {
+			return fmt.Errorf("%s: table and time are required", at)
+		}
+		for _, name := range []string{s.Table, s.Date, s.Time, s.Key, s.ID} {
+			if name != "" && !columnPattern.MatchString(name) {
+				return fmt.Errorf("%s: invalid name %q", at, name)
+			}
+		}
+		switch s.Key {
+		case "", "no_rawat":
+		case "no_rkm_medis":
+			if s.Date == "" {
+				return fmt.Errorf("%s: a source keyed on no_rkm_medis needs a date column", at)
+			}
+		default:
+			return fmt.Errorf("%s: key must be no_rawat or no_rkm_medis", at)
+		}
+		switch s.Pick {
+		case "", PickEarliest, PickLatest, PickFinal:
+		default:
+			return fmt.Errorf("%s: pick must be earliest, latest or final", at)
+		}
+		switch s.Racikan {
+		case "", RacikanOnly, RacikanExclude:
+		default:
+			return fmt.Errorf("%s: racikan must be only or exclude", at)
+		}
+	}
+	return nil
+}
+
+func parseDurationOr(s string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+func DefaultBPJSConfig() BPJSConfig {
+	return BPJSConfig{
+		Timeout:        "10s",
+		MaxRetries:     3,
+		RetryBaseDelay: "500ms",
+		RetryMaxDelay:  "10s",
+		RateLimit:      5,
+		RateBurst:      5,
+	}
+}
+
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var cfg Config
+	cfg := Config{
+		BPJS: DefaultBPJSConfig(),
+	}
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.Tasks.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTasksConfigValidate(t *testing.T) {
+	valid := TaskSource{Table: "resep_obat", Date: "tgl_peresepan", Time: "jam", ID: "no_resep", Pick: PickFinal}
+
+	tests := []struct {
+		name    string
+		cfg     TasksConfig
+		wantErr string
+	}{
+		{
+			name: "valid mapping",
+			cfg: TasksConfig{
+				Sources:     map[int][]TaskSource{7: {valid}},
+				PoliSources: map[string]map[int][]TaskSource{"INT": {1: {{Table: "loket", Key: "no_rkm_medis", Date: "tanggal", Time: "mulai"}}}},
+			},
+		},
+		{
+			name: "no mapping",
+			cfg:  TasksConfig{},
+		},
+		{
+			name:    "task out of range",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{8: {valid}}},
+			wantErr: "tasks.sources.8: task must be 1 to 7",
+		},
+		{
+			name:    "task out of range for a poli",
+			cfg:     TasksConfig{PoliSources: map[string]map[int][]TaskSource{"INT": {0: {valid}}}},
+			wantErr: "tasks.poli_sources.INT.0: task must be 1 to 7",
+		},
+		{
+			name:    "empty list",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{5: {}}},
+			wantErr: "tasks.sources.5: no sources",
+		},
+		{
+			name:    "missing table",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{5: {{Time: "jam_rawat"}}}},
+			wantErr: "tasks.sources.5[0]: table and time are required",
+		},
+		{
+			name:    "missing time",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{5: {valid, {Table: "pemeriksaan_ralan"}}}},
+			wantErr: "tasks.sources.5[1]: table and time are required",
+		},
+		{
+			name:    "invalid table name",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{5: {{Table: "resep_obat; DROP TABLE pasien", Time: "jam"}}}},
+			wantErr: "invalid name",
+		},
+		{
+			name:    "invalid column name",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{5: {{Table: "resep_obat", Time: "jam`"}}}},
+			wantErr: "invalid name",
+		},
+		{
+			name:    "no_rkm_medis key without a date",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{1: {{Table: "loket", Key: "no_rkm_medis", Time: "mulai"}}}},
+			wantErr: "needs a date column",
+		},
+		{
+			name:    "unknown key",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{1: {{Table: "loket", Key: "no_reg", Time: "mulai"}}}},
+			wantErr: "key must be no_rawat or no_rkm_medis",
+		},
+		{
+			name:    "bad pick",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{6: {{Table: "resep_obat", Time: "jam", Pick: "first"}}}},
+			wantErr: "pick must be earliest, latest or final",
+		},
+		{
+			name:    "bad racikan",
+			cfg:     TasksConfig{Sources: map[int][]TaskSource{6: {{Table: "resep_obat", Time: "jam", Racikan: "yes"}}}},
+			wantErr: "racikan must be only or exclude",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotrol/internal/models"
+)
+
+// Refusals of RegisterBooking.
+var (
+	ErrAlreadyBooked = errors.New("patient already has a visit to this poli on that date")
+	ErrQuotaFull     = errors.New("JKN quota is full")
+)
+
+// ErrAlreadyServed refuses to cancel a visit that is no longer Belum.
+var ErrAlreadyServed = errors.New("patient has already been served")
+
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (m *MySQL) nearestSession(kdPoli, kdDokter, hariKerja, jamReg string) (*models.DoctorSession, error) {
+	var s models.DoctorSession
+	err := m.DB.QueryRow(`
+		SELECT TIME_FORMAT(jam_mulai, '%H:%i'), TIME_FORMAT(jam_selesai, '%H:%i'), kuota
+		FROM jadwal
+		WHERE kd_poli = ? AND kd_dokter = ? AND hari_kerja = ?
+		ORDER BY jam_mulai <= ? DESC, ABS(TIME_TO_SEC(TIMEDIFF(jam_mulai, ?))) ASC
+		LIMIT 1
+	`, kdPoli, kdDokter, hariKerja, jamReg, jamReg).Scan(&s.JamMulai, &s.JamSelesai, &s.Kuota)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *MySQL) findPraktek(kodePoli string, kodeDokter int, hariKerja, jamMulai string) (*models.Praktek, error) {
+	var p models.Praktek
+	err := m.DB.QueryRow(`
+		SELECT mp.kd_poli_rs, mp.nm_poli_bpjs, md.kd_dokter, md.nm_dokter_bpjs,
+			TIME_FORMAT(j.jam_mulai, '%H:%i'), j.kuota
+		FROM maping_poli_bpjs mp
+		JOIN jadwal j ON j.kd_poli = mp.kd_poli_rs
+		JOIN maping_dokter_dpjpvclaim md ON md.kd_dokter = j.kd_dokter
+		WHERE mp.kd_poli_bpjs = ?
+			AND md.kd_dokter_bpjs = ?
+			AND j.hari_kerja = ?
+			AND TIME_FORMAT(j.jam_mulai, '%H:%i') = ?
+		LIMIT 1
+	`, kodePoli, kodeDokter, hariKerja, jamMulai).Scan(
+		&p.KdPoli, &p.NmPoli, &p.KdDokter, &p.NmDokter, &p.JamMulai, &p.Kuota)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (m *MySQL) sepReferral(noRawat string) (*models.SEPReferral, error) {
+	var s models.SEPReferral
+	err := m.DB.QueryRow(`
+		SELECT COALESCE(no_rujukan, ''), COALESCE(asal_rujukan, ''), COALESCE(noskdp, '')
+		FROM bridging_sep
+		WHERE no_rawat = ?
+		LIMIT 1
+	`, noRawat).Scan(&s.NoRujukan, &s.AsalRujukan, &s.NoSKDP)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *MySQL) queueCount(q rowQueryer, kdPoli, kdDokter, tanggal string) (models.QueueCount, error) {
+	var c models.QueueCount
+	err := q.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(SUM(stts = 'Belum'), 0),
+			COALESCE(SUM(`+m.PayerFilter("kd_pj")+`), 0),
+			COALESCE(MAX(CASE WHEN stts != 'Belum' THEN CAST(no_reg AS UNSIGNED) END), 0)
+		FROM reg_periksa
+		WHERE kd_poli = ? AND kd_dokter = ? AND tgl_registrasi = ? AND stts != 'Batal'
+	`, kdPoli, kdDokter, tanggal).Scan(&c.Total, &c.Sisa, &c.JKN, &c.Dipanggil)
+	return c, err
+}
+
+func (m *MySQL) findPasien(norm, nomorKartu string) (*models.Pasien, error) {
+	var p models.Pasien
+	err := m.DB.QueryRow(`
+		SELECT no_rkm_medis, tgl_lahir, namakeluarga, alamatpj, keluarga
+		FROM pasien
+		WHERE (? != '' AND no_rkm_medis = ?) OR (? = '' AND no_peserta = ?)
+		LIMIT 1
+	`, norm, norm, norm, nomorKartu).Scan(&p.NoRkmMedis, &p.TglLahir, &p.NamaKeluarga, &p.AlamatPJ, &p.Keluarga)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// registerVisit inserts the reg_periksa row of a booking inside tx, after
+// checking the patient has no visit to the poli yet and the JKN quota has
+// room. The kodebooking is the no_rawat without slashes.
+func (m *MySQL) registerVisit(tx *sql.Tx, b models.NewBooking) (*models.BookedVisit, error) {
+	mulai, err := time.ParseInLocation("2006-01-02 15:04", b.TanggalPeriksa+" "+b.JamMulai, time.Local)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM reg_periksa
+		WHERE no_rkm_medis = ? AND tgl_registrasi = ? AND kd_poli = ? AND stts != 'Batal'
+	`, b.Pasien.NoRkmMedis, b.TanggalPeriksa, b.KdPoli).Scan(&existing)
+	if err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadyBooked
+	}
+
+	var maxReg, maxRawat int
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(CAST(no_reg AS UNSIGNED)), 0) FROM reg_periksa
+		WHERE kd_poli = ? AND kd_dokter = ? AND tgl_registrasi = ?
+		FOR UPDATE
+	`, b.KdPoli, b.KdDokter, b.TanggalPeriksa).Scan(&maxReg)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(CAST(RIGHT(no_rawat, 6) AS UNSIGNED)), 0) FROM reg_periksa
+		WHERE tgl_registrasi = ?
+		FOR UPDATE
+	`, b.TanggalPeriksa).Scan(&maxRawat)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := m.queueCount(tx, b.KdPoli, b.KdDokter, b.TanggalPeriksa)
+	if err != nil {
+		return nil, err
+	}
+	if count.JKN >= b.Kuota {
+		return nil, ErrQuotaFull
+	}
+
+	var biayaBaru, biayaLama float64
+	if err := tx.QueryRow(`SELECT registrasi, registrasilama FROM poliklinik WHERE kd_poli = ?`, b.KdPoli).Scan(&biayaBaru, &biayaLama); err != nil {
+		return nil, err
+	}
+	var visits, poliVisits int
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(kd_poli = ?), 0) FROM reg_periksa WHERE no_rkm_medis = ?
+	`, b.KdPoli, b.Pasien.NoRkmMedis).Scan(&visits, &poliVisits)
+	if err != nil {
+		return nil, err
+	}
+	sttsDaftar, biaya := "Baru", biayaBaru
+	if visits > 0 {
+		sttsDaftar, biaya = "Lama", biayaLama
+	}
+	statusPoli := "Baru"
+	if poliVisits > 0 {
+		statusPoli = "Lama"
+	}
+
+	noReg := maxReg + 1
+	noRawat := fmt.Sprintf("%s/%06d", strings.ReplaceAll(b.TanggalPeriksa, "-", "/"), maxRawat+1)
+
+	_, err = tx.Exec(`
+		INSERT INTO reg_periksa 
+		(no_reg, no_rawat, tgl_registrasi, jam_reg, kd_dokter, no_rkm_medis, kd_poli, p_jawab, almt_pj, hubunganpj,
+		 biaya_reg, stts, stts_daftar, status_lanjut, kd_pj, umurdaftar, sttsumur, status_bayar, status_poli)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'Belum', ?, 'Ralan', ?, ?, ?, 'Belum Bayar', ?)
+	`, fmt.Sprintf("%03d", noReg), noRawat, b.TanggalPeriksa, b.JamReg, b.KdDokter,
+		b.Pasien.NoRkmMedis, b.KdPoli, b.Pasien.NamaKeluarga, b.Pasien.AlamatPJ, b.Pasien.Keluarga,
+		biaya, sttsDaftar, b.KdPj, b.Umur, b.SttsUmur, statusPoli)
+	if err != nil {
+		return nil, err
+	}
+	return &models.BookedVisit{
+		NoRawat:     noRawat,
+		KodeBooking: strings.ReplaceAll(noRawat, "/", ""),
+		NoReg:       noReg,
+		Estimasi:    mulai.Add(time.Duration((noReg-1)*b.MinutesPerPatient) * time.Minute).UnixMilli(),
+		Count:       count,
+	}, nil
+}
+
+// findBooking reads the booking matching where from the booking table and
+// join in from, which must name the visit rp.
+func (m *MySQL) findBooking(from, nomorReferensi, where string, args ...interface{}) (*models.Booking, error) {
+	var b models.Booking
+	var noReg string
+	err := m.DB.QueryRow(`
+		SELECT `+nomorReferensi+`, rp.no_rawat, rp.no_rkm_medis, DATE_FORMAT(rp.tgl_registrasi, '%Y-%m-%d'),
+			rp.kd_poli, rp.kd_dokter, rp.no_reg, rp.stts,
+			COALESCE(mp.kd_poli_bpjs, rp.kd_poli), COALESCE(mp.nm_poli_bpjs, ''), COALESCE(md.nm_dokter_bpjs, '')
+		FROM `+from+`
+		LEFT JOIN maping_poli_bpjs mp ON mp.kd_poli_rs = rp.kd_poli
+		LEFT JOIN maping_dokter_dpjpvclaim md ON md.kd_dokter = rp.kd_dokter
+		WHERE `+where+`
+		LIMIT 1
+	`, args...).Scan(&b.NomorReferensi, &b.NoRawat, &b.NoRkmMedis, &b.Tanggal, &b.KdPoli, &b.KdDokter, &noReg, &b.Stts,
+		&b.KodePoli, &b.NmPoli, &b.NmDokter)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.NoReg, _ = strconv.Atoi(noReg)
+	return &b, nil
+}
+
+func (m *MySQL) queueAhead(kdPoli, kdDokter, date string, noReg int) (int, error) {
+	var n int
+	err := m.DB.QueryRow(`
+		SELECT COUNT(*) FROM reg_periksa
+		WHERE kd_poli = ? AND kd_dokter = ? AND tgl_registrasi = ? 
+			AND stts = 'Belum' AND CAST(no_reg AS UNSIGNED) < ?
+	`, kdPoli, kdDokter, date, noReg).Scan(&n)
+	return n, err
+}
+
+// cancelVisit marks the visit Batal inside tx unless the patient has been
+// served in the meantime.
+func cancelVisit(tx *sql.Tx, noRawat string) error {
+	res, err := tx.Exec(`
+		UPDATE reg_periksa SET stts = 'Batal' 
+		WHERE no_rawat = ? AND stts = 'Belum'
+	`, noRawat)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAlreadyServed
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import "gotrol/internal/models"
+
+// SaveCancellation records a cancelled booking once; later calls for the
+// same nomor_referensi are ignored.
+func (m *MySQL) SaveCancellation(c models.Cancellation) error {
+	_, err := m.DB.Exec(`
+		INSERT IGNORE INTO gotrol_cancellation 
+		(nomor_referensi, kodebooking, tanggal_periksa, source, alasan, task99, bpjs_code, category, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.NomorReferensi, c.KodeBooking, c.TanggalPeriksa, c.Source, truncate(c.Alasan, 255),
+		c.Task99, c.BPJSCode, c.Category, truncate(c.Message, 255))
+	return err
+}
+
+func (m *MySQL) GetCancellations(date string) ([]models.Cancellation, error) {
+	rows, err := m.DB.Query(`
+		SELECT nomor_referensi, kodebooking, DATE_FORMAT(tanggal_periksa, '%Y-%m-%d'), source, alasan, 
+			task99, bpjs_code, category, message, cancelled_at
+		FROM gotrol_cancellation
+		WHERE tanggal_periksa = ?
+		ORDER BY cancelled_at
+	`, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cancels := []models.Cancellation{}
+	for rows.Next() {
+		var c models.Cancellation
+		if err := rows.Scan(&c.NomorReferensi, &c.KodeBooking, &c.TanggalPeriksa, &c.Source, &c.Alasan,
+			&c.Task99, &c.BPJSCode, &c.Category, &c.Message, &c.CancelledAt); err != nil {
+			return nil, err
+		}
+		cancels = append(cancels, c)
+	}
+	return cancels, rows.Err()
+}
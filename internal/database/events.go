@@ -0,0 +1,67 @@
+package database
+
+import (
+	"database/sql"
+
+	"gotrol/internal/models"
+)
+
+// SaveTaskEvent stores an event unless one was already recorded for the
+// same booking and task; the first report of an event is the real one.
+func (m *MySQL) SaveTaskEvent(e models.TaskEvent) (bool, error) {
+	res, err := m.DB.Exec(`
+		INSERT IGNORE INTO gotrol_task_events 
+		(kodebooking, nomor_referensi, taskid, waktu, client)
+		VALUES (?, ?, ?, ?, ?)
+	`, e.KodeBooking, e.NomorReferensi, e.TaskID, e.Waktu, e.Client)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (m *MySQL) GetTaskEvents(kodeBooking string) ([]models.TaskEvent, error) {
+	rows, err := m.DB.Query(`
+		SELECT id, kodebooking, nomor_referensi, taskid, waktu, client, received_at
+		FROM gotrol_task_events
+		WHERE kodebooking = ?
+		ORDER BY taskid
+	`, kodeBooking)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.TaskEvent{}
+	for rows.Next() {
+		var e models.TaskEvent
+		if err := rows.Scan(&e.ID, &e.KodeBooking, &e.NomorReferensi, &e.TaskID, &e.Waktu, &e.Client, &e.ReceivedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// CheckinTime is the Mobile JKN checkin of a booking, 0 when there is none.
+func (m *MySQL) CheckinTime(kodeBooking string) (int64, error) {
+	var waktu int64
+	err := m.DB.QueryRow(`
+		SELECT waktu FROM gotrol_checkin WHERE kodebooking = ?
+	`, kodeBooking).Scan(&waktu)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return waktu, err
+}
+
+// SaveCheckin keeps the first Mobile JKN checkin time of a booking.
+func (m *MySQL) SaveCheckin(kodeBooking, nomorReferensi string, waktu int64) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO gotrol_checkin (kodebooking, nomor_referensi, waktu)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE waktu = waktu
+	`, kodeBooking, nomorReferensi, waktu)
+	return err
+}
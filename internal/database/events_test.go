@@ -0,0 +1,48 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetTaskEvents(t *testing.T) {
+	columns := []string{"id", "kodebooking", "nomor_referensi", "taskid", "waktu", "client", "received_at"}
+	now := time.Now()
+
+	t.Run("rows", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_task_events").WithArgs("KB1").WillReturnRows(
+			sqlmock.NewRows(columns).
+				AddRow(1, "KB1", "REF1", 4, int64(1766885400000), "poli", now).
+				AddRow(2, "KB1", "REF1", 5, int64(1766886000000), "poli", now))
+		events, err := m.GetTaskEvents("KB1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[1].TaskID != 5 {
+			t.Errorf("events = %+v", events)
+		}
+	})
+
+	t.Run("unscannable event", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_task_events").WithArgs("KB1").WillReturnRows(
+			sqlmock.NewRows(columns).AddRow(1, "KB1", "REF1", "four", int64(1766885400000), "poli", now))
+		if events, err := m.GetTaskEvents("KB1"); err == nil {
+			t.Errorf("events = %+v, want an error", events)
+		}
+	})
+
+	t.Run("broken result set", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_task_events").WithArgs("KB1").WillReturnRows(
+			sqlmock.NewRows(columns).AddRow(1, "KB1", "REF1", 4, int64(1766885400000), "poli", now).
+				RowError(0, errors.New("connection reset")))
+		if events, err := m.GetTaskEvents("KB1"); err == nil {
+			t.Errorf("events = %+v, want an error", events)
+		}
+	})
+}
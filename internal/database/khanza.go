@@ -0,0 +1,388 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/models"
+)
+
+const khanzaTaskTable = "gotrol_taskid"
+
+// khanzaRepository reads bookings from SIMRS Khanza's referensi_mobilejkn_bpjs.
+// Khanza's referensi_mobilejkn_bpjs_taskid only holds tasks BPJS accepted,
+// so planned tasks live in gotrol_taskid and are copied over once sent; a
+// task Khanza sent itself counts as Sudah.
+type khanzaRepository struct {
+	db      *MySQL
+	sources taskSources
+}
+
+// Credentials is empty: Khanza keeps the bridging keys in setting.properties
+// on each desktop, so they come from config.yaml.
+func (r *khanzaRepository) Credentials() (*config.BPJSCredentials, error) {
+	return &config.BPJSCredentials{}, nil
+}
+
+// entryQuery selects the entries matching where, which may refer to b and
+// rp. A booking cancelled from Mobile JKN gets the keterangan mLITE writes
+// for one.
+func (r *khanzaRepository) entryQuery(where string) string {
+	return `
+		SELECT
+			b.tanggalperiksa,
+			b.norm,
+			b.nomorkartu,
+			b.nomorreferensi,
+			b.nobooking,
+			COALESCE(b.jeniskunjungan, '') as jenis_kunjungan,
+			b.statuskirim,
+			IF(b.status = 'Batal', 'Batal Mobile JKN', '') as keterangan,
+			COALESCE(p.nm_pasien, '') as nm_pasien,
+			b.no_rawat,
+			COALESCE(pj.png_jawab, '') as png_jawab,
+			COALESCE(rp.kd_poli, '') as kd_poli,
+			COALESCE(pol.nm_poli, '') as nm_poli
+		FROM referensi_mobilejkn_bpjs b
+		JOIN reg_periksa rp ON rp.no_rawat = b.no_rawat
+		LEFT JOIN pasien p ON rp.no_rkm_medis = p.no_rkm_medis
+		LEFT JOIN penjab pj ON rp.kd_pj = pj.kd_pj
+		LEFT JOIN poliklinik pol ON rp.kd_poli = pol.kd_poli
+		WHERE b.nobooking != ''
+			AND ` + r.db.PayerFilter("rp.kd_pj") + `
+			AND ` + where + `
+		ORDER BY rp.jam_reg ASC
+	`
+}
+
+func (r *khanzaRepository) BookedEntries(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`b.tanggalperiksa = ?
+			AND rp.stts != 'Batal'`), date)
+}
+
+func (r *khanzaRepository) PendingEntries(date string, lastTask int) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`b.tanggalperiksa = ?
+			AND b.statuskirim = 'Sudah'
+			AND rp.stts != 'Batal'
+			AND (SELECT COUNT(*) FROM referensi_mobilejkn_bpjs_taskid k
+				 WHERE k.no_rawat = b.no_rawat
+				   AND k.taskid BETWEEN 1 AND ?) < ?`), date, lastTask, lastTask)
+}
+
+func (r *khanzaRepository) IncompleteEntries(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`b.tanggalperiksa = ?
+			AND rp.stts != 'Batal'
+			AND (SELECT COUNT(*) FROM referensi_mobilejkn_bpjs_taskid k
+				 WHERE k.no_rawat = b.no_rawat
+				   AND k.taskid BETWEEN 1 AND 7) < 7`), date)
+}
+
+func (r *khanzaRepository) EntriesWithTasks(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`b.tanggalperiksa = ?
+			AND rp.stts != 'Batal'
+			AND (
+				EXISTS (SELECT 1 FROM gotrol_taskid t WHERE t.nomor_referensi = b.nomorreferensi)
+				OR EXISTS (SELECT 1 FROM referensi_mobilejkn_bpjs_taskid k WHERE k.no_rawat = b.no_rawat)
+			)`), date)
+}
+
+// EntriesWithUnsentTask compares taskid as a string, since Khanza declares
+// it as an ENUM.
+func (r *khanzaRepository) EntriesWithUnsentTask(date string, taskID int) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`b.tanggalperiksa = ?
+			AND rp.stts != 'Batal'
+			AND EXISTS (
+				SELECT 1 FROM gotrol_taskid t
+				WHERE t.nomor_referensi = b.nomorreferensi
+				AND t.taskid = ?
+				AND t.status != 'Sudah'
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM referensi_mobilejkn_bpjs_taskid k
+				WHERE k.no_rawat = b.no_rawat AND k.taskid = ?
+			)`), date, taskID, strconv.Itoa(taskID))
+}
+
+func (r *khanzaRepository) CancelledEntries(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`b.tanggalperiksa = ?
+			AND b.statuskirim = 'Sudah'
+			AND rp.stts = 'Batal'
+			AND NOT EXISTS (
+				SELECT 1 FROM gotrol_cancellation c
+				WHERE c.nomor_referensi = b.nomorreferensi
+			)`), date)
+}
+
+func (r *khanzaRepository) EntryByNomorReferensi(nomorReferensi string) (*models.AntrianReferensi, error) {
+	return r.db.queryEntry(r.entryQuery(`b.nomorreferensi = ?
+			AND rp.stts != 'Batal'`), nomorReferensi)
+}
+
+func (r *khanzaRepository) EntryByKodeBooking(kodeBooking string) (*models.AntrianReferensi, error) {
+	return r.db.queryEntry(r.entryQuery(`b.nobooking = ?
+			AND rp.stts != 'Batal'`), kodeBooking)
+}
+
+func (r *khanzaRepository) NomorReferensi(kodeBooking string) (string, error) {
+	var nr string
+	err := r.db.DB.QueryRow(`
+		SELECT nomorreferensi FROM referensi_mobilejkn_bpjs WHERE nobooking = ? LIMIT 1
+	`, kodeBooking).Scan(&nr)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return nr, err
+}
+
+// SourceTimes has no loket times by default; Khanza's counter does not
+// record them.
+func (r *khanzaRepository) SourceTimes(entry models.AntrianReferensi) (SourceTimes, error) {
+	return r.db.sourceTimes(r.sources.forPoli(entry.KdPoli), entry)
+}
+
+// TaskIDs overlays the tasks in referensi_mobilejkn_bpjs_taskid, as Sudah
+// with Khanza's time, on the ones GoTrol planned.
+func (r *khanzaRepository) TaskIDs(nomorReferensi string) ([]models.TaskID, error) {
+	tasks, err := r.db.taskIDs(khanzaTaskTable, nomorReferensi)
+	if err != nil && !isMissingTable(err) {
+		return nil, err
+	}
+
+	rows, err := r.db.DB.Query(`
+		SELECT b.tanggalperiksa, k.taskid, k.waktu
+		FROM referensi_mobilejkn_bpjs_taskid k
+		JOIN referensi_mobilejkn_bpjs b ON b.no_rawat = k.no_rawat
+		WHERE b.nomorreferensi = ?
+	`, nomorReferensi)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tanggal, taskID string
+		var waktu time.Time
+		if err := rows.Scan(&tanggal, &taskID, &waktu); err != nil {
+			return nil, err
+		}
+		id, err := strconv.Atoi(taskID)
+		if err != nil {
+			continue
+		}
+		sent := models.TaskID{
+			TanggalPeriksa: tanggal,
+			NomorReferensi: nomorReferensi,
+			TaskID:         id,
+			Waktu:          waktu.UnixMilli(),
+			Status:         "Sudah",
+			Keterangan:     "referensi_mobilejkn_bpjs_taskid",
+		}
+		found := false
+		for i := range tasks {
+			if tasks[i].TaskID == id {
+				tasks[i].Waktu, tasks[i].Status = sent.Waktu, sent.Status
+				found = true
+			}
+		}
+		if !found {
+			tasks = append(tasks, sent)
+		}
+	}
+	return tasks, rows.Err()
+}
+
+func (r *khanzaRepository) UpsertTaskIDs(tanggal, nomorReferensi string, rows []TaskRow, source string) error {
+	return r.db.upsertTaskIDs(khanzaTaskTable, tanggal, nomorReferensi, rows, source)
+}
+
+func (r *khanzaRepository) UpdateTaskWaktu(nomorReferensi string, taskID int, waktuMs int64, source, reason string) error {
+	return r.db.updateTaskWaktu(khanzaTaskTable, nomorReferensi, taskID, waktuMs, source, reason)
+}
+
+func (r *khanzaRepository) SetTaskStatus(nomorReferensi string, taskID int, status string) error {
+	if err := r.db.setTaskStatus(khanzaTaskTable, nomorReferensi, taskID, status); err != nil {
+		return err
+	}
+	if status != "Sudah" {
+		return nil
+	}
+	return r.copySent(nomorReferensi, taskID)
+}
+
+func (r *khanzaRepository) AcceptTask(tanggal, nomorReferensi string, taskID int, waktuMs int64, keterangan string) error {
+	if err := r.db.acceptTask(khanzaTaskTable, tanggal, nomorReferensi, taskID, waktuMs, keterangan); err != nil {
+		return err
+	}
+	return r.copySent(nomorReferensi, taskID)
+}
+
+// copySent writes a task BPJS accepted to referensi_mobilejkn_bpjs_taskid,
+// where Khanza's own screens look for it.
+func (r *khanzaRepository) copySent(nomorReferensi string, taskID int) error {
+	_, err := r.db.DB.Exec(`
+		INSERT INTO referensi_mobilejkn_bpjs_taskid (no_rawat, taskid, waktu)
+		SELECT b.no_rawat, CAST(t.taskid AS CHAR), FROM_UNIXTIME(t.waktu / 1000)
+		FROM gotrol_taskid t
+		JOIN referensi_mobilejkn_bpjs b ON b.nomorreferensi = t.nomor_referensi
+		WHERE t.nomor_referensi = ? AND t.taskid = ? AND t.status = 'Sudah'
+		ON DUPLICATE KEY UPDATE waktu = VALUES(waktu)
+	`, nomorReferensi, taskID)
+	return err
+}
+
+func (r *khanzaRepository) CountBookings(startDate, endDate, status string) (int, error) {
+	var count int
+	err := r.db.DB.QueryRow(`
+		SELECT COUNT(DISTINCT b.nomorreferensi)
+		FROM referensi_mobilejkn_bpjs b
+		JOIN reg_periksa rp ON rp.no_rawat = b.no_rawat
+		WHERE b.tanggalperiksa BETWEEN ? AND ?
+			AND b.nobooking != ''
+			AND `+r.db.PayerFilter("rp.kd_pj")+statusKirimFilter("b.statuskirim", status)+`
+	`, startDate, endDate).Scan(&count)
+	return count, err
+}
+
+func (r *khanzaRepository) CountTaskSent(date string, taskID int) (int, error) {
+	var count int
+	err := r.db.DB.QueryRow(`
+		SELECT COUNT(DISTINCT k.no_rawat)
+		FROM referensi_mobilejkn_bpjs_taskid k
+		JOIN referensi_mobilejkn_bpjs b ON b.no_rawat = k.no_rawat
+		WHERE b.tanggalperiksa = ?
+			AND k.taskid = ?
+	`, date, strconv.Itoa(taskID)).Scan(&count)
+	return count, err
+}
+
+func (r *khanzaRepository) Registrations(date, search string, limit, offset int) ([]models.Registration, int, error) {
+	return r.db.registrations(bookingJoin{
+		join:           `LEFT JOIN referensi_mobilejkn_bpjs b ON b.no_rawat = reg_periksa.no_rawat`,
+		nomorReferensi: "b.nomorreferensi",
+		kodeBooking:    "b.nobooking",
+		statusKirim:    "b.statuskirim",
+		tasks:          r.TaskIDs,
+	}, date, search, limit, offset)
+}
+
+// WalkIns is unsupported: a Khanza booking in referensi_mobilejkn_bpjs needs
+// the Mobile JKN answer fields GoTrol does not have for a walk-in.
+func (r *khanzaRepository) WalkIns(string) ([]models.WalkIn, error) {
+	return nil, fmt.Errorf("walk-in registration: %w", ErrUnsupported)
+}
+
+func (r *khanzaRepository) RejectWalkIn(string, string, string, string) error {
+	return fmt.Errorf("walk-in registration: %w", ErrUnsupported)
+}
+
+func (r *khanzaRepository) NearestSession(kdPoli, kdDokter, hariKerja, jamReg string) (*models.DoctorSession, error) {
+	return r.db.nearestSession(kdPoli, kdDokter, hariKerja, jamReg)
+}
+
+func (r *khanzaRepository) SEPReferral(noRawat string) (*models.SEPReferral, error) {
+	return r.db.sepReferral(noRawat)
+}
+
+func (r *khanzaRepository) QueueCount(kdPoli, kdDokter, date string) (models.QueueCount, error) {
+	return r.db.queueCount(r.db.DB, kdPoli, kdDokter, date)
+}
+
+func (r *khanzaRepository) FindPraktek(kodePoli string, kodeDokter int, hariKerja, jamMulai string) (*models.Praktek, error) {
+	return r.db.findPraktek(kodePoli, kodeDokter, hariKerja, jamMulai)
+}
+
+func (r *khanzaRepository) FindPasien(norm, nomorKartu string) (*models.Pasien, error) {
+	return r.db.findPasien(norm, nomorKartu)
+}
+
+func (r *khanzaRepository) AddBooking(models.AntrianReferensi) error {
+	return fmt.Errorf("adding a booking: %w", ErrUnsupported)
+}
+
+// RegisterBooking fills referensi_mobilejkn_bpjs with the answer Mobile JKN
+// gets, as Khanza's own WS does.
+func (r *khanzaRepository) RegisterBooking(b models.NewBooking) (*models.BookedVisit, error) {
+	tx, err := r.db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	v, err := r.db.registerVisit(tx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	nomorReferensi := b.NomorReferensi
+	if nomorReferensi == "" {
+		nomorReferensi = v.KodeBooking
+	}
+	_, err = tx.Exec(`
+		INSERT INTO referensi_mobilejkn_bpjs 
+		(nobooking, no_rawat, nomorkartu, nik, nohp, kodepoli, pasienbaru, norm, tanggalperiksa, kodedokter,
+		 jampraktek, jeniskunjungan, nomorreferensi, nomorantrean, angkaantrean, estimasidilayani,
+		 sisakuotajkn, kuotajkn, sisakuotanonjkn, kuotanonjkn, status, statuskirim)
+		VALUES (?, ?, ?, ?, ?, ?, '0', ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'Belum', 'Sudah')
+	`, v.KodeBooking, v.NoRawat, b.NomorKartu, b.NIK, b.NoHP, b.KodePoli, b.Pasien.NoRkmMedis, b.TanggalPeriksa, b.KodeDokter,
+		b.JamPraktek, strconv.Itoa(b.JenisKunjungan), nomorReferensi, fmt.Sprintf("%s-%03d", b.KodePoli, v.NoReg), v.NoReg, v.Estimasi,
+		b.Kuota-v.Count.JKN-1, b.Kuota, b.Kuota-(v.Count.Total-v.Count.JKN), b.Kuota)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (r *khanzaRepository) FindBooking(kodeBooking string) (*models.Booking, error) {
+	return r.db.findBooking(`referensi_mobilejkn_bpjs b
+		JOIN reg_periksa rp ON rp.no_rawat = b.no_rawat`,
+		"b.nomorreferensi", "b.nobooking = ?", kodeBooking)
+}
+
+func (r *khanzaRepository) QueueAhead(kdPoli, kdDokter, date string, noReg int) (int, error) {
+	return r.db.queueAhead(kdPoli, kdDokter, date, noReg)
+}
+
+// CancelBooking marks the booking Batal and adds the
+// referensi_mobilejkn_bpjs_batal row Khanza's screens list; BPJS already
+// knows, so it is not sent again.
+func (r *khanzaRepository) CancelBooking(b models.Booking, kodeBooking, keterangan string) error {
+	tx, err := r.db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := cancelVisit(tx, b.NoRawat); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE referensi_mobilejkn_bpjs SET status = 'Batal' WHERE nobooking = ?`, kodeBooking); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO referensi_mobilejkn_bpjs_batal 
+		(no_rkm_medis, no_rawat_batal, nomorreferensi, tanggalbatal, keterangan, statuskirim, nobooking)
+		VALUES (?, ?, ?, NOW(), ?, 'Sudah', ?)
+	`, b.NoRkmMedis, b.NoRawat, b.NomorReferensi, truncate(keterangan, 250), kodeBooking)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *khanzaRepository) RegisterPasien(p models.NewPasien) (string, error) {
+	return r.db.registerPasien(p)
+}
+
+func (r *khanzaRepository) JadwalOperasi(tanggalAwal, tanggalAkhir string) ([]models.JadwalOperasi, error) {
+	return r.db.jadwalOperasiRange(tanggalAwal, tanggalAkhir)
+}
+
+func (r *khanzaRepository) JadwalOperasiPasien(noPeserta string) ([]models.JadwalOperasi, error) {
+	return r.db.jadwalOperasiPasien(noPeserta)
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"gotrol/internal/config"
+	"gotrol/internal/models"
+)
+
+func TestKhanzaTaskSources(t *testing.T) {
+	loket := config.TaskSource{Table: "antrian_loket", Key: "no_rkm_medis", Date: "tanggal", Time: "jam_panggil"}
+	triase := config.TaskSource{Table: "data_triase_igd", Time: "tgl_kunjungan"}
+	s := newTaskSources(sharedSources, config.TasksConfig{
+		Sources:     map[int][]config.TaskSource{1: {loket}},
+		PoliSources: map[string]map[int][]config.TaskSource{"IGDK": {5: {triase}}},
+	})
+
+	tests := []struct {
+		poli string
+		task int
+		want string
+	}{
+		{"U0001", 1, "antrian_loket.jam_panggil"},
+		{"U0001", 2, ""},
+		{"U0001", 3, "mutasi_berkas.dikirim"},
+		{"U0001", 4, "mutasi_berkas.diterima"},
+		{"U0001", 5, "pemeriksaan_ralan.jam_rawat"},
+		{"U0001", 6, "resep_obat.jam_peresepan"},
+		{"U0001", 7, "resep_obat.jam"},
+		{"IGDK", 1, "antrian_loket.jam_panggil"},
+		{"IGDK", 5, "data_triase_igd.tgl_kunjungan"},
+		{"IGDK", 6, "resep_obat.jam_peresepan"},
+	}
+	for _, tt := range tests {
+		got := ""
+		if sources := s.forPoli(tt.poli)[tt.task-1]; len(sources) > 0 {
+			got = sources[0].String()
+		}
+		if got != tt.want {
+			t.Errorf("poli %s task %d = %q, want %q", tt.poli, tt.task, got, tt.want)
+		}
+	}
+}
+
+func TestKhanzaSourceTimes(t *testing.T) {
+	m, mock := newMock(t)
+	r := &khanzaRepository{db: m, sources: newTaskSources(sharedSources, config.TasksConfig{})}
+	entry := models.AntrianReferensi{NoRawat: "2025/12/28/000001", KodeBooking: "KB1", KdPoli: "U0001", TanggalPeriksa: "2025-12-28"}
+	source := []string{"date", "time", "id"}
+
+	mock.ExpectQuery("FROM reg_periksa").WithArgs(entry.NoRawat).WillReturnRows(
+		sqlmock.NewRows([]string{"tgl_registrasi", "jam_reg"}).AddRow("2025-12-28", "08:00:00"))
+	mock.ExpectQuery("`dikirim`, NULL FROM `mutasi_berkas`").WithArgs(entry.NoRawat).WillReturnRows(
+		sqlmock.NewRows(source).AddRow(nil, "2025-12-28 08:20:00", nil))
+	mock.ExpectQuery("`diterima`, NULL FROM `mutasi_berkas`").WithArgs(entry.NoRawat).WillReturnRows(
+		sqlmock.NewRows(source))
+	mock.ExpectQuery("FROM `pemeriksaan_ralan`").WithArgs(entry.NoRawat).WillReturnRows(
+		sqlmock.NewRows(source).AddRow("2025-12-28", "08:45:00", nil))
+	mock.ExpectQuery("`jam_peresepan`, `no_resep` FROM `resep_obat`").WithArgs(entry.NoRawat).WillReturnRows(
+		sqlmock.NewRows(source))
+	mock.ExpectQuery("`jam`, `no_resep` FROM `resep_obat`").WithArgs(entry.NoRawat).WillReturnRows(
+		sqlmock.NewRows(source))
+	mock.ExpectQuery("FROM gotrol_checkin").WithArgs("KB1").WillReturnRows(
+		sqlmock.NewRows([]string{"waktu"}))
+	mock.ExpectQuery("FROM gotrol_task_events").WithArgs("KB1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "kodebooking", "nomor_referensi", "taskid", "waktu", "client", "received_at"}))
+
+	st, err := r.SourceTimes(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	format := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("15:04:05")
+	}
+	if got := format(st.Registered); got != "08:00:00" {
+		t.Errorf("registered = %q", got)
+	}
+	want := [7]struct{ time, source, expected string }{
+		{},
+		{},
+		{"08:20:00", "mutasi_berkas.dikirim", "mutasi_berkas.dikirim"},
+		{"", "", "mutasi_berkas.diterima"},
+		{"08:45:00", "pemeriksaan_ralan.jam_rawat", "pemeriksaan_ralan.jam_rawat"},
+		{"", "", "resep_obat.jam_peresepan"},
+		{"", "", "resep_obat.jam"},
+	}
+	for i, w := range want {
+		if got := format(st.Tasks[i]); got != w.time || st.Sources[i] != w.source || st.Expected[i] != w.expected {
+			t.Errorf("task %d = %q from %q (expected %q), want %q from %q (expected %q)",
+				i+1, got, st.Sources[i], st.Expected[i], w.time, w.source, w.expected)
+		}
+	}
+}
+
+func TestKhanzaTaskIDs(t *testing.T) {
+	m, mock := newMock(t)
+	r := &khanzaRepository{db: m}
+	planned := time.Date(2025, 12, 28, 8, 20, 0, 0, time.Local)
+	sent := time.Date(2025, 12, 28, 8, 25, 0, 0, time.Local)
+
+	mock.ExpectQuery("FROM gotrol_taskid").WithArgs("REF1").WillReturnRows(
+		sqlmock.NewRows([]string{"tanggal_periksa", "nomor_referensi", "taskid", "waktu", "status", "keterangan"}).
+			AddRow("2025-12-28", "REF1", 3, planned.UnixMilli(), "Belum", "").
+			AddRow("2025-12-28", "REF1", 4, planned.Add(10*time.Minute).UnixMilli(), "Belum", ""))
+	mock.ExpectQuery("FROM referensi_mobilejkn_bpjs_taskid").WithArgs("REF1").WillReturnRows(
+		sqlmock.NewRows([]string{"tanggalperiksa", "taskid", "waktu"}).
+			AddRow("2025-12-28", "3", sent).
+			AddRow("2025-12-28", "99", sent).
+			AddRow("2025-12-28", "", sent))
+
+	tasks, err := r.TaskIDs("REF1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.TaskID{
+		{TaskID: 3, Waktu: sent.UnixMilli(), Status: "Sudah"},
+		{TaskID: 4, Waktu: planned.Add(10 * time.Minute).UnixMilli(), Status: "Belum"},
+		{TaskID: 99, Waktu: sent.UnixMilli(), Status: "Sudah", Keterangan: "referensi_mobilejkn_bpjs_taskid"},
+	}
+	if len(tasks) != len(want) {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	for i, w := range want {
+		got := tasks[i]
+		if got.TaskID != w.TaskID || got.Waktu != w.Waktu || got.Status != w.Status || got.Keterangan != w.Keterangan {
+			t.Errorf("task %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+
+	"gotrol/internal/config"
+	"gotrol/internal/models"
+)
+
+const mliteTaskTable = "mlite_antrian_referensi_taskid"
+
+// mliteRepository reads bookings from mlite_antrian_referensi and keeps tasks
+// in mlite_antrian_referensi_taskid, as the mLITE JKN Mobile module does.
+type mliteRepository struct {
+	db      *MySQL
+	sources taskSources
+}
+
+// mliteSources adds the loket call times of mlite_antrian_loket as Task 1
+// and 2 to the shared sources.
+var mliteSources = map[int][]config.TaskSource{
+	1: {{Table: "mlite_antrian_loket", Key: "no_rkm_medis", Date: "postdate", Time: "start_time"}},
+	2: {{Table: "mlite_antrian_loket", Key: "no_rkm_medis", Date: "postdate", Time: "end_time"}},
+	3: sharedSources[3],
+	4: sharedSources[4],
+	5: sharedSources[5],
+	6: sharedSources[6],
+	7: sharedSources[7],
+}
+
+func (r *mliteRepository) Credentials() (*config.BPJSCredentials, error) {
+	return r.db.GetBPJSCredentials()
+}
+
+// entryQuery selects the entries matching where, which may refer to mar and
+// rp.
+func (r *mliteRepository) entryQuery(where string) string {
+	return `
+		SELECT
+			mar.tanggal_periksa,
+			mar.no_rkm_medis,
+			mar.nomor_kartu,
+			mar.nomor_referensi,
+			mar.kodebooking,
+			COALESCE(mar.jenis_kunjungan, '') as jenis_kunjungan,
+			mar.status_kirim,
+			COALESCE(mar.keterangan, '') as keterangan,
+			COALESCE(p.nm_pasien, '') as nm_pasien,
+			COALESCE(rp.no_rawat, '') as no_rawat,
+			COALESCE(pj.png_jawab, '') as png_jawab,
+			COALESCE(rp.kd_poli, '') as kd_poli,
+			COALESCE(pol.nm_poli, '') as nm_poli
+		FROM mlite_antrian_referensi mar
+		LEFT JOIN reg_periksa rp ON mar.no_rkm_medis = rp.no_rkm_medis
+			AND mar.tanggal_periksa = rp.tgl_registrasi
+		LEFT JOIN pasien p ON mar.no_rkm_medis = p.no_rkm_medis
+		LEFT JOIN penjab pj ON rp.kd_pj = pj.kd_pj
+		LEFT JOIN poliklinik pol ON rp.kd_poli = pol.kd_poli
+		WHERE mar.kodebooking != ''
+			AND ` + r.db.PayerFilter("rp.kd_pj") + `
+			AND ` + where + `
+		ORDER BY rp.jam_reg ASC
+	`
+}
+
+func (r *mliteRepository) BookedEntries(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`mar.tanggal_periksa = ?
+			AND rp.stts != 'Batal'`), date)
+}
+
+func (r *mliteRepository) PendingEntries(date string, lastTask int) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`mar.tanggal_periksa = ?
+			AND mar.status_kirim = 'Sudah'
+			AND rp.stts != 'Batal'
+			AND (
+				-- No task records yet
+				NOT EXISTS (
+					SELECT 1 FROM mlite_antrian_referensi_taskid t
+					WHERE t.nomor_referensi = mar.nomor_referensi
+				)
+				OR
+				-- Has incomplete tasks (1..lastTask not all Sudah)
+				(SELECT COUNT(*) FROM mlite_antrian_referensi_taskid t
+				 WHERE t.nomor_referensi = mar.nomor_referensi
+				   AND t.taskid BETWEEN 1 AND ?
+				   AND t.status = 'Sudah') < ?
+			)`), date, lastTask, lastTask)
+}
+
+func (r *mliteRepository) IncompleteEntries(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`mar.tanggal_periksa = ?
+			AND rp.stts != 'Batal'
+			AND (SELECT COUNT(*) FROM mlite_antrian_referensi_taskid t
+				 WHERE t.nomor_referensi = mar.nomor_referensi
+				   AND t.taskid BETWEEN 1 AND 7
+				   AND t.status = 'Sudah') < 7`), date)
+}
+
+func (r *mliteRepository) EntriesWithTasks(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`mar.tanggal_periksa = ?
+			AND rp.stts != 'Batal'
+			AND EXISTS (SELECT 1 FROM mlite_antrian_referensi_taskid t WHERE t.nomor_referensi = mar.nomor_referensi)`), date)
+}
+
+func (r *mliteRepository) EntriesWithUnsentTask(date string, taskID int) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`mar.tanggal_periksa = ?
+			AND rp.stts != 'Batal'
+			AND EXISTS (
+				SELECT 1 FROM mlite_antrian_referensi_taskid t
+				WHERE t.nomor_referensi = mar.nomor_referensi
+				AND t.taskid = ?
+				AND t.status != 'Sudah'
+			)`), date, taskID)
+}
+
+func (r *mliteRepository) CancelledEntries(date string) ([]models.AntrianReferensi, error) {
+	return r.db.queryEntries(r.entryQuery(`mar.tanggal_periksa = ?
+			AND mar.status_kirim = 'Sudah'
+			AND rp.stts = 'Batal'
+			AND NOT EXISTS (
+				SELECT 1 FROM gotrol_cancellation c
+				WHERE c.nomor_referensi = mar.nomor_referensi
+			)`), date)
+}
+
+func (r *mliteRepository) EntryByNomorReferensi(nomorReferensi string) (*models.AntrianReferensi, error) {
+	return r.db.queryEntry(r.entryQuery(`mar.nomor_referensi = ?
+			AND rp.stts != 'Batal'`), nomorReferensi)
+}
+
+func (r *mliteRepository) EntryByKodeBooking(kodeBooking string) (*models.AntrianReferensi, error) {
+	return r.db.queryEntry(r.entryQuery(`mar.kodebooking = ?
+			AND rp.stts != 'Batal'`), kodeBooking)
+}
+
+func (r *mliteRepository) NomorReferensi(kodeBooking string) (string, error) {
+	var nr string
+	err := r.db.DB.QueryRow(`
+		SELECT nomor_referensi FROM mlite_antrian_referensi WHERE kodebooking = ? LIMIT 1
+	`, kodeBooking).Scan(&nr)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return nr, err
+}
+
+func (r *mliteRepository) SourceTimes(entry models.AntrianReferensi) (SourceTimes, error) {
+	return r.db.sourceTimes(r.sources.forPoli(entry.KdPoli), entry)
+}
+
+func (r *mliteRepository) TaskIDs(nomorReferensi string) ([]models.TaskID, error) {
+	return r.db.taskIDs(mliteTaskTable, nomorReferensi)
+}
+
+func (r *mliteRepository) UpsertTaskIDs(tanggal, nomorReferensi string, rows []TaskRow, source string) error {
+	return r.db.upsertTaskIDs(mliteTaskTable, tanggal, nomorReferensi, rows, source)
+}
+
+func (r *mliteRepository) UpdateTaskWaktu(nomorReferensi string, taskID int, waktuMs int64, source, reason string) error {
+	return r.db.updateTaskWaktu(mliteTaskTable, nomorReferensi, taskID, waktuMs, source, reason)
+}
+
+func (r *mliteRepository) SetTaskStatus(nomorReferensi string, taskID int, status string) error {
+	return r.db.setTaskStatus(mliteTaskTable, nomorReferensi, taskID, status)
+}
+
+func (r *mliteRepository) AcceptTask(tanggal, nomorReferensi string, taskID int, waktuMs int64, keterangan string) error {
+	return r.db.acceptTask(mliteTaskTable, tanggal, nomorReferensi, taskID, waktuMs, keterangan)
+}
+
+func (r *mliteRepository) CountBookings(startDate, endDate, status string) (int, error) {
+	var count int
+	err := r.db.DB.QueryRow(`
+		SELECT COUNT(DISTINCT mar.nomor_referensi)
+		FROM mlite_antrian_referensi mar
+		JOIN reg_periksa rp ON mar.no_rkm_medis = rp.no_rkm_medis
+			AND mar.tanggal_periksa = rp.tgl_registrasi
+		WHERE mar.tanggal_periksa BETWEEN ? AND ?
+			AND mar.kodebooking != ''
+			AND `+r.db.PayerFilter("rp.kd_pj")+statusKirimFilter("mar.status_kirim", status)+`
+	`, startDate, endDate).Scan(&count)
+	return count, err
+}
+
+func (r *mliteRepository) CountTaskSent(date string, taskID int) (int, error) {
+	var count int
+	err := r.db.DB.QueryRow(`
+		SELECT COUNT(DISTINCT t.nomor_referensi)
+		FROM mlite_antrian_referensi_taskid t
+		WHERE t.tanggal_periksa = ?
+			AND t.taskid = ?
+			AND t.status = 'Sudah'
+	`, date, taskID).Scan(&count)
+	return count, err
+}
+
+func (r *mliteRepository) Registrations(date, search string, limit, offset int) ([]models.Registration, int, error) {
+	return r.db.registrations(bookingJoin{
+		join: `LEFT JOIN mlite_antrian_referensi mar ON mar.no_rkm_medis = pasien.no_rkm_medis
+			AND mar.tanggal_periksa = reg_periksa.tgl_registrasi`,
+		nomorReferensi: "mar.nomor_referensi",
+		kodeBooking:    "mar.kodebooking",
+		statusKirim:    "mar.status_kirim",
+		tasks:          r.TaskIDs,
+	}, date, search, limit, offset)
+}
+
+func (r *mliteRepository) WalkIns(date string) ([]models.WalkIn, error) {
+	rejected, err := r.db.walkInRejections(date)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.DB.Query(`
+		SELECT rp.no_rawat, rp.no_reg, rp.no_rkm_medis, p.nm_pasien, DATE_FORMAT(rp.tgl_registrasi, '%Y-%m-%d'),
+			TIME_FORMAT(rp.jam_reg, '%H:%i:%s'), rp.stts_daftar, rp.kd_poli, rp.kd_dokter,
+			COALESCE(p.no_peserta, ''), COALESCE(p.no_ktp, ''), COALESCE(p.no_tlp, ''),
+			COALESCE(mp.kd_poli_bpjs, ''), COALESCE(mp.nm_poli_bpjs, ''),
+			COALESCE(md.kd_dokter_bpjs, ''), COALESCE(md.nm_dokter_bpjs, '')
+		FROM reg_periksa rp
+		JOIN pasien p ON p.no_rkm_medis = rp.no_rkm_medis
+		LEFT JOIN maping_poli_bpjs mp ON mp.kd_poli_rs = rp.kd_poli
+		LEFT JOIN maping_dokter_dpjpvclaim md ON md.kd_dokter = rp.kd_dokter
+		WHERE rp.tgl_registrasi = ?
+			AND `+r.db.PayerFilter("rp.kd_pj")+`
+			AND rp.stts != 'Batal'
+			AND rp.status_lanjut = 'Ralan'
+			AND NOT EXISTS (
+				SELECT 1 FROM mlite_antrian_referensi mar
+				WHERE mar.no_rkm_medis = rp.no_rkm_medis
+					AND mar.tanggal_periksa = rp.tgl_registrasi
+			)
+		ORDER BY rp.jam_reg ASC
+	`, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []models.WalkIn
+	for rows.Next() {
+		var v models.WalkIn
+		if err := rows.Scan(&v.NoRawat, &v.NoReg, &v.NoRkmMedis, &v.NmPasien, &v.Tanggal, &v.JamReg, &v.SttsDaftar,
+			&v.KdPoli, &v.KdDokter, &v.NoPeserta, &v.NIK, &v.NoTelp,
+			&v.KdPoliBPJS, &v.NmPoliBPJS, &v.KdDokterBPJS, &v.NmDokterBPJS); err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		if rejected[v.NoRawat] {
+			continue
+		}
+		visits = append(visits, v)
+	}
+	return visits, rows.Err()
+}
+
+func (r *mliteRepository) RejectWalkIn(noRawat, tanggal, category, message string) error {
+	return r.db.rejectWalkIn(noRawat, tanggal, category, message)
+}
+
+func (r *mliteRepository) NearestSession(kdPoli, kdDokter, hariKerja, jamReg string) (*models.DoctorSession, error) {
+	return r.db.nearestSession(kdPoli, kdDokter, hariKerja, jamReg)
+}
+
+func (r *mliteRepository) SEPReferral(noRawat string) (*models.SEPReferral, error) {
+	return r.db.sepReferral(noRawat)
+}
+
+func (r *mliteRepository) QueueCount(kdPoli, kdDokter, date string) (models.QueueCount, error) {
+	return r.db.queueCount(r.db.DB, kdPoli, kdDokter, date)
+}
+
+func (r *mliteRepository) FindPraktek(kodePoli string, kodeDokter int, hariKerja, jamMulai string) (*models.Praktek, error) {
+	return r.db.findPraktek(kodePoli, kodeDokter, hariKerja, jamMulai)
+}
+
+func (r *mliteRepository) FindPasien(norm, nomorKartu string) (*models.Pasien, error) {
+	return r.db.findPasien(norm, nomorKartu)
+}
+
+func (r *mliteRepository) AddBooking(e models.AntrianReferensi) error {
+	_, err := r.db.DB.Exec(`
+		INSERT INTO mlite_antrian_referensi
+		(tanggal_periksa, no_rkm_medis, nomor_kartu, nomor_referensi, kodebooking, jenis_kunjungan, status_kirim, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?, 'Sudah', ?)
+	`, e.TanggalPeriksa, e.NoRkmMedis, e.NomorKartu, e.NomorReferensi, e.KodeBooking, e.JenisKunjungan, e.Keterangan)
+	return err
+}
+
+func (r *mliteRepository) RegisterBooking(b models.NewBooking) (*models.BookedVisit, error) {
+	tx, err := r.db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	v, err := r.db.registerVisit(tx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	nomorReferensi := b.NomorReferensi
+	if nomorReferensi == "" {
+		nomorReferensi = v.KodeBooking
+	}
+	_, err = tx.Exec(`
+		INSERT INTO mlite_antrian_referensi 
+		(tanggal_periksa, no_rkm_medis, nomor_kartu, nomor_referensi, kodebooking, jenis_kunjungan, status_kirim, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?, 'Sudah', ?)
+	`, b.TanggalPeriksa, b.Pasien.NoRkmMedis, b.NomorKartu, nomorReferensi, v.KodeBooking, strconv.Itoa(b.JenisKunjungan), b.Keterangan)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (r *mliteRepository) FindBooking(kodeBooking string) (*models.Booking, error) {
+	return r.db.findBooking(`mlite_antrian_referensi mar
+		JOIN reg_periksa rp ON rp.no_rkm_medis = mar.no_rkm_medis 
+			AND rp.tgl_registrasi = mar.tanggal_periksa`,
+		"mar.nomor_referensi", "mar.kodebooking = ?", kodeBooking)
+}
+
+func (r *mliteRepository) QueueAhead(kdPoli, kdDokter, date string, noReg int) (int, error) {
+	return r.db.queueAhead(kdPoli, kdDokter, date, noReg)
+}
+
+// CancelBooking keeps the reason on the mlite_antrian_referensi row.
+func (r *mliteRepository) CancelBooking(b models.Booking, kodeBooking, keterangan string) error {
+	tx, err := r.db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := cancelVisit(tx, b.NoRawat); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE mlite_antrian_referensi SET keterangan = ? WHERE kodebooking = ?
+	`, truncate(keterangan, 250), kodeBooking)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *mliteRepository) RegisterPasien(p models.NewPasien) (string, error) {
+	return r.db.registerPasien(p)
+}
+
+func (r *mliteRepository) JadwalOperasi(tanggalAwal, tanggalAkhir string) ([]models.JadwalOperasi, error) {
+	return r.db.jadwalOperasiRange(tanggalAwal, tanggalAkhir)
+}
+
+func (r *mliteRepository) JadwalOperasiPasien(noPeserta string) ([]models.JadwalOperasi, error) {
+	return r.db.jadwalOperasiPasien(noPeserta)
+}
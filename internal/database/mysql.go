@@ -2,14 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"gotrol/internal/config"
 )
 
 type MySQL struct {
-	DB *sql.DB
+	DB         *sql.DB
+	payerCodes []string
 }
 
 func NewMySQL(cfg config.DatabaseConfig) (*MySQL, error) {
@@ -28,6 +30,13 @@ func NewMySQL(cfg config.DatabaseConfig) (*MySQL, error) {
 	return &MySQL{DB: db}, nil
 }
 
+// isMissingTable reports MySQL error 1146. A dry run skips EnsureSchema, so
+// a gotrol table that was never created just has no rows yet.
+func isMissingTable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1146
+}
+
 func (m *MySQL) Close() error {
 	return m.DB.Close()
 }
@@ -0,0 +1,41 @@
+package database
+
+import "gotrol/internal/models"
+
+const jadwalOperasiQuery = `
+	SELECT bo.no_rawat, DATE_FORMAT(bo.tanggal, '%Y-%m-%d'), COALESCE(po.nm_perawatan, bo.kode_paket),
+		COALESCE(mp.kd_poli_bpjs, rp.kd_poli), COALESCE(mp.nm_poli_bpjs, pol.nm_poli),
+		bo.status = 'Selesai', p.no_peserta
+	FROM booking_operasi bo
+	JOIN reg_periksa rp ON rp.no_rawat = bo.no_rawat
+	JOIN pasien p ON p.no_rkm_medis = rp.no_rkm_medis
+	LEFT JOIN paket_operasi po ON po.kode_paket = bo.kode_paket
+	LEFT JOIN poliklinik pol ON pol.kd_poli = rp.kd_poli
+	LEFT JOIN maping_poli_bpjs mp ON mp.kd_poli_rs = rp.kd_poli
+`
+
+func (m *MySQL) jadwalOperasi(where string, args ...interface{}) ([]models.JadwalOperasi, error) {
+	rows, err := m.DB.Query(jadwalOperasiQuery+where+` ORDER BY bo.tanggal, bo.jam_mulai`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.JadwalOperasi{}
+	for rows.Next() {
+		var j models.JadwalOperasi
+		if err := rows.Scan(&j.KodeBooking, &j.TanggalOperasi, &j.JenisTindakan, &j.KodePoli, &j.NamaPoli, &j.Terlaksana, &j.NoPeserta); err != nil {
+			return nil, err
+		}
+		list = append(list, j)
+	}
+	return list, rows.Err()
+}
+
+func (m *MySQL) jadwalOperasiRange(tanggalAwal, tanggalAkhir string) ([]models.JadwalOperasi, error) {
+	return m.jadwalOperasi(`WHERE bo.tanggal BETWEEN ? AND ?`, tanggalAwal, tanggalAkhir)
+}
+
+func (m *MySQL) jadwalOperasiPasien(noPeserta string) ([]models.JadwalOperasi, error) {
+	return m.jadwalOperasi(`WHERE p.no_peserta = ? AND bo.status != 'Selesai'`, noPeserta)
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gotrol/internal/models"
+)
+
+// ErrPasienExists refuses a new patient whose card or NIK is already known.
+var ErrPasienExists = errors.New("patient is already registered")
+
+// registerPasien inserts the patient with the next no_rkm_medis. Fields
+// Mobile JKN does not send get the same placeholders admisi uses.
+func (m *MySQL) registerPasien(p models.NewPasien) (string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM pasien WHERE no_peserta = ? OR no_ktp = ?
+	`, p.NomorKartu, p.NIK).Scan(&existing)
+	if err != nil {
+		return "", err
+	}
+	if existing > 0 {
+		return "", ErrPasienExists
+	}
+
+	var maxNorm int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(CAST(no_rkm_medis AS UNSIGNED)), 0) FROM pasien FOR UPDATE`).Scan(&maxNorm)
+	if err != nil {
+		return "", err
+	}
+	norm := fmt.Sprintf("%06d", maxNorm+1)
+
+	kdKel, err := wilayahID(tx, "kelurahan", "kd_kel", "nm_kel", p.NamaKel)
+	if err != nil {
+		return "", err
+	}
+	kdKec, err := wilayahID(tx, "kecamatan", "kd_kec", "nm_kec", p.NamaKec)
+	if err != nil {
+		return "", err
+	}
+	kdKab, err := wilayahID(tx, "kabupaten", "kd_kab", "nm_kab", p.NamaDati2)
+	if err != nil {
+		return "", err
+	}
+	kdProp, err := wilayahID(tx, "propinsi", "kd_prop", "nm_prop", p.NamaProp)
+	if err != nil {
+		return "", err
+	}
+
+	alamat := strings.TrimSpace(p.Alamat)
+	if p.RT != "" || p.RW != "" {
+		alamat += fmt.Sprintf(" RT %s RW %s", p.RT, p.RW)
+	}
+	nama := strings.ToUpper(strings.TrimSpace(p.Nama))
+
+	_, err = tx.Exec(`
+		INSERT INTO pasien 
+		(no_rkm_medis, nm_pasien, no_ktp, jk, tmp_lahir, tgl_lahir, nm_ibu, alamat, gol_darah, pekerjaan,
+		 stts_nikah, agama, tgl_daftar, no_tlp, umur, pnd, keluarga, namakeluarga, kd_pj, no_peserta,
+		 kd_kel, kd_kec, kd_kab, pekerjaanpj, alamatpj, kelurahanpj, kecamatanpj, kabupatenpj,
+		 perusahaan_pasien, suku_bangsa, bahasa_pasien, cacat_fisik, email, nip, kd_prop, propinsipj)
+		VALUES (?, ?, ?, ?, '-', ?, '-', ?, '-', '-',
+		 'BELUM MENIKAH', '-', ?, ?, ?, '-', 'DIRI SENDIRI', ?, ?, ?,
+		 ?, ?, ?, '-', ?, ?, ?, ?,
+		 '-', 1, 1, 1, '', '', ?, ?)
+	`, norm, nama, p.NIK, p.JenisKelamin, p.TanggalLahir, alamat,
+		p.TglDaftar, p.NoHP, fmt.Sprintf("%d %s", p.Umur, p.SttsUmur), nama, p.KdPj, p.NomorKartu,
+		kdKel, kdKec, kdKab, alamat, p.NamaKel, p.NamaKec, p.NamaDati2,
+		kdProp, p.NamaProp)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return norm, nil
+}
+
+// wilayahID returns the id of a region by name, adding it when SIMRS does
+// not know it yet, as admisi does.
+func wilayahID(tx *sql.Tx, table, idCol, nameCol, name string) (int64, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	var id int64
+	err := tx.QueryRow(`SELECT `+idCol+` FROM `+table+` WHERE `+nameCol+` = ? LIMIT 1`, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	res, err := tx.Exec(`INSERT INTO `+table+` (`+nameCol+`) VALUES (?)`, name)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
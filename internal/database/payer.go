@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultPayerCode is the penjab code mLITE ships for BPJS Kesehatan.
+const DefaultPayerCode = "BPJ"
+
+var payerCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// LoadPayerCodes decides which penjab codes count as JKN: the configured
+// list, else setting (kd_pj_bpjs from the SIMRS settings, comma separated),
+// else BPJ.
+func (m *MySQL) LoadPayerCodes(configured []string, setting string) error {
+	codes := configured
+	if len(codes) == 0 {
+		codes = strings.Split(setting, ",")
+	}
+
+	var clean []string
+	for _, c := range codes {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !payerCodePattern.MatchString(c) {
+			return fmt.Errorf("invalid payer code %q", c)
+		}
+		clean = append(clean, c)
+	}
+	if len(clean) == 0 {
+		clean = []string{DefaultPayerCode}
+	}
+	m.payerCodes = clean
+	return nil
+}
+
+// PayerCodes returns the JKN penjab codes; the first is the one new
+// registrations get.
+func (m *MySQL) PayerCodes() []string {
+	if len(m.payerCodes) == 0 {
+		return []string{DefaultPayerCode}
+	}
+	return append([]string(nil), m.payerCodes...)
+}
+
+// PayerFilter renders "column IN ('BPJ', ...)" for the JKN payer codes. The
+// codes are checked against payerCodePattern when loaded, so they are safe
+// to inline into the statement.
+func (m *MySQL) PayerFilter(column string) string {
+	codes := m.PayerCodes()
+	quoted := make([]string, len(codes))
+	for i, c := range codes {
+		quoted[i] = "'" + c + "'"
+	}
+	return column + " IN (" + strings.Join(quoted, ", ") + ")"
+}
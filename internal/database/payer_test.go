@@ -0,0 +1,54 @@
+package database
+
+import "testing"
+
+func TestLoadPayerCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured []string
+		setting    string
+		want       string
+		wantErr    bool
+	}{
+		{"config wins", []string{"BPJ", " JKN "}, "A01", "rp.kd_pj IN ('BPJ', 'JKN')", false},
+		{"kd_pj_bpjs setting", nil, "A01, A02,", "rp.kd_pj IN ('A01', 'A02')", false},
+		{"empty config falls through", []string{}, "A01", "rp.kd_pj IN ('A01')", false},
+		{"blank config falls back to BPJ", []string{" "}, "A01", "rp.kd_pj IN ('BPJ')", false},
+		{"nothing set", nil, "", "rp.kd_pj IN ('BPJ')", false},
+		{"quote in config", []string{"BPJ'; DROP TABLE pasien; --"}, "", "", true},
+		{"space inside setting", nil, "A 01", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &MySQL{}
+			err := m.LoadPayerCodes(tt.configured, tt.setting)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("codes = %v, want an error", m.PayerCodes())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.PayerFilter("rp.kd_pj"); got != tt.want {
+				t.Errorf("PayerFilter = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayerCodesDefault(t *testing.T) {
+	m := &MySQL{}
+	if got := m.PayerFilter("kd_pj"); got != "kd_pj IN ('BPJ')" {
+		t.Errorf("PayerFilter = %q", got)
+	}
+	if err := m.LoadPayerCodes([]string{"JKN"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	codes := m.PayerCodes()
+	codes[0] = "XXX"
+	if m.PayerCodes()[0] != "JKN" {
+		t.Error("PayerCodes shares its slice with the caller")
+	}
+}
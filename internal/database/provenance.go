@@ -0,0 +1,71 @@
+package database
+
+import (
+	"encoding/json"
+
+	"gotrol/internal/models"
+)
+
+func (m *MySQL) SaveTaskProvenance(nomorReferensi string, provs []models.TaskProvenance) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range provs {
+		adjustments := p.Adjustments
+		if adjustments == nil {
+			adjustments = []models.TaskAdjustment{}
+		}
+		encoded, err := json.Marshal(adjustments)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO gotrol_task_provenance 
+			(nomor_referensi, taskid, source, source_row, original_waktu, generated, adjustments, final_waktu)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE 
+				source = VALUES(source),
+				source_row = VALUES(source_row),
+				original_waktu = VALUES(original_waktu),
+				generated = VALUES(generated),
+				adjustments = VALUES(adjustments),
+				final_waktu = VALUES(final_waktu)
+		`, nomorReferensi, p.TaskID, p.Source, p.Row, p.Original, p.Generated, string(encoded), p.Final)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *MySQL) GetTaskProvenance(nomorReferensi string) (map[int]models.TaskProvenance, error) {
+	rows, err := m.DB.Query(`
+		SELECT taskid, source, source_row, original_waktu, generated, adjustments, final_waktu
+		FROM gotrol_task_provenance
+		WHERE nomor_referensi = ?
+	`, nomorReferensi)
+	if isMissingTable(err) {
+		return map[int]models.TaskProvenance{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int]models.TaskProvenance)
+	for rows.Next() {
+		var p models.TaskProvenance
+		var adjustments string
+		if err := rows.Scan(&p.TaskID, &p.Source, &p.Row, &p.Original, &p.Generated, &adjustments, &p.Final); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(adjustments), &p.Adjustments); err != nil {
+			p.Adjustments = nil
+		}
+		result[p.TaskID] = p
+	}
+	return result, rows.Err()
+}
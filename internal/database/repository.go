@@ -0,0 +1,303 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/models"
+)
+
+// Schemas a Repository can be built for.
+const (
+	SchemaMLite  = "mlite"
+	SchemaKhanza = "khanza"
+)
+
+// Booking statuses CountBookings filters on; an empty status counts all.
+const (
+	BookingSent    = "Sudah"
+	BookingNotSent = "Belum"
+)
+
+// Repository is everything GoTrol reads from or writes to the SIMRS tables.
+// Each supported schema has an adapter; the gotrol_* tables are the same for
+// all of them and stay on MySQL.
+//
+// Entries are JKN bookings with a kodebooking, ordered by registration time.
+// Except for CancelledEntries, visits cancelled in SIMRS are left out.
+type Repository interface {
+	Credentials() (*config.BPJSCredentials, error)
+
+	BookedEntries(date string) ([]models.AntrianReferensi, error)
+	// PendingEntries are the sent bookings of date with one of tasks
+	// 1..lastTask not Sudah yet.
+	PendingEntries(date string, lastTask int) ([]models.AntrianReferensi, error)
+	// IncompleteEntries are the bookings of date with one of tasks 1..7
+	// not Sudah yet, whether or not status_kirim is Sudah. Incremental mode
+	// decides per task from its source whether it is ready.
+	IncompleteEntries(date string) ([]models.AntrianReferensi, error)
+	EntriesWithTasks(date string) ([]models.AntrianReferensi, error)
+	EntriesWithUnsentTask(date string, taskID int) ([]models.AntrianReferensi, error)
+	// CancelledEntries are the sent bookings of date whose visit was
+	// cancelled in SIMRS and that have no gotrol_cancellation row yet.
+	CancelledEntries(date string) ([]models.AntrianReferensi, error)
+	EntryByNomorReferensi(nomorReferensi string) (*models.AntrianReferensi, error)
+	EntryByKodeBooking(kodeBooking string) (*models.AntrianReferensi, error)
+	// NomorReferensi returns "" when the booking is unknown.
+	NomorReferensi(kodeBooking string) (string, error)
+
+	SourceTimes(entry models.AntrianReferensi) (SourceTimes, error)
+
+	TaskIDs(nomorReferensi string) ([]models.TaskID, error)
+	UpsertTaskIDs(tanggal, nomorReferensi string, rows []TaskRow, source string) error
+	UpdateTaskWaktu(nomorReferensi string, taskID int, waktuMs int64, source, reason string) error
+	SetTaskStatus(nomorReferensi string, taskID int, status string) error
+	AcceptTask(tanggal, nomorReferensi string, taskID int, waktuMs int64, keterangan string) error
+
+	CountBookings(startDate, endDate, status string) (int, error)
+	CountTaskSent(date string, taskID int) (int, error)
+	Registrations(date, search string, limit, offset int) ([]models.Registration, int, error)
+
+	// WalkIns are the JKN outpatient visits of date without a booking that
+	// BPJS has not rejected, in registration order.
+	WalkIns(date string) ([]models.WalkIn, error)
+	// RejectWalkIn records that BPJS refused the antrean/add of a walk-in
+	// visit, so WalkIns leaves it out from then on.
+	RejectWalkIn(noRawat, tanggal, category, message string) error
+	// NearestSession is the doctor's jadwal session on hariKerja closest to
+	// jamReg, preferring one already started; nil when there is none.
+	NearestSession(kdPoli, kdDokter, hariKerja, jamReg string) (*models.DoctorSession, error)
+	// SEPReferral is nil when the visit has no SEP yet.
+	SEPReferral(noRawat string) (*models.SEPReferral, error)
+	// QueueCount is the queue of a doctor in a poli on date.
+	QueueCount(kdPoli, kdDokter, date string) (models.QueueCount, error)
+	// AddBooking records a booking BPJS accepted through antrean/add.
+	AddBooking(entry models.AntrianReferensi) error
+
+	// FindPraktek resolves BPJS poli and doctor codes to the jadwal session
+	// on hariKerja starting at jamMulai (HH:MM); nil when there is none.
+	FindPraktek(kodePoli string, kodeDokter int, hariKerja, jamMulai string) (*models.Praktek, error)
+	// FindPasien looks the patient up by norm, or by nomorKartu when norm
+	// is empty; nil when there is none.
+	FindPasien(norm, nomorKartu string) (*models.Pasien, error)
+	// RegisterBooking adds a Mobile JKN booking as a visit with its booking
+	// row, or fails with ErrAlreadyBooked or ErrQuotaFull.
+	RegisterBooking(b models.NewBooking) (*models.BookedVisit, error)
+	// FindBooking is nil when kodeBooking is unknown.
+	FindBooking(kodeBooking string) (*models.Booking, error)
+	// QueueAhead counts the visits still waiting before noReg.
+	QueueAhead(kdPoli, kdDokter, date string, noReg int) (int, error)
+	// CancelBooking cancels the visit of a booking and records why, or
+	// fails with ErrAlreadyServed.
+	CancelBooking(b models.Booking, kodeBooking, keterangan string) error
+	// RegisterPasien adds a patient and returns their no_rkm_medis, or
+	// fails with ErrPasienExists.
+	RegisterPasien(p models.NewPasien) (string, error)
+	JadwalOperasi(tanggalAwal, tanggalAkhir string) ([]models.JadwalOperasi, error)
+	// JadwalOperasiPasien lists the surgeries of a BPJS card not done yet.
+	JadwalOperasiPasien(noPeserta string) ([]models.JadwalOperasi, error)
+}
+
+// Sources of the times GoTrol captured itself rather than read from SIMRS.
+const (
+	SourceCheckin = "gotrol_checkin.waktu"
+	SourceEvent   = "gotrol_task_events.waktu"
+)
+
+// ErrUnsupported is returned by the methods a schema has no tables for.
+var ErrUnsupported = errors.New("not supported by this SIMRS schema")
+
+// SourceTimes are the task times found in SIMRS records, with the column
+// each came from, the row picked when the visit has several, and the column
+// each should have come from. Registered is the visit's tgl_registrasi and
+// jam_reg. A checkin or task event GoTrol received replaces what the SIMRS
+// tables hold.
+type SourceTimes struct {
+	Registered *time.Time
+	Tasks      [7]*time.Time
+	Sources    [7]string
+	Rows       [7]string
+	Expected   [7]string
+}
+
+// NewRepository builds the adapter for schema, reading task times from the
+// sources in tasks where they replace the adapter's own.
+func NewRepository(db *MySQL, schema string, tasks config.TasksConfig) (Repository, error) {
+	var repo Repository
+	switch schema {
+	case "", SchemaMLite:
+		repo = &mliteRepository{db: db, sources: newTaskSources(mliteSources, tasks)}
+	case SchemaKhanza:
+		repo = &khanzaRepository{db: db, sources: newTaskSources(sharedSources, tasks)}
+	default:
+		return nil, fmt.Errorf("unknown database schema %q", schema)
+	}
+	if err := db.checkTaskSources(tasks); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (m *MySQL) queryEntries(query string, args ...interface{}) ([]models.AntrianReferensi, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.AntrianReferensi
+	for rows.Next() {
+		var e models.AntrianReferensi
+		if err := scanEntry(rows, &e); err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (m *MySQL) queryEntry(query string, args ...interface{}) (*models.AntrianReferensi, error) {
+	var e models.AntrianReferensi
+	if err := scanEntry(m.DB.QueryRow(query, args...), &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// scanEntry reads the columns every adapter's entry query selects, in order.
+func scanEntry(row rowScanner, e *models.AntrianReferensi) error {
+	return row.Scan(
+		&e.TanggalPeriksa, &e.NoRkmMedis, &e.NomorKartu, &e.NomorReferensi,
+		&e.KodeBooking, &e.JenisKunjungan, &e.StatusKirim, &e.Keterangan,
+		&e.NamaPasien, &e.NoRawat, &e.PngJawab, &e.KdPoli, &e.NamaPoli,
+	)
+}
+
+// datePart cuts the date off a DATE column, which the driver returns in
+// RFC 3339 form because of parseTime.
+func datePart(s string) string {
+	if len(s) >= 10 {
+		return s[:10]
+	}
+	return s
+}
+
+// registrationTasks formats the task times of one booking for the
+// registration list.
+func registrationTasks(tasks []models.TaskID) []models.RegistrationTask {
+	var out []models.RegistrationTask
+	for _, t := range tasks {
+		waktu := ""
+		if t.Waktu > 0 {
+			waktu = time.UnixMilli(t.Waktu).Format("15:04:05")
+		}
+		out = append(out, models.RegistrationTask{TaskID: t.TaskID, Waktu: waktu})
+	}
+	return out
+}
+
+// statusKirimFilter narrows a booking count to status; a booking without a
+// status has not been sent.
+func statusKirimFilter(column, status string) string {
+	switch status {
+	case BookingSent:
+		return "\n\t\t\tAND " + column + " = 'Sudah'"
+	case BookingNotSent:
+		return "\n\t\t\tAND (" + column + " = 'Belum' OR " + column + " IS NULL OR " + column + " = '')"
+	}
+	return ""
+}
+
+// bookingJoin is how an adapter finds the booking of a visit for the
+// registration list: a join onto reg_periksa and pasien, the booking's
+// columns and its task times.
+type bookingJoin struct {
+	join           string
+	nomorReferensi string
+	kodeBooking    string
+	statusKirim    string
+	tasks          func(nomorReferensi string) ([]models.TaskID, error)
+}
+
+// registrations lists one page of the JKN visits of date matching search,
+// and how many match in total.
+func (m *MySQL) registrations(b bookingJoin, date, search string, limit, offset int) ([]models.Registration, int, error) {
+	baseQuery := `
+		FROM reg_periksa
+		INNER JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis
+		INNER JOIN dokter ON reg_periksa.kd_dokter = dokter.kd_dokter
+		INNER JOIN poliklinik ON reg_periksa.kd_poli = poliklinik.kd_poli
+		INNER JOIN penjab ON reg_periksa.kd_pj = penjab.kd_pj
+		` + b.join + `
+		WHERE reg_periksa.tgl_registrasi = ?
+			AND ` + m.PayerFilter("reg_periksa.kd_pj") + `
+	`
+	args := []interface{}{date}
+
+	if search != "" {
+		baseQuery += ` AND (pasien.nm_pasien LIKE ? OR pasien.no_rkm_medis LIKE ? OR COALESCE(` + b.nomorReferensi + `, '') LIKE ?)`
+		pattern := "%" + search + "%"
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	var total int
+	if err := m.DB.QueryRow("SELECT COUNT(*) "+baseQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT
+			pasien.no_peserta,
+			pasien.no_rkm_medis,
+			pasien.nm_pasien,
+			reg_periksa.no_rawat,
+			reg_periksa.tgl_registrasi,
+			reg_periksa.jam_reg,
+			poliklinik.nm_poli,
+			dokter.nm_dokter,
+			penjab.png_jawab,
+			COALESCE(`+b.nomorReferensi+`, '') as nomor_referensi,
+			COALESCE(`+b.kodeBooking+`, '') as kodebooking,
+			COALESCE(`+b.statusKirim+`, '') as status_kirim
+	`+baseQuery+`
+		ORDER BY reg_periksa.jam_reg ASC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var regs []models.Registration
+	for rows.Next() {
+		var p models.Registration
+		var jamReg []byte
+		if err := rows.Scan(
+			&p.NoPeserta, &p.NoRKMMedis, &p.NamaPasien, &p.NoRawat,
+			&p.TglRegistrasi, &jamReg, &p.NamaPoli, &p.NamaDokter,
+			&p.Penjamin, &p.NomorReferensi, &p.KodeBooking, &p.StatusKirim,
+		); err != nil {
+			log.Printf("ERROR scan: %v", err)
+			continue
+		}
+		p.JamReg = string(jamReg)
+		regs = append(regs, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for i := range regs {
+		if regs[i].NomorReferensi == "" {
+			continue
+		}
+		if tasks, err := b.tasks(regs[i].NomorReferensi); err == nil {
+			regs[i].Tasks = registrationTasks(tasks)
+		}
+	}
+	return regs, total, nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gotrol/internal/models"
+)
+
+var (
+	ErrReviewNotFound   = errors.New("review not found")
+	ErrReviewNotPending = errors.New("review already decided")
+)
+
+const reviewColumns = `id, nomor_referensi, kodebooking, no_rkm_medis, nama_pasien, no_rawat,
+	DATE_FORMAT(tanggal, '%Y-%m-%d'), reasons, message, tasks, status, created_at, updated_at`
+
+// ParkReview puts an entry in the review queue, or back to pending with the
+// new proposal when it was parked before.
+func (m *MySQL) ParkReview(r models.ReviewEntry) error {
+	tasks, err := json.Marshal(r.Tasks)
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.Exec(`
+		INSERT INTO gotrol_review_queue 
+		(nomor_referensi, kodebooking, no_rkm_medis, nama_pasien, no_rawat, tanggal, reasons, message, tasks, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending')
+		ON DUPLICATE KEY UPDATE 
+			reasons = VALUES(reasons),
+			message = VALUES(message),
+			tasks = VALUES(tasks),
+			status = 'pending'
+	`, r.NomorReferensi, r.KodeBooking, r.NoRkmMedis, r.NamaPasien, r.NoRawat, r.Tanggal,
+		strings.Join(r.Reasons, ","), truncate(r.Message, 255), string(tasks))
+	return err
+}
+
+// GetReview returns the review of an entry, or nil when it was never parked.
+func (m *MySQL) GetReview(nomorReferensi string) (*models.ReviewEntry, error) {
+	row := m.DB.QueryRow(`SELECT `+reviewColumns+` FROM gotrol_review_queue WHERE nomor_referensi = ?`, nomorReferensi)
+	r, err := scanReview(row)
+	if err == sql.ErrNoRows || isMissingTable(err) {
+		return nil, nil
+	}
+	return r, err
+}
+
+func (m *MySQL) GetReviewByID(id int64) (*models.ReviewEntry, error) {
+	row := m.DB.QueryRow(`SELECT `+reviewColumns+` FROM gotrol_review_queue WHERE id = ?`, id)
+	r, err := scanReview(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Decisions, err = m.GetReviewDecisions(id)
+	return r, err
+}
+
+// ListReviews returns reviews filtered by status and tanggal; empty filters
+// match everything.
+func (m *MySQL) ListReviews(status, date string) ([]models.ReviewEntry, error) {
+	query := `SELECT ` + reviewColumns + ` FROM gotrol_review_queue WHERE 1=1`
+	var args []interface{}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if date != "" {
+		query += ` AND tanggal = ?`
+		args = append(args, date)
+	}
+	query += ` ORDER BY created_at`
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []models.ReviewEntry{}
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, *r)
+	}
+	return reviews, rows.Err()
+}
+
+// DecideReview records a decision on a pending review and moves it to
+// status. tasks replaces the proposal when the reviewer edited it.
+func (m *MySQL) DecideReview(d models.ReviewDecision, status string, tasks []models.ReviewTask) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var nomorReferensi, current string
+	err = tx.QueryRow(`
+		SELECT nomor_referensi, status FROM gotrol_review_queue WHERE id = ? FOR UPDATE
+	`, d.ReviewID).Scan(&nomorReferensi, &current)
+	if err == sql.ErrNoRows {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current != models.ReviewPending {
+		return ErrReviewNotPending
+	}
+
+	if tasks != nil {
+		encoded, err := json.Marshal(tasks)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE gotrol_review_queue SET status = ?, tasks = ? WHERE id = ?`, status, string(encoded), d.ReviewID)
+		if err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.Exec(`UPDATE gotrol_review_queue SET status = ? WHERE id = ?`, status, d.ReviewID); err != nil {
+			return err
+		}
+	}
+
+	edits := d.Edits
+	if edits == nil {
+		edits = map[int]string{}
+	}
+	encoded, err := json.Marshal(edits)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO gotrol_review_decision (review_id, nomor_referensi, decision, reviewer, reason, edits)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, d.ReviewID, nomorReferensi, d.Decision, d.Reviewer, truncate(d.Reason, 255), string(encoded))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *MySQL) GetReviewDecisions(reviewID int64) ([]models.ReviewDecision, error) {
+	rows, err := m.DB.Query(`
+		SELECT id, review_id, decision, reviewer, reason, edits, created_at
+		FROM gotrol_review_decision
+		WHERE review_id = ?
+		ORDER BY id
+	`, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []models.ReviewDecision
+	for rows.Next() {
+		var d models.ReviewDecision
+		var edits string
+		if err := rows.Scan(&d.ID, &d.ReviewID, &d.Decision, &d.Reviewer, &d.Reason, &edits, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(edits), &d.Edits); err != nil || len(d.Edits) == 0 {
+			d.Edits = nil
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
+
+func (m *MySQL) MarkReviewSent(id int64) error {
+	_, err := m.DB.Exec(`UPDATE gotrol_review_queue SET status = 'sent' WHERE id = ? AND status = 'approved'`, id)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReview(row rowScanner) (*models.ReviewEntry, error) {
+	var r models.ReviewEntry
+	var reasons, tasks string
+	err := row.Scan(&r.ID, &r.NomorReferensi, &r.KodeBooking, &r.NoRkmMedis, &r.NamaPasien, &r.NoRawat,
+		&r.Tanggal, &reasons, &r.Message, &tasks, &r.Status, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Reasons = strings.Split(reasons, ",")
+	if err := json.Unmarshal([]byte(tasks), &r.Tasks); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// truncate cuts s to n characters, the way a VARCHAR(n) column counts them,
+// without splitting a multi-byte character.
+func truncate(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Ok.", 255, "Ok."},
+		{"abcdef", 3, "abc"},
+		{"pasien €uro", 8, "pasien €"},
+		{"é", 0, ""},
+		{strings.Repeat("ü", 300), 255, strings.Repeat("ü", 255)},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.n)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) split a character", tt.s, tt.n)
+		}
+	}
+}
+
+func TestListReviewsFailsOnBrokenRows(t *testing.T) {
+	columns := []string{"id", "nomor_referensi", "kodebooking", "no_rkm_medis", "nama_pasien", "no_rawat",
+		"tanggal", "reasons", "message", "tasks", "status", "created_at", "updated_at"}
+	now := time.Now()
+	review := func(id int64, tasks string) []driver.Value {
+		return []driver.Value{id, "REF1", "KB1", "000123", "PASIEN", "2025/12/28/000001",
+			"2025-12-28", "auto_order", "", tasks, "pending", now, now}
+	}
+
+	t.Run("unreadable review", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_review_queue").WithArgs("pending").WillReturnRows(
+			sqlmock.NewRows(columns).AddRow(review(1, "[]")...).AddRow(review(2, "{not json")...))
+		if reviews, err := m.ListReviews("pending", ""); err == nil {
+			t.Errorf("reviews = %+v, want an error", reviews)
+		}
+	})
+
+	t.Run("broken result set", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_review_queue").WithArgs("pending").WillReturnRows(
+			sqlmock.NewRows(columns).AddRow(review(1, "[]")...).AddRow(review(2, "[]")...).
+				RowError(1, errors.New("connection reset")))
+		if reviews, err := m.ListReviews("pending", ""); err == nil {
+			t.Errorf("reviews = %+v, want an error", reviews)
+		}
+	})
+}
+
+func TestGetReviewDecisionsFailsOnBrokenRows(t *testing.T) {
+	columns := []string{"id", "review_id", "decision", "reviewer", "reason", "edits", "created_at"}
+
+	t.Run("unscannable decision", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_review_decision").WithArgs(int64(1)).WillReturnRows(
+			sqlmock.NewRows(columns).AddRow(1, 1, "approve", "dr. Sari", "", "{}", "not a time"))
+		if decisions, err := m.GetReviewDecisions(1); err == nil {
+			t.Errorf("decisions = %+v, want an error", decisions)
+		}
+	})
+
+	t.Run("broken result set", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_review_decision").WithArgs(int64(1)).WillReturnRows(
+			sqlmock.NewRows(columns).AddRow(1, 1, "approve", "dr. Sari", "", "{}", time.Now()).
+				RowError(0, errors.New("connection reset")))
+		if decisions, err := m.GetReviewDecisions(1); err == nil {
+			t.Errorf("decisions = %+v, want an error", decisions)
+		}
+	})
+}
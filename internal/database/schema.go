@@ -0,0 +1,140 @@
+package database
+
+import "fmt"
+
+// gotrolTables are owned by GoTrol. mLITE's own tables are never altered;
+// anything GoTrol needs to remember beyond them lives here.
+var gotrolTables = []string{
+	`CREATE TABLE IF NOT EXISTS gotrol_taskid_override (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		nomor_referensi VARCHAR(50) NOT NULL,
+		taskid INT NOT NULL,
+		old_waktu BIGINT NOT NULL,
+		new_waktu BIGINT NOT NULL,
+		source VARCHAR(30) NOT NULL,
+		reason VARCHAR(100) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_override_ref (nomor_referensi, taskid)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gotrol_task_provenance (
+		nomor_referensi VARCHAR(50) NOT NULL,
+		taskid INT NOT NULL,
+		source VARCHAR(100) NOT NULL,
+		source_row VARCHAR(150) NOT NULL DEFAULT '',
+		original_waktu VARCHAR(19) NOT NULL DEFAULT '',
+		generated TINYINT(1) NOT NULL DEFAULT 0,
+		adjustments TEXT NOT NULL,
+		final_waktu VARCHAR(19) NOT NULL DEFAULT '',
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (nomor_referensi, taskid)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gotrol_review_queue (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		nomor_referensi VARCHAR(50) NOT NULL,
+		kodebooking VARCHAR(50) NOT NULL DEFAULT '',
+		no_rkm_medis VARCHAR(15) NOT NULL DEFAULT '',
+		nama_pasien VARCHAR(100) NOT NULL DEFAULT '',
+		no_rawat VARCHAR(17) NOT NULL DEFAULT '',
+		tanggal DATE NOT NULL,
+		reasons VARCHAR(255) NOT NULL,
+		message VARCHAR(255) NOT NULL DEFAULT '',
+		tasks MEDIUMTEXT NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uk_review_ref (nomor_referensi),
+		INDEX idx_review_status (status, tanggal)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gotrol_review_decision (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		review_id BIGINT NOT NULL,
+		nomor_referensi VARCHAR(50) NOT NULL,
+		decision VARCHAR(10) NOT NULL,
+		reviewer VARCHAR(100) NOT NULL,
+		reason VARCHAR(255) NOT NULL DEFAULT '',
+		edits TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_decision_review (review_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gotrol_checkin (
+		kodebooking VARCHAR(50) NOT NULL PRIMARY KEY,
+		nomor_referensi VARCHAR(50) NOT NULL,
+		waktu BIGINT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_checkin_ref (nomor_referensi)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gotrol_task_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		kodebooking VARCHAR(50) NOT NULL,
+		nomor_referensi VARCHAR(50) NOT NULL,
+		taskid INT NOT NULL,
+		waktu BIGINT NOT NULL,
+		client VARCHAR(50) NOT NULL,
+		received_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uk_event_task (kodebooking, taskid)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gotrol_cancellation (
+		nomor_referensi VARCHAR(50) NOT NULL PRIMARY KEY,
+		kodebooking VARCHAR(50) NOT NULL,
+		tanggal_periksa DATE NOT NULL,
+		source VARCHAR(20) NOT NULL,
+		alasan VARCHAR(255) NOT NULL,
+		task99 BIGINT NOT NULL DEFAULT 0,
+		bpjs_code INT NOT NULL DEFAULT 0,
+		category VARCHAR(30) NOT NULL DEFAULT '',
+		message VARCHAR(255) NOT NULL DEFAULT '',
+		cancelled_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_cancel_tanggal (tanggal_periksa)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gotrol_walkin_rejection (
+		no_rawat VARCHAR(17) NOT NULL PRIMARY KEY,
+		tanggal DATE NOT NULL,
+		category VARCHAR(30) NOT NULL DEFAULT '',
+		message VARCHAR(255) NOT NULL DEFAULT '',
+		rejected_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_walkin_rejection_tanggal (tanggal)
+	)`,
+	// Task table for schemas whose own has no status per task (Khanza).
+	`CREATE TABLE IF NOT EXISTS gotrol_taskid (
+		tanggal_periksa DATE NOT NULL,
+		nomor_referensi VARCHAR(50) NOT NULL,
+		taskid INT NOT NULL,
+		waktu BIGINT NOT NULL,
+		status VARCHAR(5) NOT NULL DEFAULT 'Belum',
+		keterangan VARCHAR(255) NOT NULL DEFAULT '',
+		PRIMARY KEY (nomor_referensi, taskid),
+		INDEX idx_taskid_tanggal (tanggal_periksa)
+	)`,
+}
+
+// gotrolColumns were added to gotrol tables after they were first created.
+var gotrolColumns = []struct{ table, column, definition string }{
+	{"gotrol_task_provenance", "source_row", "VARCHAR(150) NOT NULL DEFAULT '' AFTER source"},
+}
+
+// EnsureSchema creates the gotrol_* tables that do not exist yet and adds
+// the gotrolColumns they are missing.
+func (m *MySQL) EnsureSchema() error {
+	for _, stmt := range gotrolTables {
+		if _, err := m.DB.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create gotrol tables: %w", err)
+		}
+	}
+	for _, c := range gotrolColumns {
+		var n int
+		err := m.DB.QueryRow(`
+			SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?
+		`, c.table, c.column).Scan(&n)
+		if err != nil {
+			return fmt.Errorf("failed to check gotrol tables: %w", err)
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := m.DB.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.column + " " + c.definition); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
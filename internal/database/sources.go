@@ -0,0 +1,344 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/models"
+)
+
+// sharedSources are the task records in the Khanza tables mLITE shares. A
+// visit may have several exams and prescriptions: Task 5 is the first exam,
+// Task 6 the first prescription and Task 7 the handover of the last one,
+// once every prescription, racikan or not, has been handed over.
+var sharedSources = map[int][]config.TaskSource{
+	3: {{Table: "mutasi_berkas", Time: "dikirim", Pick: config.PickEarliest}},
+	4: {{Table: "mutasi_berkas", Time: "diterima", Pick: config.PickEarliest}},
+	5: {{Table: "pemeriksaan_ralan", Date: "tgl_perawatan", Time: "jam_rawat", Pick: config.PickEarliest}},
+	6: {{Table: "resep_obat", Date: "tgl_peresepan", Time: "jam_peresepan", Pick: config.PickEarliest, ID: "no_resep"}},
+	7: {{Table: "resep_obat", Date: "tgl_peresepan", Time: "jam", Pick: config.PickFinal, ID: "no_resep"}},
+}
+
+// taskSources are the candidates of each task, tried in order, for every
+// poli and for the polis with a mapping of their own.
+type taskSources struct {
+	all  [7][]config.TaskSource
+	poli map[string][7][]config.TaskSource
+}
+
+// newTaskSources lays the configured sources over an adapter's defaults.
+func newTaskSources(defaults map[int][]config.TaskSource, cfg config.TasksConfig) taskSources {
+	var s taskSources
+	for task, sources := range defaults {
+		s.all[task-1] = sources
+	}
+	for task, sources := range cfg.Sources {
+		s.all[task-1] = sources
+	}
+	s.poli = make(map[string][7][]config.TaskSource)
+	for poli, tasks := range cfg.PoliSources {
+		p := s.all
+		for task, sources := range tasks {
+			p[task-1] = sources
+		}
+		s.poli[poli] = p
+	}
+	return s
+}
+
+func (s taskSources) forPoli(kdPoli string) [7][]config.TaskSource {
+	if p, ok := s.poli[kdPoli]; ok {
+		return p
+	}
+	return s.all
+}
+
+// checkTaskSources makes sure every configured column exists, so a typo in
+// config.yaml stops GoTrol at startup instead of silently generating times.
+func (m *MySQL) checkTaskSources(cfg config.TasksConfig) error {
+	var all []config.TaskSource
+	for _, sources := range cfg.Sources {
+		all = append(all, sources...)
+	}
+	for _, tasks := range cfg.PoliSources {
+		for _, sources := range tasks {
+			all = append(all, sources...)
+		}
+	}
+
+	for _, src := range all {
+		columns := [][2]string{{src.Table, src.Time}, {src.Table, src.Date}, {src.Table, sourceKey(src)}, {src.Table, src.ID}}
+		if src.Racikan != "" {
+			columns = append(columns, [2]string{src.Table, "no_resep"}, [2]string{"resep_dokter_racikan", "no_resep"})
+		}
+		for _, c := range columns {
+			if c[1] == "" {
+				continue
+			}
+			var n int
+			err := m.DB.QueryRow(`
+				SELECT COUNT(*) FROM information_schema.columns
+				WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?
+			`, c[0], c[1]).Scan(&n)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("task source %s.%s does not exist", c[0], c[1])
+			}
+		}
+	}
+	return nil
+}
+
+func sourceKey(src config.TaskSource) string {
+	if src.Key == "" {
+		return "no_rawat"
+	}
+	return src.Key
+}
+
+// sourceTimes reads each task from the first of its candidates that has a
+// time for the visit, noting the row chosen. Registered is always
+// reg_periksa.
+func (m *MySQL) sourceTimes(sources [7][]config.TaskSource, entry models.AntrianReferensi) (SourceTimes, error) {
+	var st SourceTimes
+	st.Registered = m.registeredAt(entry.NoRawat)
+	for i, candidates := range sources {
+		for _, src := range candidates {
+			t, row, err := m.readSource(src, entry)
+			if err != nil {
+				return st, fmt.Errorf("%s: %w", src, err)
+			}
+			if t != nil {
+				st.Tasks[i] = t
+				st.Sources[i] = src.String()
+				st.Rows[i] = row
+				break
+			}
+		}
+		if len(candidates) > 0 {
+			st.Expected[i] = candidates[0].String()
+		}
+	}
+
+	// A Mobile JKN checkin is the real arrival; mutasi_berkas only shows
+	// when the file left rekam medis.
+	checkin, err := m.CheckinTime(entry.KodeBooking)
+	if err != nil && !isMissingTable(err) {
+		return st, fmt.Errorf("gotrol_checkin: %w", err)
+	}
+	if checkin > 0 {
+		t := time.UnixMilli(checkin)
+		st.Tasks[2], st.Sources[2], st.Rows[2] = &t, SourceCheckin, ""
+	}
+
+	// Events posted by the loket, poli and apotek apps were captured when
+	// they happened and win over every table above.
+	events, err := m.GetTaskEvents(entry.KodeBooking)
+	if err != nil && !isMissingTable(err) {
+		return st, fmt.Errorf("gotrol_task_events: %w", err)
+	}
+	for _, e := range events {
+		if e.TaskID >= 1 && e.TaskID <= 7 && e.Waktu > 0 {
+			t := time.UnixMilli(e.Waktu)
+			st.Tasks[e.TaskID-1], st.Sources[e.TaskID-1], st.Rows[e.TaskID-1] = &t, SourceEvent, ""
+		}
+	}
+	return st, nil
+}
+
+func (m *MySQL) registeredAt(noRawat string) *time.Time {
+	if noRawat == "" {
+		return nil
+	}
+	var tglReg, jamReg sql.NullString
+	err := m.DB.QueryRow(`
+		SELECT tgl_registrasi, jam_reg FROM reg_periksa
+		WHERE no_rawat = ?
+	`, noRawat).Scan(&tglReg, &jamReg)
+	if err != nil || !tglReg.Valid || !jamReg.Valid {
+		return nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", datePart(tglReg.String)+" "+jamReg.String, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// readSource returns the time src holds for the visit and which row it came
+// from, or nil when it has none. Rows are read in time order, so ties go to
+// the first.
+func (m *MySQL) readSource(src config.TaskSource, entry models.AntrianReferensi) (*time.Time, string, error) {
+	query, args := sourceQuery(src, entry)
+	if args[0] == "" {
+		return nil, "", nil
+	}
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var scanned []sourceValues
+	for rows.Next() {
+		var v sourceValues
+		if err := rows.Scan(&v.date, &v.clock, &v.id); err != nil {
+			return nil, "", err
+		}
+		scanned = append(scanned, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	t, row := pickSource(src, scanned)
+	return t, row, nil
+}
+
+// sourceQuery selects the date, time and ID columns of the rows src holds
+// for the visit. Table and column names were checked by config.Validate.
+func sourceQuery(src config.TaskSource, entry models.AntrianReferensi) (string, []interface{}) {
+	dateColumn, idColumn := "NULL", "NULL"
+	order := []string{"`" + src.Time + "`"}
+	if src.Date != "" {
+		dateColumn = "`" + src.Date + "`"
+		order = append([]string{dateColumn}, order...)
+	}
+	if src.ID != "" {
+		idColumn = "`" + src.ID + "`"
+		order = append(order, idColumn)
+	}
+	query := "SELECT " + dateColumn + ", `" + src.Time + "`, " + idColumn +
+		" FROM `" + src.Table + "` s WHERE `" + sourceKey(src) + "` = ?"
+
+	var args []interface{}
+	switch sourceKey(src) {
+	case "no_rkm_medis":
+		query += " AND `" + src.Date + "` = ?"
+		args = []interface{}{entry.NoRkmMedis, datePart(entry.TanggalPeriksa)}
+	default:
+		args = []interface{}{entry.NoRawat}
+	}
+	switch src.Racikan {
+	case config.RacikanOnly:
+		query += " AND EXISTS (SELECT 1 FROM resep_dokter_racikan r WHERE r.no_resep = s.no_resep)"
+	case config.RacikanExclude:
+		query += " AND NOT EXISTS (SELECT 1 FROM resep_dokter_racikan r WHERE r.no_resep = s.no_resep)"
+	}
+	query += " ORDER BY " + strings.Join(order, ", ")
+	return query, args
+}
+
+// sourceValues are the date, time and ID columns of one source row as
+// scanned.
+type sourceValues struct {
+	date, clock, id interface{}
+}
+
+// pickSource chooses among the rows of a visit as src.Pick says. A final
+// pick has no time while any row is still without one.
+func pickSource(src config.TaskSource, rows []sourceValues) (*time.Time, string) {
+	var picked *time.Time
+	var pickedID string
+	pending := 0
+	later := src.Pick == config.PickLatest || src.Pick == config.PickFinal
+	for _, v := range rows {
+		t := combineSourceTime(v.date, v.clock, src.Date != "")
+		if t == nil {
+			pending++
+			continue
+		}
+		if picked == nil || (later && t.After(*picked)) || (!later && t.Before(*picked)) {
+			picked = t
+			pickedID = sourceString(v.id)
+		}
+	}
+	if picked == nil || (src.Pick == config.PickFinal && pending > 0) {
+		return nil, ""
+	}
+	return picked, sourceRow(src, pickedID, len(rows))
+}
+
+// sourceRow describes the row a time was picked from, such as
+// "no_resep 202410160012, final of 2 rows".
+func sourceRow(src config.TaskSource, id string, n int) string {
+	var parts []string
+	if src.ID != "" && id != "" {
+		parts = append(parts, src.ID+" "+id)
+	}
+	if src.Racikan != "" {
+		parts = append(parts, "racikan "+src.Racikan)
+	}
+	if n > 1 {
+		pick := src.Pick
+		if pick == "" {
+			pick = config.PickEarliest
+		}
+		parts = append(parts, fmt.Sprintf("%s of %d rows", pick, n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// combineSourceTime joins a DATE and a TIME column, or parses a DATETIME
+// when there is no date column. Zero dates and empty times are no time, and
+// so is a TIME of 00:00:00: Khanza leaves it there until the pharmacy
+// validates the prescription.
+func combineSourceTime(date, clock interface{}, hasDate bool) *time.Time {
+	c := sourceString(clock)
+	if c == "" {
+		return nil
+	}
+	s := c
+	if hasDate {
+		d := sourceString(date)
+		if d == "" {
+			return nil
+		}
+		if len(c) > 8 {
+			c = c[len(c)-8:]
+		}
+		if c == "00:00:00" {
+			return nil
+		}
+		s = datePart(d) + " " + c
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// sourceString renders a scanned column value. The driver returns DATE and
+// DATETIME as time.Time because of parseTime, and TIME as bytes.
+func sourceString(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() || v.Year() < 1000 {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return ""
+	}
+	if strings.HasPrefix(s, "0000-00-00") {
+		return ""
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = s[:i]
+	}
+	if len(s) >= 19 && s[10] == 'T' {
+		s = s[:10] + " " + s[11:19]
+	}
+	return s
+}
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"gotrol/internal/config"
+	"gotrol/internal/models"
+)
+
+func TestCombineSourceTime(t *testing.T) {
+	date := time.Date(2025, 12, 28, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		date    interface{}
+		clock   interface{}
+		hasDate bool
+		want    string
+	}{
+		{"date and time", date, []byte("09:15:00"), true, "2025-12-28 09:15:00"},
+		{"date as string", "2025-12-28", "09:15:00", true, "2025-12-28 09:15:00"},
+		{"datetime", nil, time.Date(2025, 12, 28, 9, 15, 0, 0, time.UTC), false, "2025-12-28 09:15:00"},
+		{"datetime as bytes", nil, []byte("2025-12-28 09:15:00"), false, "2025-12-28 09:15:00"},
+		{"zero datetime", nil, []byte("0000-00-00 00:00:00"), false, ""},
+		{"zero date", []byte("0000-00-00"), []byte("09:15:00"), true, ""},
+		{"unhandled prescription", date, []byte("00:00:00"), true, ""},
+		{"null time", date, nil, true, ""},
+		{"null date", nil, []byte("09:15:00"), true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if tm := combineSourceTime(tt.date, tt.clock, tt.hasDate); tm != nil {
+				got = tm.Format("2006-01-02 15:04:05")
+			}
+			if got != tt.want {
+				t.Errorf("combineSourceTime = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickSource(t *testing.T) {
+	date := []byte("2025-12-28")
+	row := func(clock, id string) sourceValues {
+		return sourceValues{date: date, clock: []byte(clock), id: []byte(id)}
+	}
+	resep := config.TaskSource{Table: "resep_obat", Date: "tgl_peresepan", Time: "jam", ID: "no_resep"}
+	with := func(pick, racikan string) config.TaskSource {
+		src := resep
+		src.Pick, src.Racikan = pick, racikan
+		return src
+	}
+
+	tests := []struct {
+		name     string
+		src      config.TaskSource
+		rows     []sourceValues
+		wantTime string
+		wantRow  string
+	}{
+		{
+			name:     "earliest by default",
+			src:      with("", ""),
+			rows:     []sourceValues{row("09:00:00", "R1"), row("08:30:00", "R2")},
+			wantTime: "08:30:00",
+			wantRow:  "no_resep R2, earliest of 2 rows",
+		},
+		{
+			name:     "latest",
+			src:      with(config.PickLatest, ""),
+			rows:     []sourceValues{row("09:00:00", "R1"), row("08:30:00", "R2"), row("00:00:00", "R3")},
+			wantTime: "09:00:00",
+			wantRow:  "no_resep R1, latest of 3 rows",
+		},
+		{
+			name:     "final once every row is handed over",
+			src:      with(config.PickFinal, ""),
+			rows:     []sourceValues{row("09:00:00", "R1"), row("09:40:00", "R2")},
+			wantTime: "09:40:00",
+			wantRow:  "no_resep R2, final of 2 rows",
+		},
+		{
+			name: "final waits for a pending row",
+			src:  with(config.PickFinal, ""),
+			rows: []sourceValues{row("09:00:00", "R1"), row("00:00:00", "R2")},
+		},
+		{
+			name:     "ties go to the first row",
+			src:      with(config.PickEarliest, ""),
+			rows:     []sourceValues{row("09:00:00", "R1"), row("09:00:00", "R2")},
+			wantTime: "09:00:00",
+			wantRow:  "no_resep R1, earliest of 2 rows",
+		},
+		{
+			name:     "single row names only the row",
+			src:      with(config.PickEarliest, config.RacikanOnly),
+			rows:     []sourceValues{row("10:00:00", "R9")},
+			wantTime: "10:00:00",
+			wantRow:  "no_resep R9, racikan only",
+		},
+		{
+			name:     "no ID column",
+			src:      config.TaskSource{Table: "pemeriksaan_ralan", Date: "tgl_perawatan", Time: "jam_rawat"},
+			rows:     []sourceValues{{date: date, clock: []byte("08:50:00")}, {date: date, clock: []byte("08:40:00")}},
+			wantTime: "08:40:00",
+			wantRow:  "earliest of 2 rows",
+		},
+		{
+			name: "no rows",
+			src:  with("", ""),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, row := pickSource(tt.src, tt.rows)
+			got := ""
+			if tm != nil {
+				got = tm.Format("15:04:05")
+			}
+			if got != tt.wantTime || row != tt.wantRow {
+				t.Errorf("pickSource = %q %q, want %q %q", got, row, tt.wantTime, tt.wantRow)
+			}
+		})
+	}
+}
+
+func TestSourceRow(t *testing.T) {
+	tests := []struct {
+		src  config.TaskSource
+		id   string
+		n    int
+		want string
+	}{
+		{config.TaskSource{ID: "no_resep", Pick: config.PickFinal, Racikan: config.RacikanExclude}, "R1", 3, "no_resep R1, racikan exclude, final of 3 rows"},
+		{config.TaskSource{ID: "no_resep"}, "", 2, "earliest of 2 rows"},
+		{config.TaskSource{}, "", 1, ""},
+	}
+	for _, tt := range tests {
+		if got := sourceRow(tt.src, tt.id, tt.n); got != tt.want {
+			t.Errorf("sourceRow(%+v, %q, %d) = %q, want %q", tt.src, tt.id, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSourceQuery(t *testing.T) {
+	entry := models.AntrianReferensi{NoRawat: "2025/12/28/000001", NoRkmMedis: "000123", TanggalPeriksa: "2025-12-28T00:00:00Z"}
+	resep := config.TaskSource{Table: "resep_obat", Date: "tgl_peresepan", Time: "jam", ID: "no_resep"}
+	racikan := resep
+	racikan.Racikan = config.RacikanOnly
+	nonRacikan := resep
+	nonRacikan.Racikan = config.RacikanExclude
+	loket := config.TaskSource{Table: "mlite_antrian_loket", Key: "no_rkm_medis", Date: "postdate", Time: "start_time"}
+
+	tests := []struct {
+		name     string
+		src      config.TaskSource
+		wantSQL  string
+		wantArgs string
+	}{
+		{
+			name:     "keyed on no_rawat",
+			src:      resep,
+			wantSQL:  "SELECT `tgl_peresepan`, `jam`, `no_resep` FROM `resep_obat` s WHERE `no_rawat` = ? ORDER BY `tgl_peresepan`, `jam`, `no_resep`",
+			wantArgs: "[2025/12/28/000001]",
+		},
+		{
+			name:     "racikan only",
+			src:      racikan,
+			wantSQL:  "SELECT `tgl_peresepan`, `jam`, `no_resep` FROM `resep_obat` s WHERE `no_rawat` = ? AND EXISTS (SELECT 1 FROM resep_dokter_racikan r WHERE r.no_resep = s.no_resep) ORDER BY `tgl_peresepan`, `jam`, `no_resep`",
+			wantArgs: "[2025/12/28/000001]",
+		},
+		{
+			name:     "racikan excluded",
+			src:      nonRacikan,
+			wantSQL:  "SELECT `tgl_peresepan`, `jam`, `no_resep` FROM `resep_obat` s WHERE `no_rawat` = ? AND NOT EXISTS (SELECT 1 FROM resep_dokter_racikan r WHERE r.no_resep = s.no_resep) ORDER BY `tgl_peresepan`, `jam`, `no_resep`",
+			wantArgs: "[2025/12/28/000001]",
+		},
+		{
+			name:     "keyed on no_rkm_medis and the visit date",
+			src:      loket,
+			wantSQL:  "SELECT `postdate`, `start_time`, NULL FROM `mlite_antrian_loket` s WHERE `no_rkm_medis` = ? AND `postdate` = ? ORDER BY `postdate`, `start_time`",
+			wantArgs: "[000123 2025-12-28]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := sourceQuery(tt.src, entry)
+			if query != tt.wantSQL {
+				t.Errorf("query = %s\nwant    %s", query, tt.wantSQL)
+			}
+			if fmt.Sprint(args) != tt.wantArgs {
+				t.Errorf("args = %v, want %s", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSourceTimesWithoutGotrolTables(t *testing.T) {
+	missing := func(table string) error {
+		return &mysql.MySQLError{Number: 1146, Message: "Table 'sik." + table + "' doesn't exist"}
+	}
+	entry := models.AntrianReferensi{KodeBooking: "KB1"}
+
+	t.Run("missing tables have no rows", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_checkin").WithArgs("KB1").WillReturnError(missing("gotrol_checkin"))
+		mock.ExpectQuery("FROM gotrol_task_events").WithArgs("KB1").WillReturnError(missing("gotrol_task_events"))
+
+		st, err := m.sourceTimes([7][]config.TaskSource{}, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, tm := range st.Tasks {
+			if tm != nil {
+				t.Errorf("task %d = %v, want none", i+1, tm)
+			}
+		}
+	})
+
+	t.Run("other errors still fail", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM gotrol_checkin").WithArgs("KB1").WillReturnError(&mysql.MySQLError{Number: 1045, Message: "Access denied"})
+
+		if _, err := m.sourceTimes([7][]config.TaskSource{}, entry); err == nil {
+			t.Error("want the gotrol_checkin error")
+		}
+	})
+}
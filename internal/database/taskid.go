@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+
+	"gotrol/internal/models"
+)
+
+// TaskRow is the part of a task table row an upsert writes.
+type TaskRow struct {
+	TaskID     int
+	Waktu      int64
+	Keterangan string
+}
+
+// upsertTaskIDs writes rows for one nomor_referensi in a single transaction.
+// Rows already Sudah keep their waktu because BPJS holds that time; any other
+// stored waktu that changes is logged to gotrol_taskid_override. table has
+// the columns of mlite_antrian_referensi_taskid.
+func (m *MySQL) upsertTaskIDs(table, tanggal, nomorReferensi string, rows []TaskRow, source string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing, err := lockTaskIDs(tx, table, nomorReferensi)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		old, ok := existing[r.TaskID]
+		if ok && old.Status == "Sudah" {
+			continue
+		}
+		if ok && old.Waktu != r.Waktu {
+			if err := recordTaskOverride(tx, nomorReferensi, r.TaskID, old.Waktu, r.Waktu, source, "recomputed"); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO `+table+` 
+			(tanggal_periksa, nomor_referensi, taskid, waktu, status, keterangan)
+			VALUES (?, ?, ?, ?, 'Belum', ?)
+			ON DUPLICATE KEY UPDATE 
+				waktu = IF(status != 'Sudah', VALUES(waktu), waktu),
+				keterangan = IF(status != 'Sudah', VALUES(keterangan), keterangan)
+		`, tanggal, nomorReferensi, r.TaskID, r.Waktu, r.Keterangan)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateTaskWaktu moves a task that is not Sudah yet to waktuMs and logs the
+// previous time to gotrol_taskid_override.
+func (m *MySQL) updateTaskWaktu(table, nomorReferensi string, taskID int, waktuMs int64, source, reason string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old int64
+	err = tx.QueryRow(`
+		SELECT waktu FROM `+table+` 
+		WHERE nomor_referensi = ? AND taskid = ? AND status != 'Sudah'
+		FOR UPDATE
+	`, nomorReferensi, taskID).Scan(&old)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if old == waktuMs {
+		return nil
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE `+table+` 
+		SET waktu = ? 
+		WHERE nomor_referensi = ? AND taskid = ? AND status != 'Sudah'
+	`, waktuMs, nomorReferensi, taskID); err != nil {
+		return err
+	}
+	if err := recordTaskOverride(tx, nomorReferensi, taskID, old, waktuMs, source, reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *MySQL) taskIDs(table, nomorReferensi string) ([]models.TaskID, error) {
+	rows, err := m.DB.Query(`
+		SELECT tanggal_periksa, nomor_referensi, taskid, waktu, status, keterangan
+		FROM `+table+`
+		WHERE nomor_referensi = ?
+		ORDER BY taskid
+	`, nomorReferensi)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []models.TaskID
+	for rows.Next() {
+		var t models.TaskID
+		if err := rows.Scan(&t.TanggalPeriksa, &t.NomorReferensi, &t.TaskID, &t.Waktu, &t.Status, &t.Keterangan); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+func (m *MySQL) setTaskStatus(table, nomorReferensi string, taskID int, status string) error {
+	_, err := m.DB.Exec(`
+		UPDATE `+table+` 
+		SET status = ? 
+		WHERE nomor_referensi = ? AND taskid = ?
+	`, status, nomorReferensi, taskID)
+	return err
+}
+
+// acceptTask stores a task BPJS already holds as Sudah with the time BPJS
+// recorded.
+func (m *MySQL) acceptTask(table, tanggal, nomorReferensi string, taskID int, waktuMs int64, keterangan string) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO `+table+` 
+		(tanggal_periksa, nomor_referensi, taskid, waktu, status, keterangan)
+		VALUES (?, ?, ?, ?, 'Sudah', ?)
+		ON DUPLICATE KEY UPDATE 
+			waktu = VALUES(waktu),
+			status = 'Sudah'
+	`, tanggal, nomorReferensi, taskID, waktuMs, keterangan)
+	return err
+}
+
+func lockTaskIDs(tx *sql.Tx, table, nomorReferensi string) (map[int]models.TaskID, error) {
+	rows, err := tx.Query(`
+		SELECT taskid, waktu, status FROM `+table+` 
+		WHERE nomor_referensi = ?
+		FOR UPDATE
+	`, nomorReferensi)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[int]models.TaskID)
+	for rows.Next() {
+		var t models.TaskID
+		if err := rows.Scan(&t.TaskID, &t.Waktu, &t.Status); err != nil {
+			return nil, err
+		}
+		existing[t.TaskID] = t
+	}
+	return existing, rows.Err()
+}
+
+func recordTaskOverride(tx *sql.Tx, nomorReferensi string, taskID int, oldWaktu, newWaktu int64, source, reason string) error {
+	_, err := tx.Exec(`
+		INSERT INTO gotrol_taskid_override 
+		(nomor_referensi, taskid, old_waktu, new_waktu, source, reason)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, nomorReferensi, taskID, oldWaktu, newWaktu, source, reason)
+	return err
+}
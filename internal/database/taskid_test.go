@@ -0,0 +1,120 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMock(t *testing.T) (*MySQL, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return &MySQL{DB: db}, mock
+}
+
+func TestTaskIDs(t *testing.T) {
+	columns := []string{"tanggal_periksa", "nomor_referensi", "taskid", "waktu", "status", "keterangan"}
+
+	t.Run("rows", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM mlite_antrian_referensi_taskid").WithArgs("REF1").WillReturnRows(
+			sqlmock.NewRows(columns).
+				AddRow("2025-12-28", "REF1", 1, int64(1766884200000), "Sudah", "").
+				AddRow("2025-12-28", "REF1", 2, int64(1766884800000), "Belum", ""))
+
+		tasks, err := m.taskIDs(mliteTaskTable, "REF1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tasks) != 2 || tasks[0].Status != "Sudah" || tasks[1].TaskID != 2 {
+			t.Errorf("tasks = %+v", tasks)
+		}
+	})
+
+	t.Run("unscannable row", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM mlite_antrian_referensi_taskid").WithArgs("REF1").WillReturnRows(
+			sqlmock.NewRows(columns).
+				AddRow("2025-12-28", "REF1", 1, int64(1766884200000), "Sudah", "").
+				AddRow("2025-12-28", "REF1", 2, "not a waktu", "Sudah", ""))
+
+		if tasks, err := m.taskIDs(mliteTaskTable, "REF1"); err == nil {
+			t.Errorf("tasks = %+v, want the scan error", tasks)
+		}
+	})
+
+	t.Run("broken result set", func(t *testing.T) {
+		m, mock := newMock(t)
+		mock.ExpectQuery("FROM mlite_antrian_referensi_taskid").WithArgs("REF1").WillReturnRows(
+			sqlmock.NewRows(columns).
+				AddRow("2025-12-28", "REF1", 1, int64(1766884200000), "Sudah", "").
+				AddRow("2025-12-28", "REF1", 2, int64(1766884800000), "Sudah", "").
+				RowError(1, errors.New("connection reset")))
+
+		if tasks, err := m.taskIDs(mliteTaskTable, "REF1"); err == nil {
+			t.Errorf("tasks = %+v, want the row error", tasks)
+		}
+	})
+}
+
+func TestUpsertTaskIDs(t *testing.T) {
+	m, mock := newMock(t)
+	const (
+		waktu1 = int64(1766884200000)
+		waktu2 = int64(1766884800000)
+		waktu3 = int64(1766885400000)
+	)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT taskid, waktu, status FROM mlite_antrian_referensi_taskid").WithArgs("REF1").WillReturnRows(
+		sqlmock.NewRows([]string{"taskid", "waktu", "status"}).
+			AddRow(1, waktu1, "Sudah").
+			AddRow(2, waktu2, "Belum").
+			AddRow(3, waktu2, "Belum"))
+	// Task 1 is Sudah and skipped, task 2 keeps its waktu, task 3 moves
+	// and task 4 is new: only task 3 is logged as an override.
+	mock.ExpectExec("INSERT INTO mlite_antrian_referensi_taskid").
+		WithArgs("2025-12-28", "REF1", 2, waktu2, "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO gotrol_taskid_override").
+		WithArgs("REF1", 3, waktu2, waktu3, "watcher", "recomputed").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO mlite_antrian_referensi_taskid").
+		WithArgs("2025-12-28", "REF1", 3, waktu3, "").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO mlite_antrian_referensi_taskid").
+		WithArgs("2025-12-28", "REF1", 4, waktu3, "").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := m.upsertTaskIDs(mliteTaskTable, "2025-12-28", "REF1", []TaskRow{
+		{TaskID: 1, Waktu: waktu3},
+		{TaskID: 2, Waktu: waktu2},
+		{TaskID: 3, Waktu: waktu3},
+		{TaskID: 4, Waktu: waktu3},
+	}, "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpsertTaskIDsRollsBackOnOverrideError(t *testing.T) {
+	m, mock := newMock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT taskid, waktu, status FROM mlite_antrian_referensi_taskid").WithArgs("REF1").WillReturnRows(
+		sqlmock.NewRows([]string{"taskid", "waktu", "status"}).AddRow(3, int64(1766884800000), "Belum"))
+	mock.ExpectExec("INSERT INTO gotrol_taskid_override").WillReturnError(errors.New("table is full"))
+	mock.ExpectRollback()
+
+	err := m.upsertTaskIDs(mliteTaskTable, "2025-12-28", "REF1", []TaskRow{{TaskID: 3, Waktu: 1766885400000}}, "watcher")
+	if err == nil {
+		t.Error("upsert succeeded without its override row")
+	}
+}
@@ -0,0 +1,35 @@
+package database
+
+// rejectWalkIn remembers a walk-in visit BPJS refused, so it is not sent
+// again after a restart.
+func (m *MySQL) rejectWalkIn(noRawat, tanggal, category, message string) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO gotrol_walkin_rejection (no_rawat, tanggal, category, message)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+			category = VALUES(category),
+			message = VALUES(message)
+	`, noRawat, tanggal, truncate(category, 30), truncate(message, 255))
+	return err
+}
+
+func (m *MySQL) walkInRejections(date string) (map[string]bool, error) {
+	rejected := make(map[string]bool)
+	rows, err := m.DB.Query(`SELECT no_rawat FROM gotrol_walkin_rejection WHERE tanggal = ?`, date)
+	if isMissingTable(err) {
+		return rejected, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noRawat string
+		if err := rows.Scan(&noRawat); err != nil {
+			return nil, err
+		}
+		rejected[noRawat] = true
+	}
+	return rejected, rows.Err()
+}
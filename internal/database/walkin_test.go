@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestMliteWalkInsSkipRejected(t *testing.T) {
+	columns := []string{"no_rawat", "no_reg", "no_rkm_medis", "nm_pasien", "tgl_registrasi", "jam_reg", "stts_daftar",
+		"kd_poli", "kd_dokter", "no_peserta", "no_ktp", "no_tlp", "kd_poli_bpjs", "nm_poli_bpjs", "kd_dokter_bpjs", "nm_dokter_bpjs"}
+	visits := func() *sqlmock.Rows {
+		rows := sqlmock.NewRows(columns)
+		for _, noRawat := range []string{"2025/12/29/000001", "2025/12/29/000002"} {
+			rows.AddRow(noRawat, "001", "000123", "BUDI", "2025-12-29", "08:05:00", "Lama",
+				"INT", "D1", "0001234567890", "", "", "INT", "PENYAKIT DALAM", "12345", "dr. A")
+		}
+		return rows
+	}
+
+	tests := []struct {
+		name     string
+		rejected func(*sqlmock.ExpectedQuery)
+		want     []string
+	}{
+		{"one rejected", func(q *sqlmock.ExpectedQuery) {
+			q.WillReturnRows(sqlmock.NewRows([]string{"no_rawat"}).AddRow("2025/12/29/000001"))
+		}, []string{"2025/12/29/000002"}},
+		{"table not created yet", func(q *sqlmock.ExpectedQuery) {
+			q.WillReturnError(&mysql.MySQLError{Number: 1146, Message: "Table 'mlite.gotrol_walkin_rejection' doesn't exist"})
+		}, []string{"2025/12/29/000001", "2025/12/29/000002"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, mock := newMock(t)
+			tt.rejected(mock.ExpectQuery("FROM gotrol_walkin_rejection").WithArgs("2025-12-29"))
+			mock.ExpectQuery("FROM reg_periksa rp").WithArgs("2025-12-29").WillReturnRows(visits())
+
+			got, err := (&mliteRepository{db: m}).WalkIns("2025-12-29")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("visits %+v, want %v", got, tt.want)
+			}
+			for i, v := range got {
+				if v.NoRawat != tt.want[i] {
+					t.Errorf("visit %d = %s, want %s", i, v.NoRawat, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Package events receives task events from the apps at the loket, poli and
+// apotek as they happen, so task times no longer have to be reconstructed
+// from SIMRS tables after the visit.
+package events
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+// maxClockSkew is how far in the future a reported waktu may be before it is
+// treated as a client clock error.
+const maxClockSkew = 5 * time.Minute
+
+// maxBodyBytes caps a posted event; a real one is well under 200 bytes.
+const maxBodyBytes = 4 << 10
+
+// Forwarder sends a stored event to BPJS. *service.Watcher implements it.
+type Forwarder interface {
+	ForwardEvent(e models.TaskEvent)
+}
+
+// eventStore keeps the events. *database.MySQL implements it with the
+// gotrol_task_events table.
+type eventStore interface {
+	SaveTaskEvent(e models.TaskEvent) (bool, error)
+	GetTaskEvents(kodeBooking string) ([]models.TaskEvent, error)
+}
+
+type Server struct {
+	db        eventStore
+	repo      database.Repository
+	cfg       config.EventsConfig
+	forwarder Forwarder
+	now       func() time.Time
+	server    *http.Server
+}
+
+// NewServer builds the ingest API. forwarder may be nil when events are only
+// stored for the next poll.
+func NewServer(db *database.MySQL, repo database.Repository, cfg config.EventsConfig, forwarder Forwarder) *Server {
+	return &Server{
+		db:        db,
+		repo:      repo,
+		cfg:       cfg,
+		forwarder: forwarder,
+		now:       time.Now,
+	}
+}
+
+func (s *Server) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /events", s.handlePostEvent)
+	mux.HandleFunc("GET /events", s.handleGetEvents)
+
+	port := s.cfg.Port
+	if port == 0 {
+		port = 8897
+	}
+	s.server = &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf(" Event API started at http://localhost:%d/events", port)
+	return s.server.ListenAndServe()
+}
+
+func (s *Server) Stop() error {
+	if s.server != nil {
+		return s.server.Close()
+	}
+	return nil
+}
+
+// client returns the configured client whose key is in X-Api-Key.
+func (s *Server) client(r *http.Request) *config.EventClient {
+	key := r.Header.Get("X-Api-Key")
+	if key == "" {
+		return nil
+	}
+	for i := range s.cfg.Clients {
+		c := &s.cfg.Clients[i]
+		if c.Key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(c.Key)) == 1 {
+			return c
+		}
+	}
+	return nil
+}
+
+func mayReport(c *config.EventClient, taskID int) bool {
+	if len(c.Tasks) == 0 {
+		return true
+	}
+	for _, t := range c.Tasks {
+		if t == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+type eventRequest struct {
+	KodeBooking string `json:"kodebooking"`
+	TaskID      int    `json:"taskid"`
+	Waktu       int64  `json:"waktu"`
+}
+
+// handlePostEvent stores "task N happened for kodebooking X at waktu". A
+// missing waktu means now.
+func (s *Server) handlePostEvent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	c := s.client(r)
+	if c == nil {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+
+	var req eventRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.TaskID < 1 || req.TaskID > 7 {
+		http.Error(w, "taskid must be 1-7", http.StatusBadRequest)
+		return
+	}
+	if !mayReport(c, req.TaskID) {
+		http.Error(w, fmt.Sprintf("%s may not report task %d", c.Name, req.TaskID), http.StatusForbidden)
+		return
+	}
+	now := s.now()
+	if req.Waktu == 0 {
+		req.Waktu = now.UnixMilli()
+	}
+	if time.UnixMilli(req.Waktu).After(now.Add(maxClockSkew)) {
+		http.Error(w, "waktu is in the future", http.StatusBadRequest)
+		return
+	}
+
+	nr, err := s.repo.NomorReferensi(req.KodeBooking)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if nr == "" {
+		http.Error(w, "unknown kodebooking", http.StatusNotFound)
+		return
+	}
+
+	event := models.TaskEvent{
+		KodeBooking:    req.KodeBooking,
+		NomorReferensi: nr,
+		TaskID:         req.TaskID,
+		Waktu:          req.Waktu,
+		Client:         c.Name,
+	}
+	stored, err := s.db.SaveTaskEvent(event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := "duplicate"
+	forwarded := false
+	if stored {
+		status = "recorded"
+		log.Printf("📨 Event %s Task %d from %s at %s", req.KodeBooking, req.TaskID, c.Name,
+			time.UnixMilli(req.Waktu).Format("15:04:05"))
+		if s.cfg.Forward && s.forwarder != nil {
+			go s.forwarder.ForwardEvent(event)
+			forwarded = true
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"forwarded": forwarded,
+		"event":     event,
+	})
+}
+
+func (s *Server) handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.client(r) == nil {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+	kodeBooking := r.URL.Query().Get("kodebooking")
+	if kodeBooking == "" {
+		http.Error(w, "kodebooking is required", http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.db.GetTaskEvents(kodeBooking)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kodebooking": kodeBooking,
+		"total":       len(events),
+		"events":      events,
+	})
+}
@@ -0,0 +1,165 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+type fakeEvents struct {
+	saved map[string]models.TaskEvent
+}
+
+func (f *fakeEvents) SaveTaskEvent(e models.TaskEvent) (bool, error) {
+	key := fmt.Sprintf("%s/%d", e.KodeBooking, e.TaskID)
+	if _, ok := f.saved[key]; ok {
+		return false, nil
+	}
+	f.saved[key] = e
+	return true, nil
+}
+
+func (f *fakeEvents) GetTaskEvents(string) ([]models.TaskEvent, error) { return nil, nil }
+
+type fakeBookings struct {
+	database.Repository
+}
+
+func (fakeBookings) NomorReferensi(kodeBooking string) (string, error) {
+	if kodeBooking == "KB1" {
+		return "REF1", nil
+	}
+	return "", nil
+}
+
+type fakeForwarder struct {
+	forwarded chan models.TaskEvent
+}
+
+func (f *fakeForwarder) ForwardEvent(e models.TaskEvent) { f.forwarded <- e }
+
+func TestHandlePostEvent(t *testing.T) {
+	now := time.Date(2025, 12, 28, 9, 0, 0, 0, time.Local)
+	cfg := config.EventsConfig{
+		Forward: true,
+		Clients: []config.EventClient{
+			{Name: "loket", Key: "key-loket", Tasks: []int{1, 2}},
+			{Name: "poli", Key: "key-poli", Tasks: []int{4, 5}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		key           string
+		body          string
+		recorded      bool
+		wantCode      int
+		wantStatus    string
+		wantForwarded bool
+	}{
+		{
+			name:     "bad key",
+			key:      "key-apotek",
+			body:     `{"kodebooking":"KB1","taskid":1}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "no key",
+			body:     `{"kodebooking":"KB1","taskid":1}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "task the client may not report",
+			key:      "key-loket",
+			body:     `{"kodebooking":"KB1","taskid":5}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:          "first event is recorded and forwarded",
+			key:           "key-poli",
+			body:          `{"kodebooking":"KB1","taskid":5}`,
+			wantCode:      http.StatusOK,
+			wantStatus:    "recorded",
+			wantForwarded: true,
+		},
+		{
+			name:       "duplicate event is not forwarded",
+			key:        "key-poli",
+			body:       `{"kodebooking":"KB1","taskid":5}`,
+			recorded:   true,
+			wantCode:   http.StatusOK,
+			wantStatus: "duplicate",
+		},
+		{
+			name:     "unknown kodebooking",
+			key:      "key-poli",
+			body:     `{"kodebooking":"KB9","taskid":4}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "waktu in the future",
+			key:      "key-poli",
+			body:     fmt.Sprintf(`{"kodebooking":"KB1","taskid":4,"waktu":%d}`, now.Add(time.Hour).UnixMilli()),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "body too large",
+			key:      "key-poli",
+			body:     `{"kodebooking":"` + strings.Repeat("K", maxBodyBytes) + `","taskid":4}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeEvents{saved: map[string]models.TaskEvent{}}
+			if tt.recorded {
+				store.SaveTaskEvent(models.TaskEvent{KodeBooking: "KB1", TaskID: 5})
+			}
+			forwarder := &fakeForwarder{forwarded: make(chan models.TaskEvent, 1)}
+			s := &Server{db: store, repo: fakeBookings{}, cfg: cfg, forwarder: forwarder, now: func() time.Time { return now }}
+
+			r := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(tt.body))
+			if tt.key != "" {
+				r.Header.Set("X-Api-Key", tt.key)
+			}
+			w := httptest.NewRecorder()
+			s.handlePostEvent(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d (%s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Status    string `json:"status"`
+				Forwarded bool   `json:"forwarded"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.wantStatus || resp.Forwarded != tt.wantForwarded {
+				t.Errorf("response %+v, want status %s forwarded %v", resp, tt.wantStatus, tt.wantForwarded)
+			}
+			if tt.wantForwarded {
+				select {
+				case e := <-forwarder.forwarded:
+					if e.NomorReferensi != "REF1" || e.Waktu != now.UnixMilli() || e.Client != "poli" {
+						t.Errorf("forwarded %+v", e)
+					}
+				case <-time.After(time.Second):
+					t.Error("event was not forwarded")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Cancellation sources: a visit cancelled at the hospital, which GoTrol has
+// to cancel at BPJS, or one cancelled by the patient in Mobile JKN, which
+// BPJS already knows about.
+const (
+	CancelSourceSIMRS     = "simrs"
+	CancelSourceMobileJKN = "mobile_jkn"
+)
+
+// Cancellation records a booking whose visit was cancelled and what BPJS
+// answered when it was cancelled there. Task99 is the waktu of an accepted
+// Task 99, zero when none was sent.
+type Cancellation struct {
+	NomorReferensi string    `json:"nomor_referensi"`
+	KodeBooking    string    `json:"kodebooking"`
+	TanggalPeriksa string    `json:"tanggal_periksa"`
+	Source         string    `json:"source"`
+	Alasan         string    `json:"alasan"`
+	Task99         int64     `json:"task99,omitempty"`
+	BPJSCode       int       `json:"bpjs_code"`
+	Category       string    `json:"category"`
+	Message        string    `json:"message"`
+	CancelledAt    time.Time `json:"cancelled_at"`
+}
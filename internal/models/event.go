@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// TaskEvent is a task reported by a client app at the moment it happened.
+type TaskEvent struct {
+	ID             int64     `json:"id"`
+	KodeBooking    string    `json:"kodebooking"`
+	NomorReferensi string    `json:"nomor_referensi"`
+	TaskID         int       `json:"taskid"`
+	Waktu          int64     `json:"waktu"`
+	Client         string    `json:"client"`
+	ReceivedAt     time.Time `json:"received_at"`
+}
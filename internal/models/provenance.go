@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// TaskProvenance explains one task time: where it was read from, every change
+// GoTrol made to it and the value that was finally stored or sent. Row names
+// the record picked when the visit has several; Expected is the configured
+// source the task should be read from.
+type TaskProvenance struct {
+	TaskID      int              `json:"taskid"`
+	Source      string           `json:"source"`
+	Row         string           `json:"row,omitempty"`
+	Expected    string           `json:"expected,omitempty"`
+	Original    string           `json:"original,omitempty"`
+	Generated   bool             `json:"generated"`
+	Adjustments []TaskAdjustment `json:"adjustments"`
+	Final       string           `json:"final,omitempty"`
+}
+
+type TaskAdjustment struct {
+	Reason string `json:"reason"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// NewTaskAdjustment records a change from before to after. A nil after means
+// the task was cleared.
+func NewTaskAdjustment(reason string, before, after *time.Time) TaskAdjustment {
+	a := TaskAdjustment{Reason: reason}
+	if before != nil {
+		a.Before = before.Format("2006-01-02 15:04:05")
+	}
+	if after != nil {
+		a.After = after.Format("2006-01-02 15:04:05")
+	}
+	return a
+}
+
+func (p *TaskProvenance) Adjust(reason string, before, after *time.Time) {
+	p.Adjustments = append(p.Adjustments, NewTaskAdjustment(reason, before, after))
+}
+
+// AutoOrderRule is one rule of the auto order processor firing on one task.
+type AutoOrderRule struct {
+	Rule   string `json:"rule"`
+	TaskID int    `json:"taskid"`
+	Reason string `json:"reason"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// NeedsData names a task whose time has no SIMRS record behind it and the
+// unit that should have recorded it.
+type NeedsData struct {
+	TaskID int    `json:"taskid"`
+	Unit   string `json:"unit"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+// TaskViolation is a rule BPJS would reject a planned task for. Against is
+// the task it conflicts with, if any.
+type TaskViolation struct {
+	TaskID  int    `json:"taskid"`
+	Rule    string `json:"rule"`
+	Waktu   string `json:"waktu,omitempty"`
+	Against int    `json:"against,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,179 @@
+package models
+
+import "time"
+
+// Registration is one JKN visit of the day with its booking, if any, as the
+// dashboard lists it.
+type Registration struct {
+	NoPeserta      string             `json:"no_peserta"`
+	NoRKMMedis     string             `json:"no_rkm_medis"`
+	NamaPasien     string             `json:"nama_pasien"`
+	NoRawat        string             `json:"no_rawat"`
+	TglRegistrasi  string             `json:"tgl_registrasi"`
+	JamReg         string             `json:"jam_reg"`
+	NamaPoli       string             `json:"nama_poli"`
+	NamaDokter     string             `json:"nama_dokter"`
+	Penjamin       string             `json:"penjamin"`
+	NomorReferensi string             `json:"nomor_referensi"`
+	KodeBooking    string             `json:"kodebooking"`
+	StatusKirim    string             `json:"status_kirim"`
+	Tasks          []RegistrationTask `json:"tasks"`
+}
+
+type RegistrationTask struct {
+	TaskID int    `json:"task_id"`
+	Waktu  string `json:"waktu"`
+}
+
+// WalkIn is a JKN outpatient visit registered at the counter without a
+// booking, with the BPJS poli and doctor its SIMRS codes map to; those are
+// empty when the mapping is missing.
+type WalkIn struct {
+	NoRawat      string
+	NoReg        string
+	NoRkmMedis   string
+	NmPasien     string
+	Tanggal      string
+	JamReg       string
+	SttsDaftar   string
+	KdPoli       string
+	KdDokter     string
+	NoPeserta    string
+	NIK          string
+	NoTelp       string
+	KdPoliBPJS   string
+	NmPoliBPJS   string
+	KdDokterBPJS string
+	NmDokterBPJS string
+}
+
+// DoctorSession is one session of a doctor's jadwal, times as HH:MM.
+type DoctorSession struct {
+	JamMulai   string
+	JamSelesai string
+	Kuota      int
+}
+
+// SEPReferral is the referral on a visit's SEP. NoSKDP is set for a
+// control visit; AsalRujukan 2 is a referral from another hospital.
+type SEPReferral struct {
+	NoRujukan   string
+	AsalRujukan string
+	NoSKDP      string
+}
+
+// Praktek is a doctor's session looked up by its BPJS poli and doctor
+// codes: the SIMRS codes, the BPJS names, and its start as HH:MM.
+type Praktek struct {
+	KdPoli   string
+	NmPoli   string
+	KdDokter string
+	NmDokter string
+	JamMulai string
+	Kuota    int
+}
+
+// QueueCount is one doctor's queue of the day without cancelled visits.
+// Dipanggil is the highest no_reg already served.
+type QueueCount struct {
+	Total     int
+	Sisa      int
+	JKN       int
+	Dipanggil int
+}
+
+// Pasien is what a booking copies from the patient record.
+type Pasien struct {
+	NoRkmMedis   string
+	TglLahir     time.Time
+	NamaKeluarga string
+	AlamatPJ     string
+	Keluarga     string
+}
+
+// NewBooking is a Mobile JKN booking to register as a visit. JamReg is
+// HH:MM:SS and JamMulai the HH:MM start of the session; an empty
+// NomorReferensi becomes the kodebooking. KodePoli, KodeDokter and
+// JamPraktek are the BPJS codes of the request.
+type NewBooking struct {
+	TanggalPeriksa    string
+	JamReg            string
+	JamMulai          string
+	Pasien            Pasien
+	KdPoli            string
+	KdDokter          string
+	Kuota             int
+	KdPj              string
+	Umur              int
+	SttsUmur          string
+	NomorKartu        string
+	NIK               string
+	NoHP              string
+	KodePoli          string
+	KodeDokter        int
+	JamPraktek        string
+	NomorReferensi    string
+	JenisKunjungan    int
+	MinutesPerPatient int
+	Keterangan        string
+}
+
+// BookedVisit is the visit a NewBooking was registered as. Count is the
+// queue before it was added; Estimasi is when the patient should be seen,
+// in milliseconds.
+type BookedVisit struct {
+	NoRawat     string
+	KodeBooking string
+	NoReg       int
+	Estimasi    int64
+	Count       QueueCount
+}
+
+// Booking is a Mobile JKN booking joined to its visit. KodePoli, NmPoli and
+// NmDokter are the BPJS codes and names of the visit's poli and doctor.
+type Booking struct {
+	NomorReferensi string
+	NoRawat        string
+	NoRkmMedis     string
+	Tanggal        string
+	KdPoli         string
+	KdDokter       string
+	NoReg          int
+	Stts           string
+	KodePoli       string
+	NmPoli         string
+	NmDokter       string
+}
+
+// NewPasien is a patient Mobile JKN registers before their first booking.
+type NewPasien struct {
+	NomorKartu   string
+	NIK          string
+	Nama         string
+	JenisKelamin string
+	TanggalLahir string
+	NoHP         string
+	Alamat       string
+	NamaProp     string
+	NamaDati2    string
+	NamaKec      string
+	NamaKel      string
+	RW           string
+	RT           string
+	Umur         int
+	SttsUmur     string
+	KdPj         string
+	TglDaftar    string
+}
+
+// JadwalOperasi is a surgery booked for a visit. NoPeserta is the patient's
+// BPJS card number.
+type JadwalOperasi struct {
+	KodeBooking    string
+	TanggalOperasi string
+	JenisTindakan  string
+	KodePoli       string
+	NamaPoli       string
+	Terlaksana     bool
+	NoPeserta      string
+}
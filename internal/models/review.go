@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+	ReviewSent     = "sent"
+)
+
+// Reasons an entry is parked for review.
+const (
+	ReviewReasonAutoOrder        = "auto_order"
+	ReviewReasonMissingData      = "missing_data"
+	ReviewReasonOrderingRejected = "ordering_rejected"
+	ReviewReasonInvalidPlan      = "invalid_plan"
+)
+
+// ReviewEntry is an entry parked until a supervisor decides on it. Tasks hold
+// the times that will be sent once it is approved.
+type ReviewEntry struct {
+	ID             int64            `json:"id"`
+	NomorReferensi string           `json:"nomor_referensi"`
+	KodeBooking    string           `json:"kodebooking"`
+	NoRkmMedis     string           `json:"no_rkm_medis"`
+	NamaPasien     string           `json:"nama_pasien"`
+	NoRawat        string           `json:"no_rawat"`
+	Tanggal        string           `json:"tanggal"`
+	Reasons        []string         `json:"reasons"`
+	Message        string           `json:"message,omitempty"`
+	Tasks          []ReviewTask     `json:"tasks"`
+	Status         string           `json:"status"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	Decisions      []ReviewDecision `json:"decisions,omitempty"`
+}
+
+type ReviewTask struct {
+	TaskID     int             `json:"taskid"`
+	Waktu      string          `json:"waktu"`
+	Payload    json.RawMessage `json:"payload"`
+	Provenance TaskProvenance  `json:"provenance"`
+}
+
+// ReviewDecision is one approve, edit or reject by a named reviewer. Edits
+// maps task IDs to the waktu the reviewer set.
+type ReviewDecision struct {
+	ID        int64          `json:"id"`
+	ReviewID  int64          `json:"review_id"`
+	Decision  string         `json:"decision"`
+	Reviewer  string         `json:"reviewer"`
+	Reason    string         `json:"reason,omitempty"`
+	Edits     map[int]string `json:"edits,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type AntrianReferensi struct {
 	TanggalPeriksa string
@@ -14,6 +17,7 @@ type AntrianReferensi struct {
 	NamaPasien     string
 	NoRawat        string
 	PngJawab       string
+	KdPoli         string
 	NamaPoli       string
 }
 
@@ -46,6 +50,11 @@ type ProcessResult struct {
 	UpdateWaktuDone bool
 	ProcessedAt     time.Time
 	Tasks           map[int]TaskResult
+	AutoOrderRules  []AutoOrderRule `json:",omitempty"`
+	NeedsData       []NeedsData     `json:",omitempty"`
+	Violations      []TaskViolation `json:",omitempty"`
+	Review          string          `json:",omitempty"`
+	Cancellation    *Cancellation   `json:",omitempty"`
 	Error           string
 }
 
@@ -53,7 +62,9 @@ type TaskResult struct {
 	Waktu      string
 	BPJSStatus string
 	BPJSCode   int
+	Category   string
 	Message    string
+	Provenance *TaskProvenance `json:",omitempty"`
 }
 
 type ReportSummary struct {
@@ -61,6 +72,7 @@ type ReportSummary struct {
 	TotalProcessed    int `json:"total_processed"`
 	TotalSuccessSent  int `json:"total_success_sent"`
 	TotalFailed       int `json:"total_failed"`
+	TotalCancelled    int `json:"total_cancelled"`
 	TotalPending      int `json:"total_pending"`
 }
 
@@ -70,6 +82,85 @@ type DailyReport struct {
 	TotalProcessed    int             `json:"total_processed"`
 	TotalSuccessSent  int             `json:"total_success_sent"`
 	TotalFailed       int             `json:"total_failed"`
+	TotalCancelled    int             `json:"total_cancelled"`
 	TotalPending      int             `json:"total_pending"`
 	Items             []ProcessResult `json:"items"`
 }
+
+type ReconcileDiff struct {
+	NomorReferensi string `json:"nomor_referensi"`
+	KodeBooking    string `json:"kodebooking"`
+	NoRkmMedis     string `json:"no_rkm_medis"`
+	NamaPasien     string `json:"nama_pasien"`
+	TaskID         int    `json:"task_id"`
+	LocalStatus    string `json:"local_status"`
+	LocalWaktu     string `json:"local_waktu"`
+	BPJSWaktu      string `json:"bpjs_waktu"`
+	ReportStatus   string `json:"report_status"`
+	Fixed          bool   `json:"fixed"`
+}
+
+type ReconcileReport struct {
+	Date           string          `json:"date"`
+	TotalChecked   int             `json:"total_checked"`
+	MissingOnBPJS  []ReconcileDiff `json:"missing_on_bpjs"`
+	BelumButOnBPJS []ReconcileDiff `json:"belum_but_on_bpjs"`
+	TimeMismatch   []ReconcileDiff `json:"time_mismatch"`
+	Errors         []string        `json:"errors"`
+}
+
+// BPJSAttempt is one HTTP exchange with BPJS, including every retry, as
+// kept in the outbound request journal.
+type BPJSAttempt struct {
+	Time           time.Time         `json:"time"`
+	NomorReferensi string            `json:"nomor_referensi,omitempty"`
+	TaskID         int               `json:"task_id,omitempty"`
+	Method         string            `json:"method"`
+	Endpoint       string            `json:"endpoint"`
+	Attempt        int               `json:"attempt"`
+	RequestHeaders map[string]string `json:"request_headers"`
+	RequestBody    string            `json:"request_body,omitempty"`
+	HTTPStatus     int               `json:"http_status,omitempty"`
+	Code           int               `json:"code,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	Category       string            `json:"category,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	LatencyMs      int64             `json:"latency_ms"`
+}
+
+// DryRunReport previews what a batch run would write and send without
+// touching MySQL or BPJS.
+type DryRunReport struct {
+	Mode    string        `json:"mode"`
+	Date    string        `json:"date"`
+	Entries []DryRunEntry `json:"entries"`
+	Errors  []string      `json:"errors"`
+}
+
+type DryRunEntry struct {
+	NomorReferensi string          `json:"nomor_referensi"`
+	KodeBooking    string          `json:"kodebooking"`
+	NoRkmMedis     string          `json:"no_rkm_medis"`
+	NamaPasien     string          `json:"nama_pasien"`
+	Skipped        string          `json:"skipped,omitempty"`
+	NeedsData      []NeedsData     `json:"needs_data,omitempty"`
+	Violations     []TaskViolation `json:"violations,omitempty"`
+	AutoOrderRules []AutoOrderRule `json:"auto_order_rules"`
+	Tasks          []DryRunTask    `json:"tasks"`
+	// Payload is the antrean/add request of a walk-in visit.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type DryRunTask struct {
+	TaskID      int             `json:"taskid"`
+	Source      string          `json:"source,omitempty"`
+	Original    string          `json:"original,omitempty"`
+	Waktu       string          `json:"waktu"`
+	Generated   bool            `json:"generated"`
+	LocalStatus string          `json:"local_status,omitempty"`
+	Write       bool            `json:"write"`
+	Replaces    string          `json:"replaces,omitempty"`
+	Send        bool            `json:"send"`
+	Skip        string          `json:"skip,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
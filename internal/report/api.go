@@ -10,22 +10,30 @@ import (
 	"sync"
 	"time"
 
+	"gotrol/internal/config"
 	"gotrol/internal/database"
 	"gotrol/internal/models"
 )
 
 type APIServer struct {
-	store  *Store
-	db     *database.MySQL
-	port   int
-	server *http.Server
+	store     *Store
+	db        *database.MySQL
+	repo      database.Repository
+	port      int
+	reviewers []config.Reviewer
+	server    *http.Server
 }
 
-func NewAPIServer(store *Store, db *database.MySQL, port int) *APIServer {
+func NewAPIServer(store *Store, db *database.MySQL, repo database.Repository, port int, reviewers []config.Reviewer) *APIServer {
+	if len(reviewers) == 0 {
+		log.Println("   ├── api.reviewers not set, review decisions are refused")
+	}
 	return &APIServer{
-		store: store,
-		db:    db,
-		port:  port,
+		store:     store,
+		db:        db,
+		repo:      repo,
+		port:      port,
+		reviewers: reviewers,
 	}
 }
 
@@ -39,6 +47,13 @@ func (a *APIServer) Start() error {
 	mux.HandleFunc("/api/stats/overview", a.handleStatsOverview)
 	mux.HandleFunc("/api/patients/monthly", a.handlePatientsMonthly)
 	mux.HandleFunc("/api/patients/registration", a.handlePatientsRegistration)
+	mux.HandleFunc("/api/needs-data", a.handleNeedsData)
+	mux.HandleFunc("/api/cancellations", a.handleCancellations)
+	mux.HandleFunc("GET /api/reviews", a.handleReviews)
+	mux.HandleFunc("GET /api/reviews/{id}", a.handleReview)
+	mux.HandleFunc("POST /api/reviews/{id}/{action}", a.handleReviewDecision)
+	mux.HandleFunc("/api/entries/{nomor_referensi}/attempts", a.handleEntryAttempts)
+	mux.HandleFunc("/api/entries/{nomor_referensi}/provenance", a.handleEntryProvenance)
 
 	fs := http.FileServer(http.Dir("web"))
 	mux.Handle("/", fs)
@@ -138,7 +153,7 @@ func (a *APIServer) getReportByDate(w http.ResponseWriter, r *http.Request, date
 
 	paginatedResults := filteredResults[start:end]
 
-	processed, success, failed, _ := a.store.GetSummaryByDate(date)
+	processed, success, failed, cancelled, _ := a.store.GetSummaryByDate(date)
 
 	response := map[string]interface{}{
 		"date":                date,
@@ -146,6 +161,7 @@ func (a *APIServer) getReportByDate(w http.ResponseWriter, r *http.Request, date
 		"total_processed":     processed,
 		"total_success_sent":  success,
 		"total_failed":        failed,
+		"total_cancelled":     cancelled,
 		"total_pending":       totalBPJS - processed,
 		"items":               paginatedResults,
 		"pagination": map[string]interface{}{
@@ -180,16 +196,19 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 		todayProcessed int
 		todaySuccess   int
 		todayFailed    int
+		todayCancelled int
 
 		weekBPJS      int
 		weekProcessed int
 		weekSuccess   int
 		weekFailed    int
+		weekCancelled int
 
 		monthBPJS      int
 		monthProcessed int
 		monthSuccess   int
 		monthFailed    int
+		monthCancelled int
 	)
 
 	wg.Add(3)
@@ -197,7 +216,7 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 	go func() {
 		defer wg.Done()
 		todayBPJS = a.getTotalBPJSPatients(todayStr)
-		todayProcessed, todaySuccess, todayFailed, _ = a.store.GetSummaryByDate(todayStr)
+		todayProcessed, todaySuccess, todayFailed, todayCancelled, _ = a.store.GetSummaryByDate(todayStr)
 	}()
 
 	go func() {
@@ -205,7 +224,7 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 		start := weekStart.Format("2006-01-02")
 		log.Printf("DEBUG: Week Range: %s to %s", start, todayStr)
 		weekBPJS = a.getTotalBPJSPatientsRange(start, todayStr)
-		weekProcessed, weekSuccess, weekFailed, _ = a.store.GetSummaryByDateRange(start, todayStr)
+		weekProcessed, weekSuccess, weekFailed, weekCancelled, _ = a.store.GetSummaryByDateRange(start, todayStr)
 		log.Printf("DEBUG: Week Stats: BPJS=%d, Proc=%d, Succ=%d", weekBPJS, weekProcessed, weekSuccess)
 	}()
 
@@ -214,7 +233,7 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 		start := monthStart.Format("2006-01-02")
 		log.Printf("DEBUG: Month Range: %s to %s", start, todayStr)
 		monthBPJS = a.getTotalBPJSPatientsRange(start, todayStr)
-		monthProcessed, monthSuccess, monthFailed, _ = a.store.GetSummaryByDateRange(start, todayStr)
+		monthProcessed, monthSuccess, monthFailed, monthCancelled, _ = a.store.GetSummaryByDateRange(start, todayStr)
 		log.Printf("DEBUG: Month Stats: BPJS=%d, Proc=%d, Succ=%d", monthBPJS, monthProcessed, monthSuccess)
 	}()
 
@@ -226,6 +245,7 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 			TotalProcessed:    todayProcessed,
 			TotalSuccessSent:  todaySuccess,
 			TotalFailed:       todayFailed,
+			TotalCancelled:    todayCancelled,
 			TotalPending:      todayBPJS - todayProcessed,
 		},
 		"this_week": {
@@ -233,6 +253,7 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 			TotalProcessed:    weekProcessed,
 			TotalSuccessSent:  weekSuccess,
 			TotalFailed:       weekFailed,
+			TotalCancelled:    weekCancelled,
 			TotalPending:      weekBPJS - weekProcessed,
 		},
 		"this_month": {
@@ -240,6 +261,7 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 			TotalProcessed:    monthProcessed,
 			TotalSuccessSent:  monthSuccess,
 			TotalFailed:       monthFailed,
+			TotalCancelled:    monthCancelled,
 			TotalPending:      monthBPJS - monthProcessed,
 		},
 	}
@@ -248,32 +270,14 @@ func (a *APIServer) handleReportsSummary(w http.ResponseWriter, r *http.Request)
 }
 
 func (a *APIServer) getTotalBPJSPatients(date string) int {
-	var count int
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT mar.nomor_referensi)
-		FROM mlite_antrian_referensi mar
-		JOIN reg_periksa rp ON mar.no_rkm_medis = rp.no_rkm_medis 
-			AND mar.tanggal_periksa = rp.tgl_registrasi
-		JOIN penjab pj ON rp.kd_pj = pj.kd_pj
-		WHERE mar.tanggal_periksa = ?
-			AND mar.kodebooking != ''
-			AND rp.kd_pj = 'BPJ'
-	`, date).Scan(&count)
-	return count
+	return a.getTotalBPJSPatientsRange(date, date)
 }
 
 func (a *APIServer) getTotalBPJSPatientsRange(startDate, endDate string) int {
-	var count int
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT mar.nomor_referensi)
-		FROM mlite_antrian_referensi mar
-		JOIN reg_periksa rp ON mar.no_rkm_medis = rp.no_rkm_medis 
-			AND mar.tanggal_periksa = rp.tgl_registrasi
-		JOIN penjab pj ON rp.kd_pj = pj.kd_pj
-		WHERE mar.tanggal_periksa BETWEEN ? AND ?
-			AND mar.kodebooking != ''
-			AND rp.kd_pj = 'BPJ'
-	`, startDate, endDate).Scan(&count)
+	count, err := a.repo.CountBookings(startDate, endDate, "")
+	if err != nil {
+		log.Printf("ERROR counting bookings: %v", err)
+	}
 	return count
 }
 
@@ -285,52 +289,12 @@ func (a *APIServer) handleStatsOverview(w http.ResponseWriter, r *http.Request)
 		date = time.Now().Format("2006-01-02")
 	}
 
-	var totalBPJS, statusSudah, statusBelum, taskSent int
-
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT mar.nomor_referensi)
-		FROM mlite_antrian_referensi mar
-		JOIN reg_periksa rp ON mar.no_rkm_medis = rp.no_rkm_medis 
-AND DATE(rp.tgl_registrasi) = mar.tanggal_periksa
-		JOIN penjab pj ON rp.kd_pj = pj.kd_pj
-		WHERE mar.tanggal_periksa = ?
-			AND mar.kodebooking != ''
-			AND rp.kd_pj = 'BPJ'
-	`, date).Scan(&totalBPJS)
-
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT mar.nomor_referensi)
-		FROM mlite_antrian_referensi mar
-		JOIN reg_periksa rp ON mar.no_rkm_medis = rp.no_rkm_medis 
-AND DATE(rp.tgl_registrasi) = mar.tanggal_periksa
-		JOIN penjab pj ON rp.kd_pj = pj.kd_pj
-		WHERE mar.tanggal_periksa = ?
-			AND mar.kodebooking != ''
-			AND rp.kd_pj = 'BPJ'
-			AND mar.status_kirim = 'Sudah'
-	`, date).Scan(&statusSudah)
-
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT mar.nomor_referensi)
-		FROM mlite_antrian_referensi mar
-		JOIN reg_periksa rp ON mar.no_rkm_medis = rp.no_rkm_medis 
-AND DATE(rp.tgl_registrasi) = mar.tanggal_periksa
-		JOIN penjab pj ON rp.kd_pj = pj.kd_pj
-		WHERE mar.tanggal_periksa = ?
-			AND mar.kodebooking != ''
-			AND rp.kd_pj = 'BPJ'
-			AND (mar.status_kirim = 'Belum' OR mar.status_kirim IS NULL OR mar.status_kirim = '')
-	`, date).Scan(&statusBelum)
-
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT t.nomor_referensi)
-		FROM mlite_antrian_referensi_taskid t
-		WHERE t.tanggal_periksa = ?
-			AND t.taskid = 5
-			AND t.status = 'Sudah'
-	`, date).Scan(&taskSent)
-
-	gotrolProcessed, gotrolSuccess, gotrolFailed, _ := a.store.GetSummaryByDate(date)
+	totalBPJS, _ := a.repo.CountBookings(date, date, "")
+	statusSudah, _ := a.repo.CountBookings(date, date, database.BookingSent)
+	statusBelum, _ := a.repo.CountBookings(date, date, database.BookingNotSent)
+	taskSent, _ := a.repo.CountTaskSent(date, 5)
+
+	gotrolProcessed, gotrolSuccess, gotrolFailed, gotrolCancelled, _ := a.store.GetSummaryByDate(date)
 
 	response := map[string]interface{}{
 		"date": date,
@@ -353,6 +317,7 @@ AND DATE(rp.tgl_registrasi) = mar.tanggal_periksa
 			"processed": gotrolProcessed,
 			"success":   gotrolSuccess,
 			"failed":    gotrolFailed,
+			"cancelled": gotrolCancelled,
 		},
 	}
 
@@ -385,34 +350,12 @@ func (a *APIServer) handlePatientsMonthly(w http.ResponseWriter, r *http.Request
 
 	log.Printf("DEBUG Monthly API: Querying %s to %s", startStr, endStr)
 
-	var totalPatients int
-	err := a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT nomor_referensi)
-		FROM mlite_antrian_referensi
-		WHERE tanggal_periksa BETWEEN ? AND ?
-			AND kodebooking != ''
-	`, startStr, endStr).Scan(&totalPatients)
+	totalPatients, err := a.repo.CountBookings(startStr, endStr, "")
 	if err != nil {
 		log.Printf("DEBUG Monthly API - Total error: %v", err)
 	}
-
-	var statusSudah int
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT nomor_referensi)
-		FROM mlite_antrian_referensi
-		WHERE tanggal_periksa BETWEEN ? AND ?
-			AND kodebooking != ''
-			AND status_kirim = 'Sudah'
-	`, startStr, endStr).Scan(&statusSudah)
-
-	var statusBelum int
-	a.db.DB.QueryRow(`
-		SELECT COUNT(DISTINCT nomor_referensi)
-		FROM mlite_antrian_referensi
-		WHERE tanggal_periksa BETWEEN ? AND ?
-			AND kodebooking != ''
-			AND (status_kirim = 'Belum' OR status_kirim IS NULL OR status_kirim = '')
-	`, startStr, endStr).Scan(&statusBelum)
+	statusSudah, _ := a.repo.CountBookings(startStr, endStr, database.BookingSent)
+	statusBelum, _ := a.repo.CountBookings(startStr, endStr, database.BookingNotSent)
 
 	log.Printf("DEBUG Monthly API Result: Total=%d, Sudah=%d, Belum=%d", totalPatients, statusSudah, statusBelum)
 
@@ -459,127 +402,12 @@ func (a *APIServer) handlePatientsRegistration(w http.ResponseWriter, r *http.Re
 
 	log.Printf("DEBUG Registration API: date=%s, page=%d, limit=%d, search=%s", date, page, limit, searchQuery)
 
-	baseQuery := `
-		FROM reg_periksa 
-		INNER JOIN pasien ON reg_periksa.no_rkm_medis = pasien.no_rkm_medis 
-		INNER JOIN dokter ON reg_periksa.kd_dokter = dokter.kd_dokter 
-		INNER JOIN poliklinik ON reg_periksa.kd_poli = poliklinik.kd_poli 
-		INNER JOIN penjab ON reg_periksa.kd_pj = penjab.kd_pj 
-		LEFT JOIN mlite_antrian_referensi mar ON mar.no_rkm_medis = pasien.no_rkm_medis 
-			AND mar.tanggal_periksa = reg_periksa.tgl_registrasi
-		WHERE reg_periksa.tgl_registrasi = ?
-			AND reg_periksa.kd_pj = 'BPJ'
-	`
-
-	args := []interface{}{date}
-
-	if searchQuery != "" {
-		baseQuery += ` AND (pasien.nm_pasien LIKE ? OR pasien.no_rkm_medis LIKE ? OR COALESCE(mar.nomor_referensi, '') LIKE ?)`
-		searchPattern := "%" + searchQuery + "%"
-		args = append(args, searchPattern, searchPattern, searchPattern)
-	}
-
-	countQuery := "SELECT COUNT(*) " + baseQuery
-	var totalItems int
-	if err := a.db.DB.QueryRow(countQuery, args...).Scan(&totalItems); err != nil {
-		log.Printf("ERROR Registration count query: %v", err)
-		totalItems = 0
-	}
-
-	query := `
-		SELECT 
-			pasien.no_peserta,
-			pasien.no_rkm_medis,
-			pasien.nm_pasien,
-			reg_periksa.no_rawat,
-			reg_periksa.tgl_registrasi,
-			reg_periksa.jam_reg,
-			poliklinik.nm_poli,
-			dokter.nm_dokter,
-			penjab.png_jawab,
-			COALESCE(mar.nomor_referensi, '') as nomor_referensi,
-			COALESCE(mar.kodebooking, '') as kodebooking,
-			COALESCE(mar.status_kirim, '') as status_kirim
-	` + baseQuery + `
-		ORDER BY reg_periksa.jam_reg ASC
-		LIMIT ? OFFSET ?
-	`
-
-	offset := (page - 1) * limit
-	paginatedArgs := append(args, limit, offset)
-
-	rows, err := a.db.DB.Query(query, paginatedArgs...)
+	patients, totalItems, err := a.repo.Registrations(date, searchQuery, limit, (page-1)*limit)
 	if err != nil {
 		log.Printf("ERROR Registration query: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	type TaskTime struct {
-		TaskID int    `json:"task_id"`
-		Waktu  string `json:"waktu"`
-	}
-
-	type PatientReg struct {
-		NoPeserta      string     `json:"no_peserta"`
-		NoRKMMedis     string     `json:"no_rkm_medis"`
-		NamaPasien     string     `json:"nama_pasien"`
-		NoRawat        string     `json:"no_rawat"`
-		TglRegistrasi  string     `json:"tgl_registrasi"`
-		JamReg         string     `json:"jam_reg"`
-		NamaPoli       string     `json:"nama_poli"`
-		NamaDokter     string     `json:"nama_dokter"`
-		Penjamin       string     `json:"penjamin"`
-		NomorReferensi string     `json:"nomor_referensi"`
-		KodeBooking    string     `json:"kodebooking"`
-		StatusKirim    string     `json:"status_kirim"`
-		Tasks          []TaskTime `json:"tasks"`
-	}
-
-	var patients []PatientReg
-
-	for rows.Next() {
-		var p PatientReg
-		var jamReg []byte
-		err := rows.Scan(
-			&p.NoPeserta, &p.NoRKMMedis, &p.NamaPasien, &p.NoRawat,
-			&p.TglRegistrasi, &jamReg, &p.NamaPoli, &p.NamaDokter,
-			&p.Penjamin, &p.NomorReferensi, &p.KodeBooking, &p.StatusKirim,
-		)
-		if err != nil {
-			log.Printf("ERROR scan: %v", err)
-			continue
-		}
-		p.JamReg = string(jamReg)
-
-		if p.NomorReferensi != "" {
-			taskRows, err := a.db.DB.Query(`
-				SELECT taskid, waktu 
-				FROM mlite_antrian_referensi_taskid 
-				WHERE nomor_referensi = ? 
-				ORDER BY taskid
-			`, p.NomorReferensi)
-			if err == nil {
-				defer taskRows.Close()
-				for taskRows.Next() {
-					var taskID int
-					var waktuMs int64
-					if err := taskRows.Scan(&taskID, &waktuMs); err == nil {
-
-						waktuStr := ""
-						if waktuMs > 0 {
-							t := time.Unix(waktuMs/1000, (waktuMs%1000)*1000000)
-							waktuStr = t.Format("15:04:05")
-						}
-						p.Tasks = append(p.Tasks, TaskTime{TaskID: taskID, Waktu: waktuStr})
-					}
-				}
-			}
-		}
-
-		patients = append(patients, p)
-	}
 
 	log.Printf("DEBUG Registration Result: total=%d patients (page %d)", len(patients), page)
 
@@ -602,3 +430,107 @@ func (a *APIServer) handlePatientsRegistration(w http.ResponseWriter, r *http.Re
 
 	json.NewEncoder(w).Encode(response)
 }
+
+func (a *APIServer) handleEntryAttempts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	nomorReferensi := r.PathValue("nomor_referensi")
+	date := r.URL.Query().Get("date")
+
+	attempts, err := a.store.GetAttempts(nomorReferensi, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"nomor_referensi": nomorReferensi,
+		"total":           len(attempts),
+		"attempts":        attempts,
+	})
+}
+
+func (a *APIServer) handleEntryProvenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	nomorReferensi := r.PathValue("nomor_referensi")
+	byTask, err := a.db.GetTaskProvenance(nomorReferensi)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tasks := []models.TaskProvenance{}
+	for taskID := 1; taskID <= 7; taskID++ {
+		if p, ok := byTask[taskID]; ok {
+			tasks = append(tasks, p)
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"nomor_referensi": nomorReferensi,
+		"tasks":           tasks,
+	})
+}
+
+func (a *APIServer) handleNeedsData(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	held, err := a.store.GetNeedsData(date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	byUnit := make(map[string]int)
+	for _, res := range held {
+		seen := make(map[string]bool)
+		for _, n := range res.NeedsData {
+			if !seen[n.Unit] {
+				seen[n.Unit] = true
+				byUnit[n.Unit]++
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"date":    date,
+		"total":   len(held),
+		"by_unit": byUnit,
+		"items":   held,
+	})
+}
+
+// handleCancellations lists the cancelled bookings of a date with the BPJS
+// answer to antrean/batal, grouped by where the visit was cancelled.
+func (a *APIServer) handleCancellations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+
+	cancels, err := a.db.GetCancellations(date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bySource := make(map[string]int)
+	for _, c := range cancels {
+		bySource[c.Source]++
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"date":      date,
+		"total":     len(cancels),
+		"by_source": bySource,
+		"items":     cancels,
+	})
+}
@@ -0,0 +1,47 @@
+package report
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotrol/internal/models"
+)
+
+func TestHandleNeedsData(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "gotrol.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SaveResult(models.ProcessResult{
+		NomorReferensi: "REF1",
+		ProcessedAt:    time.Date(2025, 12, 28, 9, 0, 0, 0, time.Local),
+		NeedsData:      []models.NeedsData{{TaskID: 5, Unit: "poli"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The day's file is a directory, so it cannot be read.
+	if err := os.Mkdir(filepath.Join(store.basePath, "2025-12-29.json"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	a := &APIServer{store: store}
+
+	tests := []struct {
+		date string
+		want int
+	}{
+		{"2025-12-28", http.StatusOK},
+		{"2025-12-29", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		a.handleNeedsData(w, httptest.NewRequest(http.MethodGet, "/api/needs-data?date="+tt.date, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: code = %d, want %d (%s)", tt.date, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
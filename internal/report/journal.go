@@ -0,0 +1,92 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gotrol/internal/models"
+)
+
+// The journal is one JSON line per BPJS attempt, in a file per day. Lines
+// are only ever appended, so it still holds the retries that the daily
+// report overwrites.
+
+func (s *Store) journalDir() string {
+	return filepath.Join(s.basePath, "journal")
+}
+
+func (s *Store) RecordAttempt(attempt models.BPJSAttempt) error {
+	line, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+
+	s.journalMu.Lock()
+	defer s.journalMu.Unlock()
+
+	if err := os.MkdirAll(s.journalDir(), 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.journalDir(), attempt.Time.Format("2006-01-02")+".jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// GetAttempts returns every journaled attempt for nomorReferensi, oldest
+// first. An empty date searches the whole journal.
+func (s *Store) GetAttempts(nomorReferensi, date string) ([]models.BPJSAttempt, error) {
+	s.journalMu.Lock()
+	defer s.journalMu.Unlock()
+
+	var files []string
+	if date != "" {
+		files = []string{filepath.Join(s.journalDir(), date+".jsonl")}
+	} else {
+		matches, err := filepath.Glob(filepath.Join(s.journalDir(), "*.jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = matches
+	}
+
+	attempts := []models.BPJSAttempt{}
+	needle := `"nomor_referensi":"` + nomorReferensi + `"`
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.Contains(line, needle) {
+				continue
+			}
+			var a models.BPJSAttempt
+			if err := json.Unmarshal([]byte(line), &a); err == nil && a.NomorReferensi == nomorReferensi {
+				attempts = append(attempts, a)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return attempts, nil
+}
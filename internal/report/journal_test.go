@@ -0,0 +1,75 @@
+package report
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotrol/internal/models"
+)
+
+func TestJournalRoundTrip(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "gotrol.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day1 := time.Date(2025, 12, 28, 8, 0, 0, 0, time.Local)
+	day2 := time.Date(2025, 12, 29, 8, 0, 0, 0, time.Local)
+
+	// Recorded out of day order: the journal keeps append order within a
+	// day and day order across files.
+	recorded := []models.BPJSAttempt{
+		{Time: day2, NomorReferensi: "REF1", TaskID: 3, Attempt: 1, Code: 200},
+		{Time: day1, NomorReferensi: "REF1", TaskID: 1, Attempt: 1, Code: 201, Message: "timeout"},
+		{Time: day1.Add(time.Minute), NomorReferensi: "REF10", TaskID: 1, Attempt: 1, Code: 200},
+		{Time: day1.Add(2 * time.Minute), NomorReferensi: "REF1", TaskID: 1, Attempt: 2, Code: 200},
+		{Time: day1.Add(3 * time.Minute), NomorReferensi: "REF2", TaskID: 1, Attempt: 1, Code: 200},
+	}
+	for _, a := range recorded {
+		if err := store.RecordAttempt(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type key struct {
+		taskID, attempt int
+	}
+	tests := []struct {
+		name           string
+		nomorReferensi string
+		date           string
+		want           []key
+	}{
+		{"all days", "REF1", "", []key{{1, 1}, {1, 2}, {3, 1}}},
+		{"one day", "REF1", "2025-12-28", []key{{1, 1}, {1, 2}}},
+		{"other day", "REF1", "2025-12-29", []key{{3, 1}}},
+		{"longer referensi", "REF10", "", []key{{1, 1}}},
+		{"no journal that day", "REF1", "2025-12-30", nil},
+		{"unknown referensi", "REF3", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.GetAttempts(tt.nomorReferensi, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || len(got) != len(tt.want) {
+				t.Fatalf("got %d attempts %+v, want %v", len(got), got, tt.want)
+			}
+			for i, a := range got {
+				if a.NomorReferensi != tt.nomorReferensi || a.TaskID != tt.want[i].taskID || a.Attempt != tt.want[i].attempt {
+					t.Errorf("attempt %d = %s task %d #%d, want task %d #%d",
+						i, a.NomorReferensi, a.TaskID, a.Attempt, tt.want[i].taskID, tt.want[i].attempt)
+				}
+			}
+		})
+	}
+
+	got, err := store.GetAttempts("REF1", "2025-12-28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Message != "timeout" || !got[0].Time.Equal(day1) {
+		t.Errorf("first attempt = %+v, fields lost in the round trip", got[0])
+	}
+}
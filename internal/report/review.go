@@ -0,0 +1,219 @@
+package report
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+type reviewRequest struct {
+	Reviewer string         `json:"-"`
+	Reason   string         `json:"reason"`
+	Tasks    map[int]string `json:"tasks"`
+}
+
+func (a *APIServer) handleReviews(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := r.URL.Query().Get("status")
+	date := r.URL.Query().Get("date")
+
+	reviews, err := a.db.ListReviews(status, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"date":   date,
+		"total":  len(reviews),
+		"items":  reviews,
+	})
+}
+
+func (a *APIServer) handleReview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid review id", http.StatusBadRequest)
+		return
+	}
+	review, err := a.db.GetReviewByID(id)
+	if err != nil {
+		reviewError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(review)
+}
+
+// reviewer returns the name of the configured reviewer whose key is in
+// X-Api-Key, or "" when there is none.
+func (a *APIServer) reviewer(r *http.Request) string {
+	key := r.Header.Get("X-Api-Key")
+	if key == "" {
+		return ""
+	}
+	for _, rv := range a.reviewers {
+		if rv.Key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(rv.Key)) == 1 {
+			return rv.Name
+		}
+	}
+	return ""
+}
+
+// handleReviewDecision approves, edits or rejects a pending review on behalf
+// of the reviewer the key belongs to. Edits need a reason and are applied to
+// the proposal before it is approved.
+func (a *APIServer) handleReviewDecision(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	reviewer := a.reviewer(r)
+	if reviewer == "" {
+		http.Error(w, "invalid or missing X-Api-Key", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid review id", http.StatusBadRequest)
+		return
+	}
+
+	var req reviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reviewer = reviewer
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	decision := models.ReviewDecision{
+		ReviewID: id,
+		Decision: r.PathValue("action"),
+		Reviewer: req.Reviewer,
+		Reason:   req.Reason,
+	}
+	var (
+		status string
+		tasks  []models.ReviewTask
+	)
+	switch decision.Decision {
+	case "approve":
+		status = models.ReviewApproved
+	case "reject":
+		status = models.ReviewRejected
+	case "edit":
+		if req.Reason == "" {
+			http.Error(w, "reason is required for an edit", http.StatusBadRequest)
+			return
+		}
+		if len(req.Tasks) == 0 {
+			http.Error(w, "no task times to edit", http.StatusBadRequest)
+			return
+		}
+		review, err := a.db.GetReviewByID(id)
+		if err != nil {
+			reviewError(w, err)
+			return
+		}
+		tasks, err = editReviewTasks(review, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status = models.ReviewApproved
+		decision.Edits = req.Tasks
+	default:
+		http.Error(w, "unknown action", http.StatusNotFound)
+		return
+	}
+
+	if err := a.db.DecideReview(decision, status, tasks); err != nil {
+		reviewError(w, err)
+		return
+	}
+
+	review, err := a.db.GetReviewByID(id)
+	if err != nil {
+		reviewError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(review)
+}
+
+// editReviewTasks applies the edited times to a copy of the proposal and
+// checks the result still runs forward from task to task.
+func editReviewTasks(review *models.ReviewEntry, req reviewRequest) ([]models.ReviewTask, error) {
+	tasks := make([]models.ReviewTask, len(review.Tasks))
+	copy(tasks, review.Tasks)
+
+	byID := make(map[int]int)
+	for i, t := range tasks {
+		byID[t.TaskID] = i
+	}
+
+	reason := "edited in review by " + req.Reviewer + ": " + req.Reason
+	for taskID, waktu := range req.Tasks {
+		i, ok := byID[taskID]
+		if !ok {
+			return nil, errors.New("task " + strconv.Itoa(taskID) + " is not part of this review")
+		}
+		after, err := time.ParseInLocation("2006-01-02 15:04:05", waktu, time.Local)
+		if err != nil {
+			return nil, errors.New("task " + strconv.Itoa(taskID) + ": waktu must be YYYY-MM-DD HH:MM:SS")
+		}
+		before, err := time.ParseInLocation("2006-01-02 15:04:05", tasks[i].Waktu, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		if before.Equal(after) {
+			continue
+		}
+
+		payload, err := json.Marshal(bpjs.UpdateWaktuRequest{
+			KodeBooking: review.KodeBooking,
+			TaskID:      taskID,
+			Waktu:       after.UnixMilli(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		t := tasks[i]
+		t.Provenance.Adjustments = append(append([]models.TaskAdjustment{}, t.Provenance.Adjustments...),
+			models.NewTaskAdjustment(reason, &before, &after))
+		t.Waktu = waktu
+		t.Provenance.Final = waktu
+		t.Payload = payload
+		tasks[i] = t
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].TaskID < tasks[j].TaskID })
+	for i := 1; i < len(tasks); i++ {
+		if tasks[i].Waktu <= tasks[i-1].Waktu {
+			return nil, errors.New("task " + strconv.Itoa(tasks[i].TaskID) + " must be after task " + strconv.Itoa(tasks[i-1].TaskID))
+		}
+	}
+	return tasks, nil
+}
+
+func reviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrReviewNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, database.ErrReviewNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,48 @@
+package report
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotrol/internal/config"
+)
+
+func TestReviewDecisionNeedsReviewerKey(t *testing.T) {
+	a := &APIServer{reviewers: []config.Reviewer{
+		{Name: "dr. Sari", Key: "key-sari"},
+		{Name: "no key"},
+	}}
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"configured key", "key-sari", "dr. Sari"},
+		{"unknown key", "key-budi", ""},
+		{"no key", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/reviews/1/approve", strings.NewReader(`{"reviewer":"dr. Sari"}`))
+			r.SetPathValue("id", "1")
+			r.SetPathValue("action", "approve")
+			if tt.key != "" {
+				r.Header.Set("X-Api-Key", tt.key)
+			}
+			if got := a.reviewer(r); got != tt.want {
+				t.Errorf("reviewer = %q, want %q", got, tt.want)
+			}
+			if tt.want != "" {
+				return
+			}
+			w := httptest.NewRecorder()
+			a.handleReviewDecision(w, r)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
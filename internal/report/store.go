@@ -11,8 +11,9 @@ import (
 )
 
 type Store struct {
-	basePath string
-	mu       sync.RWMutex
+	basePath  string
+	mu        sync.RWMutex
+	journalMu sync.Mutex
 }
 
 type DailyData struct {
@@ -107,42 +108,64 @@ func (s *Store) GetResultsByDate(date string) ([]models.ProcessResult, error) {
 	return daily.Results, nil
 }
 
-func (s *Store) GetSummaryByDate(date string) (processed, success, failed int, err error) {
+// GetNeedsData returns the entries of a date that faithful mode held back
+// because a task had no SIMRS record.
+func (s *Store) GetNeedsData(date string) ([]models.ProcessResult, error) {
 	results, err := s.GetResultsByDate(date)
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
+	}
+	held := []models.ProcessResult{}
+	for _, r := range results {
+		if len(r.NeedsData) > 0 {
+			held = append(held, r)
+		}
+	}
+	return held, nil
+}
+
+// GetSummaryByDate counts the entries of a date. Cancelled entries are
+// processed but neither sent nor failed.
+func (s *Store) GetSummaryByDate(date string) (processed, success, failed, cancelled int, err error) {
+	results, err := s.GetResultsByDate(date)
+	if err != nil {
+		return 0, 0, 0, 0, err
 	}
 
 	for _, r := range results {
 		processed++
-		if r.UpdateWaktuDone {
+		switch {
+		case r.Cancellation != nil:
+			cancelled++
+		case r.UpdateWaktuDone:
 			success++
-		} else {
+		default:
 			failed++
 		}
 	}
 	return
 }
 
-func (s *Store) GetSummaryByDateRange(startDate, endDate string) (processed, success, failed int, err error) {
+func (s *Store) GetSummaryByDateRange(startDate, endDate string) (processed, success, failed, cancelled int, err error) {
 	start, err := time.Parse("2006-01-02", startDate)
 	if err != nil {
-		return 0, 0, 0, err
+		return 0, 0, 0, 0, err
 	}
 	end, err := time.Parse("2006-01-02", endDate)
 	if err != nil {
-		return 0, 0, 0, err
+		return 0, 0, 0, 0, err
 	}
 
 	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
 		dateStr := d.Format("2006-01-02")
-		p, s, f, err := s.GetSummaryByDate(dateStr)
+		p, s, f, c, err := s.GetSummaryByDate(dateStr)
 		if err == nil {
 			if p > 0 {
 			}
 			processed += p
 			success += s
 			failed += f
+			cancelled += c
 		}
 	}
 	return
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+const (
+	cancelReason = "Registrasi dibatalkan di SIMRS"
+	// mobileJKNCancel starts the keterangan wsrs writes when a patient
+	// cancels in Mobile JKN.
+	mobileJKNCancel = "Batal Mobile JKN"
+)
+
+type antreanCanceller interface {
+	BatalAntreanContext(ctx context.Context, kodeBooking, keterangan string) (*bpjs.BPJSResponse, error)
+}
+
+// transient reports whether an answer says nothing about the booking, so
+// the cancellation is tried again on the next poll instead of recorded.
+func transient(c bpjs.Category) bool {
+	switch c {
+	case bpjs.CategoryNetworkError, bpjs.CategoryServerError, bpjs.CategoryRateLimited, bpjs.CategoryAuthFailed:
+		return true
+	}
+	return false
+}
+
+// Cancel withdraws a cancelled visit from BPJS: Task 99 when the patient was
+// never served, then antrean/batal. Bookings cancelled in Mobile JKN are
+// already cancelled at BPJS and are only recorded. Once recorded, the entry
+// is left out of every later updatewaktu.
+func (p *Pipeline) Cancel(ctx context.Context, entry models.AntrianReferensi) models.ProcessResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tanggal := entry.TanggalPeriksa
+	if len(tanggal) >= 10 {
+		tanggal = tanggal[:10]
+	}
+	c := models.Cancellation{
+		NomorReferensi: entry.NomorReferensi,
+		KodeBooking:    entry.KodeBooking,
+		TanggalPeriksa: tanggal,
+		Source:         models.CancelSourceSIMRS,
+		Alasan:         cancelReason,
+	}
+	result := models.ProcessResult{
+		NomorReferensi: entry.NomorReferensi,
+		KodeBooking:    entry.KodeBooking,
+		NoRkmMedis:     entry.NoRkmMedis,
+		NamaPasien:     entry.NamaPasien,
+		NoRawat:        entry.NoRawat,
+		ProcessedAt:    time.Now(),
+		Tasks:          make(map[int]models.TaskResult),
+	}
+	defer func() {
+		p.results.SaveResult(result)
+	}()
+
+	if strings.HasPrefix(entry.Keterangan, mobileJKNCancel) {
+		c.Source = models.CancelSourceMobileJKN
+		c.Alasan = entry.Keterangan
+		log.Printf("   ├── Cancelled in Mobile JKN, nothing to send")
+	} else {
+		completed, err := p.store.getCompletedTaskIDs(entry.NomorReferensi)
+		if err != nil {
+			log.Printf("   └──  Error reading task IDs: %v", err)
+			result.Error = err.Error()
+			return result
+		}
+		if !completed[5] && !completed[99] {
+			maxSent, err := p.store.getMaxSentTime(entry.NomorReferensi)
+			if err != nil {
+				log.Printf("   └──  Error reading task IDs: %v", err)
+				result.Error = err.Error()
+				return result
+			}
+			waktuMs := maxInt64(time.Now().UnixMilli(), maxSent+60_000)
+			taskResult := models.TaskResult{Waktu: time.UnixMilli(waktuMs).Format("2006-01-02 15:04:05")}
+			resp, err := p.sender.UpdateWaktuContext(bpjs.WithCorrelation(ctx, entry.NomorReferensi, 99), entry.KodeBooking, 99, waktuMs)
+			category := bpjs.ClassifyError(err)
+			if err == nil {
+				category = resp.Category()
+				taskResult.BPJSCode = resp.Metadata.Code
+				taskResult.Message = resp.Metadata.Message
+			} else {
+				taskResult.Message = err.Error()
+			}
+			taskResult.Category = string(category)
+
+			switch {
+			case transient(category):
+				taskResult.BPJSStatus = "error"
+				result.Tasks[99] = taskResult
+				result.Error = taskResult.Message
+				log.Printf("   └── BPJS Task 99:  Error: %s, retrying next poll", taskResult.Message)
+				return result
+			case category.IsAccepted() || category == bpjs.CategoryAlreadyCancelled:
+				taskResult.BPJSStatus = "success"
+				c.Task99 = waktuMs
+				log.Printf("   ├── BPJS Task 99: %d %s", taskResult.BPJSCode, taskResult.Message)
+			default:
+				taskResult.BPJSStatus = "failed"
+				log.Printf("   ├── BPJS Task 99: %d %s [%s]", taskResult.BPJSCode, taskResult.Message, category)
+			}
+			result.Tasks[99] = taskResult
+		}
+
+		resp, err := p.canceller.BatalAntreanContext(bpjs.WithCorrelation(ctx, entry.NomorReferensi, 0), entry.KodeBooking, c.Alasan)
+		category := bpjs.ClassifyError(err)
+		if err == nil {
+			category = resp.Category()
+			c.BPJSCode = resp.Metadata.Code
+			c.Message = resp.Metadata.Message
+		} else {
+			c.Message = err.Error()
+		}
+		c.Category = string(category)
+		if transient(category) {
+			result.Error = c.Message
+			log.Printf("   └── BPJS Batal:  Error: %s, retrying next poll", c.Message)
+			return result
+		}
+		log.Printf("   ├── BPJS Batal: %d %s [%s]", c.BPJSCode, c.Message, category)
+	}
+
+	c.CancelledAt = time.Now()
+	if err := p.store.saveCancellation(c); err != nil {
+		log.Printf("   └──  Error saving cancellation: %v", err)
+		result.Error = err.Error()
+		return result
+	}
+	result.Cancellation = &c
+	return result
+}
+
+// checkCancellations cancels today's bookings whose visit was cancelled in
+// SIMRS after the booking reached BPJS.
+func (w *Watcher) checkCancellations() int {
+	entries, err := w.fetchCancelledEntries()
+	if err != nil {
+		log.Printf("  Error fetching cancelled entries: %v", err)
+		return 0
+	}
+	for _, entry := range entries {
+		log.Printf("🚫 Cancelling: %s - %s (Ref: %s)", entry.NoRkmMedis, entry.NamaPasien, entry.NomorReferensi)
+		w.pipeline.Cancel(w.ctx, entry)
+		log.Printf("   └── Complete!")
+	}
+	return len(entries)
+}
+
+func (w *Watcher) fetchCancelledEntries() ([]models.AntrianReferensi, error) {
+	return w.repo.CancelledEntries(time.Now().Format("2006-01-02"))
+}
+
+// saveCancellation records the cancellation and an accepted Task 99 in the
+// task table, so the task shows as sent like every other.
+func (s *repoStore) saveCancellation(c models.Cancellation) error {
+	if c.Task99 > 0 {
+		// UpsertTaskIDs keeps rows that are already Sudah.
+		err := s.repo.UpsertTaskIDs(c.TanggalPeriksa, c.NomorReferensi, []database.TaskRow{{
+			TaskID:     99,
+			Waktu:      c.Task99,
+			Keterangan: "Batal: " + c.Alasan,
+		}}, "cancel")
+		if err != nil {
+			return err
+		}
+		s.updateTaskStatus(c.NomorReferensi, 99, "Sudah")
+	}
+	return s.db.SaveCancellation(c)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/models"
+)
+
+type fakeCanceller struct {
+	answer fakeAnswer
+	calls  int
+}
+
+func (f *fakeCanceller) BatalAntreanContext(context.Context, string, string) (*bpjs.BPJSResponse, error) {
+	f.calls++
+	if f.answer.err != nil {
+		return nil, f.answer.err
+	}
+	resp := &bpjs.BPJSResponse{}
+	resp.Metadata.Code = f.answer.code
+	resp.Metadata.Message = f.answer.message
+	return resp, nil
+}
+
+func TestPipelineCancel(t *testing.T) {
+	tests := []struct {
+		name         string
+		keterangan   string
+		completed    map[int]bool
+		tasksErr     error
+		batal        fakeAnswer
+		wantTask99   bool
+		wantBatal    int
+		wantRecorded string
+	}{
+		{
+			name:         "SIMRS cancel sends Task 99 and batal",
+			batal:        fakeAnswer{code: 200, message: "Ok"},
+			wantTask99:   true,
+			wantBatal:    1,
+			wantRecorded: models.CancelSourceSIMRS,
+		},
+		{
+			name:         "served patient gets no Task 99",
+			completed:    map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true},
+			batal:        fakeAnswer{code: 201, message: "Antrean tidak dapat dibatalkan, pasien sudah dilayani"},
+			wantBatal:    1,
+			wantRecorded: models.CancelSourceSIMRS,
+		},
+		{
+			name:         "Mobile JKN cancel is only recorded",
+			keterangan:   "Batal Mobile JKN: berhalangan",
+			wantRecorded: models.CancelSourceMobileJKN,
+		},
+		{
+			name:       "network error is retried later",
+			batal:      fakeAnswer{err: errors.New("connection refused")},
+			wantTask99: true,
+			wantBatal:  1,
+		},
+		{
+			name:     "unreadable task IDs skip the entry",
+			tasksErr: errors.New("connection reset"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{completed: tt.completed, status: map[int]string{}, tasksErr: tt.tasksErr}
+			if store.completed == nil {
+				store.completed = map[int]bool{}
+			}
+			sender := &fakeSender{script: map[int][]fakeAnswer{}}
+			canceller := &fakeCanceller{answer: tt.batal}
+			results := &fakeResults{}
+			p := &Pipeline{store: store, sender: sender, canceller: canceller, processor: NewAutoOrderProcessor(), results: results}
+
+			result := p.Cancel(context.Background(), models.AntrianReferensi{
+				NomorReferensi: "REF1",
+				KodeBooking:    "KB1",
+				TanggalPeriksa: "2025-12-28",
+				Keterangan:     tt.keterangan,
+			})
+
+			if sent99 := len(sender.sent) == 1 && sender.sent[0].taskID == 99; sent99 != tt.wantTask99 {
+				t.Errorf("sent %v, want Task 99 %v", sender.sent, tt.wantTask99)
+			}
+			if canceller.calls != tt.wantBatal {
+				t.Errorf("batal called %d times, want %d", canceller.calls, tt.wantBatal)
+			}
+			if tt.wantRecorded == "" {
+				if store.cancelled != nil || result.Cancellation != nil {
+					t.Errorf("cancellation recorded: %+v", store.cancelled)
+				}
+				return
+			}
+			if store.cancelled == nil || store.cancelled.Source != tt.wantRecorded {
+				t.Fatalf("recorded %+v, want source %s", store.cancelled, tt.wantRecorded)
+			}
+			if (store.cancelled.Task99 > 0) != tt.wantTask99 {
+				t.Errorf("Task99 %d, want sent %v", store.cancelled.Task99, tt.wantTask99)
+			}
+			if result.Cancellation == nil || len(results.saved) != 1 {
+				t.Errorf("result not reported as cancelled: %+v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/models"
+)
+
+// DryRun plans the given batch mode the same way the real run does, but only
+// reads from MySQL and never calls BPJS. The result is what a supervisor signs
+// off on before running the batch for real.
+func (b *BatchHandler) DryRun(modeName, date string) (*models.DryRunReport, error) {
+	mode, err := lookupBatchMode(modeName)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []models.AntrianReferensi
+	switch mode.name {
+	case modeAutoOrder.name, modeAll.name:
+		entries, err = b.fetchAllBPJSEntries(date)
+	case modeUpdateWaktu.name:
+		entries, err = b.fetchEntriesWithTaskIDs(date)
+	case modeRetryTask3.name:
+		entries, err = b.fetchEntriesForRetryTask3(date)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🔍 Dry run %s for %s: %d entries", mode.name, date, len(entries))
+
+	rep := &models.DryRunReport{
+		Mode:    mode.name,
+		Date:    date,
+		Entries: []models.DryRunEntry{},
+		Errors:  []string{},
+	}
+	for _, entry := range entries {
+		existing, err := b.repo.TaskIDs(entry.NomorReferensi)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", entry.NomorReferensi, err))
+			continue
+		}
+		planned, err := b.pipeline.dryRun(mode, entry, existing)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", entry.NomorReferensi, err))
+			continue
+		}
+		rep.Entries = append(rep.Entries, planned)
+	}
+	return rep, nil
+}
+
+// dryRun runs the entry through Process with a store, sender and review
+// queue that read from the real ones but keep every write to themselves.
+// Tasks BPJS already accepted are taken from the local Sudah rows only, even
+// with verify_remote on.
+func (p *Pipeline) dryRun(mode sendMode, entry models.AntrianReferensi, existing []models.TaskID) (models.DryRunEntry, error) {
+	store := &dryRunStore{taskStore: p.store}
+	sender := &dryRunSender{sent: make(map[int]int64)}
+	dry := &Pipeline{
+		store:     store,
+		sender:    sender,
+		processor: p.processor,
+		results:   discardResults{},
+		faithful:  p.faithful,
+	}
+	var reviews *dryRunReviews
+	if p.reviews != nil {
+		reviews = &dryRunReviews{reviewQueue: p.reviews}
+		dry.reviews = reviews
+	}
+
+	result := dry.Process(context.Background(), entry, mode)
+
+	planned := models.DryRunEntry{
+		NomorReferensi: entry.NomorReferensi,
+		KodeBooking:    entry.KodeBooking,
+		NoRkmMedis:     entry.NoRkmMedis,
+		NamaPasien:     entry.NamaPasien,
+		NeedsData:      result.NeedsData,
+		Violations:     result.Violations,
+		AutoOrderRules: result.AutoOrderRules,
+		Tasks:          []models.DryRunTask{},
+	}
+	switch {
+	case result.Error == "no task times":
+		planned.Skipped = result.Error
+	case result.Error != "":
+		return planned, errors.New(result.Error)
+	case len(result.NeedsData) > 0:
+		planned.Skipped = "needs data"
+	case reviews != nil && reviews.parked != nil:
+		planned.Skipped = "parked for review (" + strings.Join(reviews.parked.Reasons, ", ") + ")"
+	case result.Review == models.ReviewPending || result.Review == models.ReviewRejected:
+		planned.Skipped = "review " + result.Review
+	case len(result.Violations) > 0:
+		planned.Skipped = "BPJS would reject the plan"
+	}
+	if planned.Skipped != "" || !store.saved {
+		return planned, nil
+	}
+
+	localStatus := make(map[int]string)
+	storedWaktu := make(map[int]int64)
+	for _, t := range existing {
+		localStatus[t.TaskID] = t.Status
+		storedWaktu[t.TaskID] = t.Waktu
+	}
+
+	for i := 0; i < 7; i++ {
+		taskNum := i + 1
+		if store.ordered[i] == nil {
+			continue
+		}
+		task := models.DryRunTask{
+			TaskID:      taskNum,
+			Waktu:       FormatTime(store.ordered[i]),
+			Source:      store.prov[i].Source,
+			Generated:   store.prov[i].Generated,
+			LocalStatus: localStatus[taskNum],
+			Write:       localStatus[taskNum] != "Sudah",
+		}
+		if store.fetched[i] != nil {
+			task.Original = FormatTime(store.fetched[i])
+		}
+		if stored, ok := storedWaktu[taskNum]; ok && task.Write && stored != TimeToMillis(store.ordered[i]) {
+			task.Replaces = time.UnixMilli(stored).Format("2006-01-02 15:04:05")
+		}
+
+		waktu, sent := sender.sent[taskNum]
+		switch {
+		case !mode.isEligible(taskNum):
+			task.Skip = mode.name + " does not send this task"
+		case localStatus[taskNum] == "Sudah":
+			task.Skip = "already Sudah"
+		case !mode.send:
+			task.Skip = mode.name + " does not send"
+		case sent:
+			task.Send = true
+			payload, err := json.Marshal(bpjs.UpdateWaktuRequest{
+				KodeBooking: entry.KodeBooking,
+				TaskID:      taskNum,
+				Waktu:       waktu,
+			})
+			if err != nil {
+				return planned, err
+			}
+			task.Payload = payload
+		}
+		planned.Tasks = append(planned.Tasks, task)
+	}
+	return planned, nil
+}
+
+// dryRunStore reads through to the task table and records what Process
+// would have written instead of writing it.
+type dryRunStore struct {
+	taskStore
+	fetched [7]*time.Time
+	saved   bool
+	ordered [7]*time.Time
+	prov    [7]models.TaskProvenance
+}
+
+func (s *dryRunStore) fetchTaskTimes(entry models.AntrianReferensi) ([7]*time.Time, [7]models.TaskProvenance, error) {
+	tasks, prov, err := s.taskStore.fetchTaskTimes(entry)
+	s.fetched = tasks
+	return tasks, prov, err
+}
+
+func (s *dryRunStore) saveTaskIDs(_ models.AntrianReferensi, tasks [7]*time.Time, prov [7]models.TaskProvenance, _ string) error {
+	s.saved = true
+	s.ordered = tasks
+	s.prov = prov
+	return nil
+}
+
+func (s *dryRunStore) saveProvenance(string, []models.TaskProvenance) {}
+func (s *dryRunStore) updateTaskStatus(string, int, string)           {}
+func (s *dryRunStore) saveCancellation(models.Cancellation) error     { return nil }
+
+// dryRunSender records the updatewaktu calls and answers each as accepted,
+// so every task the run would send is listed.
+type dryRunSender struct {
+	sent map[int]int64
+}
+
+func (s *dryRunSender) UpdateWaktuContext(_ context.Context, _ string, taskID int, waktuMs int64) (*bpjs.BPJSResponse, error) {
+	s.sent[taskID] = waktuMs
+	resp := &bpjs.BPJSResponse{}
+	resp.Metadata.Code = 200
+	resp.Metadata.Message = "dry run"
+	return resp, nil
+}
+
+// dryRunReviews reads the review queue but keeps a parked entry to itself.
+type dryRunReviews struct {
+	reviewQueue
+	parked *models.ReviewEntry
+}
+
+func (r *dryRunReviews) ParkReview(review models.ReviewEntry) error {
+	r.parked = &review
+	return nil
+}
+
+func (r *dryRunReviews) MarkReviewSent(int64) error { return nil }
+
+type discardResults struct{}
+
+func (discardResults) SaveResult(models.ProcessResult) error { return nil }
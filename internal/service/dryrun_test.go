@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gotrol/internal/models"
+)
+
+func TestPipelineDryRun(t *testing.T) {
+	fiveTasks := [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50")}
+	existing := []models.TaskID{
+		{TaskID: 1, Status: "Sudah", Waktu: ms("08:10")},
+		{TaskID: 2, Status: "Belum", Waktu: ms("08:00")},
+	}
+
+	tests := []struct {
+		name        string
+		mode        sendMode
+		tasks       [7]*time.Time
+		completed   map[int]bool
+		sent        map[int]time.Time
+		review      bool
+		wantSkipped string
+		wantTasks   []string
+	}{
+		{
+			name:      "sends what the real run would",
+			mode:      modeAll,
+			tasks:     fiveTasks,
+			completed: map[int]bool{1: true},
+			sent:      map[int]time.Time{1: *at("08:10")},
+			wantTasks: []string{"1:already Sudah", "2:send replaces 08:00:00", "3:send", "4:send", "5:send"},
+		},
+		{
+			name:      "autoorder only writes",
+			mode:      modeAutoOrder,
+			tasks:     [7]*time.Time{at("08:10"), at("08:20")},
+			wantTasks: []string{"1:already Sudah", "2:autoorder does not send replaces 08:00:00"},
+		},
+		{
+			name:      "retrytask3 sends only Task 3",
+			mode:      modeRetryTask3,
+			tasks:     fiveTasks,
+			wantTasks: []string{"1:retrytask3 does not send this task", "2:retrytask3 does not send this task replaces 08:00:00", "3:send", "4:retrytask3 does not send this task", "5:retrytask3 does not send this task"},
+		},
+		{
+			name:        "invalid plan is held",
+			mode:        modeAll,
+			tasks:       [7]*time.Time{nil, nil, at("08:30")},
+			completed:   map[int]bool{1: true, 2: true},
+			sent:        map[int]time.Time{2: *at("08:45")},
+			wantSkipped: "BPJS would reject the plan",
+		},
+		{
+			name:        "auto order change would be parked",
+			mode:        modeAll,
+			tasks:       [7]*time.Time{at("07:30"), at("08:20")},
+			review:      true,
+			wantSkipped: "parked for review (" + models.ReviewReasonAutoOrder + ")",
+		},
+		{
+			name:        "no task times",
+			mode:        modeAll,
+			wantSkipped: "no task times",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{tasks: tt.tasks, completed: tt.completed, sent: tt.sent, status: map[int]string{}}
+			if store.completed == nil {
+				store.completed = map[int]bool{}
+			}
+			sender := &fakeSender{script: map[int][]fakeAnswer{}}
+			results := &fakeResults{}
+			reviews := &fakeReviews{}
+			p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: results}
+			if tt.review {
+				p.reviews = reviews
+			}
+
+			entry := models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1", TanggalPeriksa: "2025-12-28"}
+			planned, err := p.dryRun(tt.mode, entry, existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if planned.Skipped != tt.wantSkipped {
+				t.Errorf("skipped = %q, want %q", planned.Skipped, tt.wantSkipped)
+			}
+			var got []string
+			for _, task := range planned.Tasks {
+				s := fmt.Sprintf("%d:%s", task.TaskID, task.Skip)
+				if task.Send {
+					s = fmt.Sprintf("%d:send", task.TaskID)
+					if !strings.Contains(string(task.Payload), fmt.Sprintf(`"waktu":%d`, TimeToMillis(tt.tasks[task.TaskID-1]))) {
+						t.Errorf("task %d payload %s", task.TaskID, task.Payload)
+					}
+				}
+				if task.Replaces != "" {
+					s += " replaces " + task.Replaces[11:]
+				}
+				got = append(got, s)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantTasks) {
+				t.Errorf("tasks %v, want %v", got, tt.wantTasks)
+			}
+
+			if store.saved || len(store.status) > 0 || store.prov != nil {
+				t.Errorf("dry run wrote to the task table: saved %v, status %v, provenance %v", store.saved, store.status, store.prov)
+			}
+			if len(sender.sent) > 0 || len(results.saved) > 0 || len(reviews.parked) > 0 {
+				t.Errorf("dry run sent %v, saved %d results, parked %d reviews", sender.sent, len(results.saved), len(reviews.parked))
+			}
+		})
+	}
+}
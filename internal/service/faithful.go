@@ -0,0 +1,91 @@
+package service
+
+import (
+	"time"
+
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+// Upstream units responsible for recording each task in SIMRS.
+const (
+	UnitLoket       = "loket"
+	UnitRekamMedis  = "rekam medis"
+	UnitPoli        = "poli"
+	UnitApotek      = "apotek"
+	sourceGenerated = "generated"
+	sourceCheckin   = database.SourceCheckin
+	sourceEvent     = database.SourceEvent
+)
+
+// taskSources are the default sources, named when the configured one is not
+// known.
+var taskSources = [7]struct {
+	unit   string
+	source string
+}{
+	{UnitLoket, "mlite_antrian_loket.start_time"},
+	{UnitLoket, "mlite_antrian_loket.end_time"},
+	{UnitRekamMedis, "mutasi_berkas.dikirim"},
+	{UnitPoli, "mutasi_berkas.diterima"},
+	{UnitPoli, "pemeriksaan_ralan.jam_rawat"},
+	{UnitApotek, "resep_obat.jam_peresepan"},
+	{UnitApotek, "resep_obat.jam"},
+}
+
+// isFallbackSource reports whether a time was made up rather than read from
+// the record the task is defined by.
+func isFallbackSource(prov models.TaskProvenance) bool {
+	if prov.Generated {
+		return true
+	}
+	switch prov.Source {
+	case sourceGenerated, "reg_periksa.jam_reg", "tanggal_periksa 08:00":
+		return true
+	}
+	return false
+}
+
+// missingSourceData lists the tasks of an entry that faithful mode refuses to
+// send. wanted limits the check to tasks the caller would write or send.
+func missingSourceData(ordered [7]*time.Time, prov [7]models.TaskProvenance, rules []models.AutoOrderRule, wanted func(taskNum int) bool) []models.NeedsData {
+	var needs []models.NeedsData
+	for i := 0; i < 7; i++ {
+		taskNum := i + 1
+		if ordered[i] == nil || !wanted(taskNum) || !isFallbackSource(prov[i]) {
+			continue
+		}
+		needs = append(needs, models.NeedsData{
+			TaskID: taskNum,
+			Unit:   taskSources[i].unit,
+			Source: expectedSource(prov, i),
+			Reason: "no record, time would be " + prov[i].Source,
+		})
+	}
+
+	// A lone Task 6 or 7 is cleared by the processor rather than generated,
+	// but it still means the pharmacy did not record one of its events.
+	for _, rule := range rules {
+		if rule.Rule != RulePharmacyIncomplete || !wanted(rule.TaskID) {
+			continue
+		}
+		missing := 7
+		if rule.TaskID == 7 {
+			missing = 6
+		}
+		needs = append(needs, models.NeedsData{
+			TaskID: missing,
+			Unit:   UnitApotek,
+			Source: expectedSource(prov, missing-1),
+			Reason: "no record, pharmacy tasks cleared",
+		})
+	}
+	return needs
+}
+
+func expectedSource(prov [7]models.TaskProvenance, i int) string {
+	if prov[i].Expected != "" {
+		return prov[i].Expected
+	}
+	return taskSources[i].source
+}
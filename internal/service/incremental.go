@@ -0,0 +1,57 @@
+package service
+
+import (
+	"time"
+
+	"gotrol/internal/models"
+)
+
+// readyTasks marks the tasks incremental mode may send now. A task is ready
+// once its own SIMRS record exists; a fallback time only becomes ready when
+// a later task has a record to bound it. Tasks become ready in order, so the
+// first task still waiting holds back every task after it.
+func readyTasks(ordered [7]*time.Time, prov [7]models.TaskProvenance, completed map[int]bool) [7]bool {
+	var anchored [7]bool
+	recorded := false
+	for i := 6; i >= 0; i-- {
+		anchored[i] = recorded
+		if completed[i+1] || (ordered[i] != nil && !isFallbackSource(prov[i])) {
+			recorded = true
+		}
+	}
+
+	var ready [7]bool
+	for i := 0; i < 7; i++ {
+		if completed[i+1] {
+			continue
+		}
+		if ordered[i] == nil || (isFallbackSource(prov[i]) && !anchored[i]) {
+			break
+		}
+		ready[i] = true
+	}
+	return ready
+}
+
+// readyTaskIDs lists the tasks of an entry incremental mode would send now
+// without writing anything, so the watcher can skip entries with nothing new.
+func (p *Pipeline) readyTaskIDs(entry models.AntrianReferensi) ([]int, error) {
+	tasks, prov, err := p.store.fetchTaskTimes(entry)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := p.store.getCompletedTaskIDs(entry.NomorReferensi)
+	if err != nil {
+		return nil, err
+	}
+	order := p.processor.ProcessTasks(tasks)
+	ready := readyTasks(order.Tasks, prov, completed)
+
+	var ids []int
+	for i, r := range ready {
+		if r {
+			ids = append(ids, i+1)
+		}
+	}
+	return ids, nil
+}
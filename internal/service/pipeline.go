@@ -0,0 +1,483 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/config"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+// taskStore is the access to the task table the pipeline needs. *Watcher
+// implements it against the SIMRS repository.
+type taskStore interface {
+	fetchTaskTimes(entry models.AntrianReferensi) ([7]*time.Time, [7]models.TaskProvenance, error)
+	saveTaskIDs(entry models.AntrianReferensi, tasks [7]*time.Time, prov [7]models.TaskProvenance, source string) error
+	saveProvenance(nomorReferensi string, provs []models.TaskProvenance)
+	getCompletedTaskIDs(nomorReferensi string) (map[int]bool, error)
+	getMaxSentTime(nomorReferensi string) (int64, error)
+	getSentTimes(nomorReferensi string) (map[int]time.Time, error)
+	updateTaskStatus(nomorReferensi string, taskID int, status string)
+	saveCancellation(c models.Cancellation) error
+}
+
+type taskSender interface {
+	UpdateWaktuContext(ctx context.Context, kodeBooking string, taskID int, waktuMs int64) (*bpjs.BPJSResponse, error)
+}
+
+type taskLister interface {
+	GetListTaskContext(ctx context.Context, kodeBooking string) ([]bpjs.ListTask, *bpjs.BPJSResponse, error)
+}
+
+type resultSaver interface {
+	SaveResult(result models.ProcessResult) error
+}
+
+// sendMode is what distinguishes the watcher and the batch types once their
+// entries are selected: whether anything is sent and which tasks may be.
+// Incremental modes only write and send the tasks readyTasks allows.
+type sendMode struct {
+	name        string
+	send        bool
+	incremental bool
+	eligible    func(taskNum int) bool
+}
+
+func (m sendMode) isEligible(taskNum int) bool {
+	return m.eligible == nil || m.eligible(taskNum)
+}
+
+var (
+	modeWatcher     = sendMode{name: "watcher", send: true}
+	modeIncremental = sendMode{name: "incremental", send: true, incremental: true}
+	modeAutoOrder   = sendMode{name: "autoorder"}
+	modeUpdateWaktu = sendMode{name: "updatewaktu", send: true}
+	modeAll         = sendMode{name: "all", send: true}
+	modeRetryTask3  = sendMode{name: "retrytask3", send: true, eligible: func(taskNum int) bool { return taskNum == 3 }}
+)
+
+// eventMode sends only the task an event just reported.
+func eventMode(taskID int) sendMode {
+	return sendMode{name: "event", send: true, eligible: func(taskNum int) bool { return taskNum == taskID }}
+}
+
+var batchModes = map[string]sendMode{
+	modeAutoOrder.name:   modeAutoOrder,
+	modeUpdateWaktu.name: modeUpdateWaktu,
+	modeAll.name:         modeAll,
+	modeRetryTask3.name:  modeRetryTask3,
+}
+
+// Pipeline orders, stores and sends the tasks of one entry. The watcher and
+// every batch type go through Process so they cannot drift apart. Process
+// runs one entry at a time so forwarded events cannot race the watcher.
+type Pipeline struct {
+	mu        sync.Mutex
+	store     taskStore
+	sender    taskSender
+	canceller antreanCanceller
+	processor *AutoOrderProcessor
+	results   resultSaver
+	reviews   reviewQueue
+	lister    taskLister
+	faithful  bool
+}
+
+func newPipeline(db *database.MySQL, repo database.Repository, bpjsClient *bpjs.Client, results resultSaver, cfg config.TasksConfig) *Pipeline {
+	p := &Pipeline{
+		store:     &repoStore{db: db, repo: repo},
+		sender:    bpjsClient,
+		canceller: bpjsClient,
+		processor: NewAutoOrderProcessor(),
+		results:   results,
+		faithful:  cfg.Faithful,
+	}
+	if cfg.Review {
+		p.reviews = db
+	}
+	if cfg.VerifyRemote {
+		p.lister = bpjsClient
+	}
+	return p
+}
+
+// entryRun is the state of one entry while it moves through the pipeline.
+type entryRun struct {
+	ctx      context.Context
+	mode     sendMode
+	entry    models.AntrianReferensi
+	ordered  [7]*time.Time
+	prov     [7]models.TaskProvenance
+	rejected string
+}
+
+func (p *Pipeline) Process(ctx context.Context, entry models.AntrianReferensi, mode sendMode) models.ProcessResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := models.ProcessResult{
+		NomorReferensi: entry.NomorReferensi,
+		KodeBooking:    entry.KodeBooking,
+		NoRkmMedis:     entry.NoRkmMedis,
+		NamaPasien:     entry.NamaPasien,
+		NoRawat:        entry.NoRawat,
+		ProcessedAt:    time.Now(),
+		Tasks:          make(map[int]models.TaskResult),
+	}
+	defer func() {
+		p.results.SaveResult(result)
+	}()
+
+	tasks, prov, err := p.store.fetchTaskTimes(entry)
+	if err != nil {
+		log.Printf("   └──  Error fetching task times: %v", err)
+		result.Error = err.Error()
+		return result
+	}
+
+	order := p.processor.ProcessTasks(tasks)
+	ordered := order.Tasks
+	result.AutoOrderRules = order.Rules
+	for _, rule := range order.Rules {
+		log.Printf("   ├── Auto Order %s Task %d: %s → %s", rule.Rule, rule.TaskID, clockOrDash(rule.Before), clockOrDash(rule.After))
+	}
+
+	hasAnyTask := false
+	for i := 0; i < 7; i++ {
+		prov[i].TaskID = i + 1
+		prov[i].Adjustments = append(prov[i].Adjustments, order.Adjustments(i)...)
+		if ordered[i] != nil {
+			hasAnyTask = true
+		}
+	}
+	if !hasAnyTask {
+		log.Printf("   └── ⚠️ Skip - no task times")
+		result.Error = "no task times"
+		return result
+	}
+
+	completedTasks, err := p.store.getCompletedTaskIDs(entry.NomorReferensi)
+	if err != nil {
+		log.Printf("   └──  Error reading task IDs: %v", err)
+		result.Error = err.Error()
+		return result
+	}
+	ready := [7]bool{true, true, true, true, true, true, true}
+	if mode.incremental {
+		// Tasks that are not ready are neither stored nor sent, so their
+		// source is read again on the next poll instead of a stored guess.
+		ready = readyTasks(ordered, prov, completedTasks)
+		for i := 0; i < 7; i++ {
+			if !ready[i] && !completedTasks[i+1] {
+				ordered[i] = nil
+				prov[i] = models.TaskProvenance{TaskID: i + 1}
+			}
+		}
+	}
+	wanted := func(taskNum int) bool {
+		return mode.isEligible(taskNum) && !completedTasks[taskNum] && ready[taskNum-1]
+	}
+
+	var gens []int
+	for i := 2; i <= 4; i++ {
+		if ordered[i] != nil && prov[i].Source == sourceGenerated && wanted(i+1) {
+			gens = append(gens, i+1)
+		}
+	}
+	if len(gens) > 0 {
+		log.Printf("   ├── Fallback generator activated for Task %v", gens)
+	}
+	if p.faithful {
+		needs := missingSourceData(ordered, prov, order.Rules, wanted)
+		if len(needs) > 0 {
+			for _, n := range needs {
+				log.Printf("   ├── ⚠️ Task %d: no %s record (%s)", n.TaskID, n.Unit, n.Source)
+			}
+			log.Printf("   └── ⏸️ Held - needs data")
+			result.NeedsData = needs
+			return result
+		}
+	}
+
+	var review *models.ReviewEntry
+	if p.reviews != nil && mode.send {
+		var reasons []string
+		review, reasons, err = p.checkReview(entry, &ordered, &prov, order.Rules, wanted)
+		if err != nil {
+			log.Printf("   └──  Error reading review: %v", err)
+			result.Error = err.Error()
+			return result
+		}
+		if len(reasons) > 0 {
+			if err := p.parkReview(entry, ordered, prov, wanted, reasons, ""); err != nil {
+				log.Printf("   └──  Error parking for review: %v", err)
+				result.Error = err.Error()
+				return result
+			}
+			log.Printf("   └── ⏸️ Held - parked for review (%s)", strings.Join(reasons, ", "))
+			result.Review = models.ReviewPending
+			return result
+		}
+		if review != nil {
+			result.Review = review.Status
+			if review.Status == models.ReviewPending || review.Status == models.ReviewRejected {
+				log.Printf("   └── ⏸️ Held - review %s", review.Status)
+				return result
+			}
+			log.Printf("   ├── Review %s, sending reviewed times", review.Status)
+		}
+	}
+
+	// Times BPJS would reject are held rather than moved until it accepts
+	// them; only a supervisor changes a time after the processor.
+	if mode.send {
+		tanggal := entry.TanggalPeriksa
+		if len(tanggal) >= 10 {
+			tanggal = tanggal[:10]
+		}
+		accepted, err := p.acceptedTimes(ctx, entry)
+		if err != nil {
+			log.Printf("   └──  Error reading task IDs: %v", err)
+			result.Error = err.Error()
+			return result
+		}
+		violations := validatePlan(tanggal, ordered, accepted, wanted)
+		if len(violations) > 0 {
+			result.Violations = violations
+			var messages []string
+			for _, v := range violations {
+				log.Printf("   ├── ⚠️ Task %d: %s", v.TaskID, v.Message)
+				messages = append(messages, v.Message)
+			}
+			if p.reviews == nil {
+				log.Printf("   └── ⏸️ Held - BPJS would reject the plan")
+				return result
+			}
+			if err := p.parkReview(entry, ordered, prov, wanted, []string{models.ReviewReasonInvalidPlan}, strings.Join(messages, "; ")); err != nil {
+				log.Printf("   └──  Error parking for review: %v", err)
+				result.Error = err.Error()
+				return result
+			}
+			log.Printf("   └── ⏸️ Held - parked for review (%s)", models.ReviewReasonInvalidPlan)
+			result.Review = models.ReviewPending
+			return result
+		}
+	}
+	result.AutoOrderDone = true
+
+	if err := p.store.saveTaskIDs(entry, ordered, prov, mode.name); err != nil {
+		log.Printf("   └──  Error saving task IDs: %v", err)
+		result.Error = err.Error()
+		return result
+	}
+
+	run := &entryRun{
+		ctx:     ctx,
+		mode:    mode,
+		entry:   entry,
+		ordered: ordered,
+		prov:    prov,
+	}
+	defer func() {
+		p.saveProvenance(run, completedTasks, result.Tasks)
+	}()
+
+	if !mode.send {
+		for i := 0; i < 7; i++ {
+			if ordered[i] != nil && mode.isEligible(i+1) {
+				result.Tasks[i+1] = models.TaskResult{Waktu: FormatTime(ordered[i])}
+			}
+		}
+		return result
+	}
+
+	allSuccess := true
+
+	for i := 0; i < 7; i++ {
+		taskNum := i + 1
+		if !mode.isEligible(taskNum) {
+			continue
+		}
+
+		if completedTasks[taskNum] {
+			result.Tasks[taskNum] = models.TaskResult{
+				BPJSStatus: "skipped",
+				Message:    "Already Sudah",
+			}
+			log.Printf("   ├── Task %d: Skipped (already Sudah)", taskNum)
+			continue
+		}
+
+		if run.ordered[i] == nil {
+			result.Tasks[taskNum] = models.TaskResult{BPJSStatus: "skipped"}
+			continue
+		}
+
+		taskResult := p.sendTask(run, i, TimeToMillis(run.ordered[i]))
+		if taskResult.BPJSStatus != "success" {
+			allSuccess = false
+		}
+		result.Tasks[taskNum] = taskResult
+
+		if run.rejected != "" {
+			fromRejected := func(n int) bool { return n >= taskNum && wanted(n) }
+			if err := p.parkReview(entry, run.ordered, run.prov, fromRejected, []string{models.ReviewReasonOrderingRejected}, run.rejected); err != nil {
+				log.Printf("   └──  Error parking for review: %v", err)
+			} else {
+				log.Printf("   └── ⏸️ Held - Task %d parked for review", taskNum)
+				result.Review = models.ReviewPending
+			}
+			break
+		}
+	}
+
+	result.UpdateWaktuDone = allSuccess
+	if allSuccess && review != nil && review.Status == models.ReviewApproved {
+		if err := p.reviews.MarkReviewSent(review.ID); err != nil {
+			log.Printf("   ├──  Error marking review sent: %v", err)
+		}
+		result.Review = models.ReviewSent
+	}
+	return result
+}
+
+// saveProvenance stores the provenance of every task this run wrote and
+// attaches it to the report. Tasks that were Sudah before the run keep what
+// was stored when they were sent.
+func (p *Pipeline) saveProvenance(run *entryRun, completedTasks map[int]bool, results map[int]models.TaskResult) {
+	var provs []models.TaskProvenance
+	for i := 0; i < 7; i++ {
+		taskNum := i + 1
+		prov := run.prov[i]
+		if !completedTasks[taskNum] {
+			if run.ordered[i] == nil && len(prov.Adjustments) == 0 {
+				continue
+			}
+			prov.Final = FormatTime(run.ordered[i])
+			provs = append(provs, prov)
+		}
+		if r, ok := results[taskNum]; ok {
+			r.Provenance = &prov
+			results[taskNum] = r
+		}
+	}
+	if len(provs) == 0 {
+		return
+	}
+	p.store.saveProvenance(run.entry.NomorReferensi, provs)
+}
+
+// sendTask sends one task. A rejection for ordering means BPJS holds tasks
+// validatePlan did not know about; with review on, the entry is parked.
+func (p *Pipeline) sendTask(run *entryRun, i int, waktuMs int64) models.TaskResult {
+	taskNum := i + 1
+	entry := run.entry
+	taskCtx := bpjs.WithCorrelation(run.ctx, entry.NomorReferensi, taskNum)
+	taskResult := models.TaskResult{
+		Waktu: time.UnixMilli(waktuMs).Format("2006-01-02 15:04:05"),
+	}
+
+	resp, err := p.sender.UpdateWaktuContext(taskCtx, entry.KodeBooking, taskNum, waktuMs)
+	if err != nil {
+		taskResult.BPJSStatus = "error"
+		taskResult.Category = string(bpjs.ClassifyError(err))
+		taskResult.Message = err.Error()
+		log.Printf("   ├── BPJS Task %d:  Error: %v", taskNum, err)
+		return taskResult
+	}
+
+	taskResult.BPJSCode = resp.Metadata.Code
+	category := resp.Category()
+	taskResult.Category = string(category)
+
+	switch category {
+	case bpjs.CategorySuccess:
+		taskResult.BPJSStatus = "success"
+		log.Printf("   ├── BPJS Task %d: 200 OK ", taskNum)
+		p.store.updateTaskStatus(entry.NomorReferensi, taskNum, "Sudah")
+	case bpjs.CategoryAlreadyExists:
+		taskResult.BPJSStatus = "success"
+		taskResult.Message = resp.Metadata.Message
+		log.Printf("   ├── BPJS Task %d: 208 Sudah ada ", taskNum)
+		p.store.updateTaskStatus(entry.NomorReferensi, taskNum, "Sudah")
+	case bpjs.CategoryOrderingViolation:
+		taskResult.BPJSStatus = "failed"
+		taskResult.Message = resp.Metadata.Message
+		if p.reviews != nil {
+			run.rejected = resp.Metadata.Message
+		}
+		log.Printf("   ├── BPJS Task %d: %d %s", taskNum, resp.Metadata.Code, resp.Metadata.Message)
+	default:
+		taskResult.BPJSStatus = "failed"
+		taskResult.Message = resp.Metadata.Message
+		log.Printf("   ├── BPJS Task %d: %d %s [%s]", taskNum, resp.Metadata.Code, resp.Metadata.Message, category)
+	}
+	return taskResult
+}
+
+// acceptedTimes returns the tasks BPJS already holds: the local Sudah rows,
+// overridden by antrean/getlisttask when verify_remote is on. A failed
+// lookup falls back to the local rows.
+func (p *Pipeline) acceptedTimes(ctx context.Context, entry models.AntrianReferensi) (map[int]time.Time, error) {
+	accepted, err := p.store.getSentTimes(entry.NomorReferensi)
+	if err != nil {
+		return nil, err
+	}
+	if accepted == nil {
+		accepted = make(map[int]time.Time)
+	}
+	if p.lister == nil {
+		return accepted, nil
+	}
+
+	remote, resp, err := p.lister.GetListTaskContext(bpjs.WithCorrelation(ctx, entry.NomorReferensi, 0), entry.KodeBooking)
+	if err != nil {
+		log.Printf("   ├──  Error reading getlisttask, using local tasks: %v", err)
+		return accepted, nil
+	}
+	if !resp.IsSuccess() {
+		return accepted, nil
+	}
+	for _, t := range remote {
+		if t.TaskID < 1 || t.TaskID > 7 {
+			continue
+		}
+		tm := parseListTaskTime(t.WaktuRS)
+		if tm == nil {
+			tm = parseListTaskTime(t.Waktu)
+		}
+		if tm != nil {
+			accepted[t.TaskID] = *tm
+		}
+	}
+	return accepted, nil
+}
+
+// clockOrDash shortens a formatted waktu to its clock time for log lines.
+func clockOrDash(s string) string {
+	if len(s) < 19 {
+		return "-"
+	}
+	return s[11:]
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func lookupBatchMode(name string) (sendMode, error) {
+	mode, ok := batchModes[name]
+	if !ok {
+		return sendMode{}, fmt.Errorf("unknown batch type: %s", name)
+	}
+	return mode, nil
+}
@@ -0,0 +1,773 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+type fakeStore struct {
+	tasks     [7]*time.Time
+	completed map[int]bool
+	maxSent   int64
+	sent      map[int]time.Time
+	saved     bool
+	status    map[int]string
+	prov      []models.TaskProvenance
+	generated map[int]bool
+	cancelled *models.Cancellation
+	tasksErr  error
+}
+
+func (f *fakeStore) fetchTaskTimes(models.AntrianReferensi) ([7]*time.Time, [7]models.TaskProvenance, error) {
+	var prov [7]models.TaskProvenance
+	for i, t := range f.tasks {
+		if t != nil {
+			prov[i] = models.TaskProvenance{TaskID: i + 1, Source: "test", Original: FormatTime(t)}
+		}
+		if f.generated[i+1] {
+			prov[i] = models.TaskProvenance{TaskID: i + 1, Source: "generated", Generated: true}
+		}
+	}
+	return f.tasks, prov, nil
+}
+
+func (f *fakeStore) saveTaskIDs(models.AntrianReferensi, [7]*time.Time, [7]models.TaskProvenance, string) error {
+	f.saved = true
+	return nil
+}
+
+func (f *fakeStore) saveProvenance(_ string, provs []models.TaskProvenance) {
+	f.prov = provs
+}
+
+func (f *fakeStore) saveCancellation(c models.Cancellation) error {
+	f.cancelled = &c
+	return nil
+}
+
+func (f *fakeStore) getCompletedTaskIDs(string) (map[int]bool, error) { return f.completed, f.tasksErr }
+func (f *fakeStore) getMaxSentTime(string) (int64, error)             { return f.maxSent, f.tasksErr }
+func (f *fakeStore) getSentTimes(string) (map[int]time.Time, error)   { return f.sent, f.tasksErr }
+
+func (f *fakeStore) updateTaskStatus(_ string, taskID int, status string) {
+	f.status[taskID] = status
+}
+
+type sentTask struct {
+	taskID  int
+	waktuMs int64
+}
+
+// fakeSender answers from a script keyed by task ID; each call for a task
+// consumes the next answer. Tasks without a script are accepted with 200.
+type fakeSender struct {
+	script map[int][]fakeAnswer
+	sent   []sentTask
+}
+
+type fakeAnswer struct {
+	code    int
+	message string
+	err     error
+}
+
+func (f *fakeSender) UpdateWaktuContext(_ context.Context, _ string, taskID int, waktuMs int64) (*bpjs.BPJSResponse, error) {
+	f.sent = append(f.sent, sentTask{taskID, waktuMs})
+	answer := fakeAnswer{code: 200, message: "Ok."}
+	if queue := f.script[taskID]; len(queue) > 0 {
+		answer = queue[0]
+		f.script[taskID] = queue[1:]
+	}
+	if answer.err != nil {
+		return nil, answer.err
+	}
+	resp := &bpjs.BPJSResponse{}
+	resp.Metadata.Code = answer.code
+	resp.Metadata.Message = answer.message
+	return resp, nil
+}
+
+type fakeResults struct {
+	saved []models.ProcessResult
+}
+
+func (f *fakeResults) SaveResult(r models.ProcessResult) error {
+	f.saved = append(f.saved, r)
+	return nil
+}
+
+func at(hhmm string) *time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", "2025-12-28 "+hhmm, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return &t
+}
+
+func ms(hhmm string) int64 { return at(hhmm).UnixMilli() }
+
+func TestPipelineProcess(t *testing.T) {
+	fiveTasks := [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50")}
+	orderingViolation := fakeAnswer{code: 201, message: "TaskId=3 tidak boleh kurang atau sama dengan TaskId sebelumnya"}
+
+	tests := []struct {
+		name       string
+		mode       sendMode
+		tasks      [7]*time.Time
+		completed  map[int]bool
+		sent       map[int]time.Time
+		script     map[int][]fakeAnswer
+		wantSent   []sentTask
+		wantStatus map[int]string
+		wantResult map[int]string
+		wantDone   bool
+		wantHeld   bool
+	}{
+		{
+			name:       "all accepted",
+			mode:       modeAll,
+			tasks:      fiveTasks,
+			wantSent:   []sentTask{{1, ms("08:10")}, {2, ms("08:20")}, {3, ms("08:30")}, {4, ms("08:40")}, {5, ms("08:50")}},
+			wantStatus: map[int]string{1: "Sudah", 2: "Sudah", 3: "Sudah", 4: "Sudah", 5: "Sudah"},
+			wantResult: map[int]string{1: "success", 2: "success", 3: "success", 4: "success", 5: "success", 6: "skipped", 7: "skipped"},
+			wantDone:   true,
+		},
+		{
+			name:       "already Sudah is not resent",
+			mode:       modeAll,
+			tasks:      fiveTasks,
+			completed:  map[int]bool{1: true, 2: true},
+			sent:       map[int]time.Time{1: *at("08:10"), 2: *at("08:20")},
+			wantSent:   []sentTask{{3, ms("08:30")}, {4, ms("08:40")}, {5, ms("08:50")}},
+			wantStatus: map[int]string{3: "Sudah", 4: "Sudah", 5: "Sudah"},
+			wantResult: map[int]string{1: "skipped", 2: "skipped", 3: "success", 4: "success", 5: "success", 6: "skipped", 7: "skipped"},
+			wantDone:   true,
+		},
+		{
+			name:       "208 counts as accepted",
+			mode:       modeUpdateWaktu,
+			tasks:      fiveTasks,
+			script:     map[int][]fakeAnswer{2: {{code: 208, message: "TaskId=2 sudah ada"}}},
+			wantSent:   []sentTask{{1, ms("08:10")}, {2, ms("08:20")}, {3, ms("08:30")}, {4, ms("08:40")}, {5, ms("08:50")}},
+			wantStatus: map[int]string{1: "Sudah", 2: "Sudah", 3: "Sudah", 4: "Sudah", 5: "Sudah"},
+			wantResult: map[int]string{1: "success", 2: "success", 3: "success", 4: "success", 5: "success", 6: "skipped", 7: "skipped"},
+			wantDone:   true,
+		},
+		{
+			name:       "waktu at or before an accepted task is held",
+			mode:       modeWatcher,
+			tasks:      [7]*time.Time{nil, nil, at("08:30")},
+			completed:  map[int]bool{1: true, 2: true},
+			sent:       map[int]time.Time{2: *at("08:45")},
+			wantSent:   nil,
+			wantStatus: map[int]string{},
+			wantResult: map[int]string{},
+			wantDone:   false,
+			wantHeld:   true,
+		},
+		{
+			name:       "ordering violation is not retried",
+			mode:       modeRetryTask3,
+			tasks:      [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("10:00")},
+			script:     map[int][]fakeAnswer{3: {orderingViolation}},
+			wantSent:   []sentTask{{3, ms("08:30")}},
+			wantStatus: map[int]string{},
+			wantResult: map[int]string{3: "failed"},
+			wantDone:   false,
+		},
+		{
+			name:       "transport error",
+			mode:       modeAll,
+			tasks:      [7]*time.Time{at("08:10"), at("08:20")},
+			script:     map[int][]fakeAnswer{2: {{err: errors.New("connection refused")}}},
+			wantSent:   []sentTask{{1, ms("08:10")}, {2, ms("08:20")}},
+			wantStatus: map[int]string{1: "Sudah"},
+			wantResult: map[int]string{1: "success", 2: "error", 3: "skipped", 4: "skipped", 5: "skipped", 6: "skipped", 7: "skipped"},
+			wantDone:   false,
+		},
+		{
+			name:       "retrytask3 only sends Task 3",
+			mode:       modeRetryTask3,
+			tasks:      fiveTasks,
+			wantSent:   []sentTask{{3, ms("08:30")}},
+			wantStatus: map[int]string{3: "Sudah"},
+			wantResult: map[int]string{3: "success"},
+			wantDone:   true,
+		},
+		{
+			name:       "autoorder sends nothing",
+			mode:       modeAutoOrder,
+			tasks:      fiveTasks,
+			wantSent:   nil,
+			wantStatus: map[int]string{},
+			wantResult: map[int]string{1: "", 2: "", 3: "", 4: "", 5: ""},
+			wantDone:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{
+				tasks:     tt.tasks,
+				completed: tt.completed,
+				sent:      tt.sent,
+				status:    map[int]string{},
+			}
+			if store.completed == nil {
+				store.completed = map[int]bool{}
+			}
+			script := tt.script
+			if script == nil {
+				script = map[int][]fakeAnswer{}
+			}
+			sender := &fakeSender{script: script}
+			results := &fakeResults{}
+			p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: results}
+
+			result := p.Process(context.Background(), models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1"}, tt.mode)
+
+			if store.saved == tt.wantHeld {
+				t.Errorf("task rows saved = %v, want %v", store.saved, !tt.wantHeld)
+			}
+			if (len(result.Violations) > 0) != tt.wantHeld {
+				t.Errorf("violations %+v, want held %v", result.Violations, tt.wantHeld)
+			}
+			if len(results.saved) != 1 {
+				t.Fatalf("saved %d results, want 1", len(results.saved))
+			}
+			if len(sender.sent) != len(tt.wantSent) {
+				t.Fatalf("sent %v, want %v", sender.sent, tt.wantSent)
+			}
+			for i := range tt.wantSent {
+				if sender.sent[i] != tt.wantSent[i] {
+					t.Errorf("send %d = %+v, want %+v", i, sender.sent[i], tt.wantSent[i])
+				}
+			}
+			if len(store.status) != len(tt.wantStatus) {
+				t.Errorf("status updates %v, want %v", store.status, tt.wantStatus)
+			}
+			for taskID, status := range tt.wantStatus {
+				if store.status[taskID] != status {
+					t.Errorf("task %d status = %q, want %q", taskID, store.status[taskID], status)
+				}
+			}
+			if len(result.Tasks) != len(tt.wantResult) {
+				t.Errorf("result tasks %v, want %v", result.Tasks, tt.wantResult)
+			}
+			for taskID, status := range tt.wantResult {
+				got, ok := result.Tasks[taskID]
+				if !ok {
+					t.Errorf("task %d missing from result", taskID)
+					continue
+				}
+				if got.BPJSStatus != status {
+					t.Errorf("task %d BPJSStatus = %q, want %q", taskID, got.BPJSStatus, status)
+				}
+			}
+			if result.UpdateWaktuDone != tt.wantDone {
+				t.Errorf("UpdateWaktuDone = %v, want %v", result.UpdateWaktuDone, tt.wantDone)
+			}
+		})
+	}
+}
+
+func TestPipelineSkipsUnreadableTaskIDs(t *testing.T) {
+	for _, mode := range []sendMode{modeAll, modeWatcher, modeIncremental} {
+		t.Run(mode.name, func(t *testing.T) {
+			store := &fakeStore{
+				tasks:    [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+				status:   map[int]string{},
+				tasksErr: errors.New("connection reset"),
+			}
+			sender := &fakeSender{script: map[int][]fakeAnswer{}}
+			p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: &fakeResults{}}
+			entry := models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1"}
+
+			result := p.Process(context.Background(), entry, mode)
+			if result.Error == "" {
+				t.Errorf("Process error empty, want the TaskIDs error")
+			}
+			if store.saved || len(sender.sent) > 0 {
+				t.Errorf("saved %v, sent %v; want the entry skipped", store.saved, sender.sent)
+			}
+			if _, err := p.readyTaskIDs(entry); err == nil {
+				t.Errorf("readyTaskIDs error nil, want the TaskIDs error")
+			}
+		})
+	}
+}
+
+// fakeEntryRepo serves the incremental watcher's entry queries; every other
+// repository call panics.
+type fakeEntryRepo struct {
+	database.Repository
+	incomplete []models.AntrianReferensi
+	tasksErr   error
+}
+
+func (f *fakeEntryRepo) TaskIDs(string) ([]models.TaskID, error) {
+	return nil, f.tasksErr
+}
+
+func (f *fakeEntryRepo) CancelledEntries(string) ([]models.AntrianReferensi, error) {
+	return nil, nil
+}
+
+func (f *fakeEntryRepo) IncompleteEntries(string) ([]models.AntrianReferensi, error) {
+	return f.incomplete, nil
+}
+
+func TestWatcherIncrementalIgnoresStatusKirim(t *testing.T) {
+	entry := models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1", StatusKirim: "Belum"}
+	store := &fakeStore{
+		tasks:     [7]*time.Time{at("08:10")},
+		completed: map[int]bool{},
+		status:    map[int]string{},
+	}
+	sender := &fakeSender{script: map[int][]fakeAnswer{}}
+	w := &Watcher{
+		ctx:         context.Background(),
+		repo:        &fakeEntryRepo{incomplete: []models.AntrianReferensi{entry}},
+		pipeline:    &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: &fakeResults{}},
+		incremental: true,
+	}
+
+	if n := w.checkAndProcess(); n != 1 {
+		t.Errorf("processed %d entries, want 1", n)
+	}
+	if len(sender.sent) != 1 || sender.sent[0] != (sentTask{1, ms("08:10")}) {
+		t.Errorf("sent %v, want Task 1 at 08:10", sender.sent)
+	}
+	if store.status[1] != "Sudah" {
+		t.Errorf("task 1 status = %q, want Sudah", store.status[1])
+	}
+}
+
+func TestRepoStoreFetchTaskTimesFailsOnUnreadableTaskIDs(t *testing.T) {
+	s := &repoStore{repo: &fakeEntryRepo{tasksErr: errors.New("connection reset")}}
+	if _, _, err := s.fetchTaskTimes(models.AntrianReferensi{NomorReferensi: "REF1"}); err == nil {
+		t.Error("fetchTaskTimes error nil, want the TaskIDs error")
+	}
+}
+
+type fakeLister struct {
+	tasks []bpjs.ListTask
+}
+
+func (f *fakeLister) GetListTaskContext(context.Context, string) ([]bpjs.ListTask, *bpjs.BPJSResponse, error) {
+	resp := &bpjs.BPJSResponse{}
+	resp.Metadata.Code = 200
+	return f.tasks, resp, nil
+}
+
+func TestPipelineHoldsInvalidPlans(t *testing.T) {
+	tests := []struct {
+		name       string
+		tasks      [7]*time.Time
+		sent       map[int]time.Time
+		remote     []bpjs.ListTask
+		review     bool
+		wantRules  []string
+		wantParked bool
+		wantSent   int
+	}{
+		{
+			name:      "task before a locally accepted one",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+			sent:      map[int]time.Time{4: *at("08:25")},
+			wantRules: []string{ViolationConflictsAccepted},
+		},
+		{
+			name:      "task before one BPJS lists",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+			remote:    []bpjs.ListTask{{TaskID: 2, WaktuRS: "28-12-2025 08:40:00 WIB"}},
+			wantRules: []string{ViolationConflictsAccepted},
+		},
+		{
+			name:       "invalid plan parked for review",
+			tasks:      [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+			sent:       map[int]time.Time{4: *at("08:25")},
+			review:     true,
+			wantRules:  []string{ViolationConflictsAccepted},
+			wantParked: true,
+		},
+		{
+			name:     "valid plan is sent",
+			tasks:    [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+			remote:   []bpjs.ListTask{{TaskID: 1, WaktuRS: "28-12-2025 08:10:00 WIB"}},
+			wantSent: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{tasks: tt.tasks, completed: map[int]bool{}, sent: tt.sent, status: map[int]string{}}
+			sender := &fakeSender{script: map[int][]fakeAnswer{}}
+			p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: &fakeResults{}}
+			if tt.remote != nil {
+				p.lister = &fakeLister{tasks: tt.remote}
+			}
+			reviews := &fakeReviews{}
+			if tt.review {
+				p.reviews = reviews
+			}
+
+			result := p.Process(context.Background(), models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1", TanggalPeriksa: "2025-12-28"}, modeAll)
+
+			var rules []string
+			for _, v := range result.Violations {
+				rules = append(rules, v.Rule)
+			}
+			if fmt.Sprint(rules) != fmt.Sprint(tt.wantRules) {
+				t.Errorf("violations %+v, want rules %v", result.Violations, tt.wantRules)
+			}
+			if len(sender.sent) != tt.wantSent {
+				t.Errorf("sent %v, want %d sends", sender.sent, tt.wantSent)
+			}
+			if len(tt.wantRules) > 0 && store.saved {
+				t.Errorf("held entry was written to the task table")
+			}
+			if tt.wantParked {
+				if len(reviews.parked) != 1 || reviews.parked[0].Reasons[0] != models.ReviewReasonInvalidPlan {
+					t.Fatalf("parked %+v, want one %s review", reviews.parked, models.ReviewReasonInvalidPlan)
+				}
+				if result.Review != models.ReviewPending {
+					t.Errorf("review = %q, want pending", result.Review)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineRecordsProvenance(t *testing.T) {
+	store := &fakeStore{
+		tasks:     [7]*time.Time{at("07:30"), at("08:20"), at("08:30")},
+		completed: map[int]bool{},
+		status:    map[int]string{},
+	}
+	sender := &fakeSender{script: map[int][]fakeAnswer{
+		3: {{code: 201, message: "waktu tidak boleh kurang atau sama"}},
+	}}
+	p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: &fakeResults{}}
+
+	result := p.Process(context.Background(), models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1"}, modeAll)
+
+	byTask := map[int]models.TaskProvenance{}
+	for _, prov := range store.prov {
+		byTask[prov.TaskID] = prov
+	}
+
+	tests := []struct {
+		taskID      int
+		original    string
+		final       string
+		adjustments int
+	}{
+		{1, "2025-12-28 07:30:00", "2025-12-28 08:00:00", 1},
+		{2, "2025-12-28 08:20:00", "2025-12-28 08:20:00", 0},
+		{3, "2025-12-28 08:30:00", "2025-12-28 08:30:00", 0},
+	}
+	for _, tt := range tests {
+		prov, ok := byTask[tt.taskID]
+		if !ok {
+			t.Errorf("task %d: no provenance saved", tt.taskID)
+			continue
+		}
+		if prov.Source != "test" || prov.Original != tt.original {
+			t.Errorf("task %d: source %q original %q, want test %q", tt.taskID, prov.Source, prov.Original, tt.original)
+		}
+		if prov.Final != tt.final {
+			t.Errorf("task %d: final %q, want %q", tt.taskID, prov.Final, tt.final)
+		}
+		if len(prov.Adjustments) != tt.adjustments {
+			t.Errorf("task %d: adjustments %+v, want %d", tt.taskID, prov.Adjustments, tt.adjustments)
+		}
+		if result.Tasks[tt.taskID].Provenance == nil {
+			t.Errorf("task %d: provenance missing from report", tt.taskID)
+		}
+	}
+}
+
+func TestPipelineFaithfulHoldsUnbackedEntries(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      sendMode
+		tasks     [7]*time.Time
+		generated map[int]bool
+		completed map[int]bool
+		wantUnits []string
+		wantSent  int
+	}{
+		{
+			name:      "generated task held for its unit",
+			mode:      modeAll,
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50")},
+			generated: map[int]bool{3: true, 5: true},
+			wantUnits: []string{UnitRekamMedis, UnitPoli},
+		},
+		{
+			name:      "lone pharmacy task held for apotek",
+			mode:      modeAll,
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50"), at("09:00")},
+			wantUnits: []string{UnitApotek},
+		},
+		{
+			name:      "generated task already Sudah does not block",
+			mode:      modeAll,
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+			generated: map[int]bool{3: true},
+			completed: map[int]bool{3: true},
+			wantSent:  2,
+		},
+		{
+			name:      "generated task outside the mode does not block",
+			mode:      modeRetryTask3,
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40")},
+			generated: map[int]bool{4: true},
+			wantSent:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{
+				tasks:     tt.tasks,
+				generated: tt.generated,
+				completed: tt.completed,
+				status:    map[int]string{},
+			}
+			if store.completed == nil {
+				store.completed = map[int]bool{}
+			}
+			sender := &fakeSender{script: map[int][]fakeAnswer{}}
+			p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: &fakeResults{}, faithful: true}
+
+			result := p.Process(context.Background(), models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1"}, tt.mode)
+
+			if len(result.NeedsData) != len(tt.wantUnits) {
+				t.Fatalf("needs data %+v, want units %v", result.NeedsData, tt.wantUnits)
+			}
+			for i, unit := range tt.wantUnits {
+				if result.NeedsData[i].Unit != unit {
+					t.Errorf("needs data %d unit = %q, want %q", i, result.NeedsData[i].Unit, unit)
+				}
+			}
+			if len(tt.wantUnits) > 0 && (store.saved || result.AutoOrderDone) {
+				t.Errorf("held entry was written to the task table")
+			}
+			if len(sender.sent) != tt.wantSent {
+				t.Errorf("sent %v, want %d sends", sender.sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+type fakeReviews struct {
+	review *models.ReviewEntry
+	parked []models.ReviewEntry
+	sent   []int64
+}
+
+func (f *fakeReviews) GetReview(string) (*models.ReviewEntry, error) { return f.review, nil }
+
+func (f *fakeReviews) ParkReview(r models.ReviewEntry) error {
+	f.parked = append(f.parked, r)
+	return nil
+}
+
+func (f *fakeReviews) MarkReviewSent(id int64) error {
+	f.sent = append(f.sent, id)
+	return nil
+}
+
+func TestPipelineReviewQueue(t *testing.T) {
+	approved := &models.ReviewEntry{ID: 7, Status: models.ReviewApproved, Tasks: []models.ReviewTask{
+		{TaskID: 1, Waktu: "2025-12-28 08:05:00"},
+		{TaskID: 2, Waktu: "2025-12-28 08:20:00"},
+	}}
+
+	sent := &models.ReviewEntry{ID: 8, Status: models.ReviewSent, Tasks: approved.Tasks}
+
+	tests := []struct {
+		name        string
+		tasks       [7]*time.Time
+		generated   map[int]bool
+		completed   map[int]bool
+		review      *models.ReviewEntry
+		script      map[int][]fakeAnswer
+		wantParked  []string
+		wantSent    []sentTask
+		wantMarked  bool
+		wantWritten bool
+	}{
+		{
+			name:       "auto order change is parked",
+			tasks:      [7]*time.Time{at("07:30"), at("08:20")},
+			wantParked: []string{models.ReviewReasonAutoOrder},
+		},
+		{
+			name:   "pending review holds the entry",
+			tasks:  [7]*time.Time{at("08:10"), at("08:20")},
+			review: &models.ReviewEntry{ID: 3, Status: models.ReviewPending},
+		},
+		{
+			name:        "approved review sends the reviewed times",
+			tasks:       [7]*time.Time{at("07:30"), at("08:20")},
+			review:      approved,
+			wantSent:    []sentTask{{1, ms("08:05")}, {2, ms("08:20")}},
+			wantMarked:  true,
+			wantWritten: true,
+		},
+		{
+			name:       "approved review does not cover a generated task",
+			tasks:      [7]*time.Time{at("07:30"), at("08:20"), at("08:30")},
+			generated:  map[int]bool{3: true},
+			review:     approved,
+			wantParked: []string{models.ReviewReasonMissingData},
+		},
+		{
+			name:        "sent review lets a recorded new task through",
+			tasks:       [7]*time.Time{at("08:05"), at("08:20"), at("08:30")},
+			completed:   map[int]bool{1: true, 2: true},
+			review:      sent,
+			wantSent:    []sentTask{{3, ms("08:30")}},
+			wantWritten: true,
+		},
+		{
+			name:        "ordering rejection is parked instead of retried",
+			tasks:       [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+			script:      map[int][]fakeAnswer{2: {{code: 201, message: "TaskId=2 tidak boleh kurang"}}},
+			wantParked:  []string{models.ReviewReasonOrderingRejected},
+			wantSent:    []sentTask{{1, ms("08:10")}, {2, ms("08:20")}},
+			wantWritten: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{
+				tasks:     tt.tasks,
+				generated: tt.generated,
+				completed: tt.completed,
+				status:    map[int]string{},
+			}
+			if store.completed == nil {
+				store.completed = map[int]bool{}
+			}
+			script := tt.script
+			if script == nil {
+				script = map[int][]fakeAnswer{}
+			}
+			sender := &fakeSender{script: script}
+			reviews := &fakeReviews{review: tt.review}
+			p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: &fakeResults{}, reviews: reviews}
+
+			p.Process(context.Background(), models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1"}, modeAll)
+
+			if len(reviews.parked) != 0 || len(tt.wantParked) != 0 {
+				if len(reviews.parked) != 1 {
+					t.Fatalf("parked %d reviews, want 1", len(reviews.parked))
+				}
+				got := reviews.parked[0].Reasons
+				if len(got) != len(tt.wantParked) || got[0] != tt.wantParked[0] {
+					t.Errorf("reasons = %v, want %v", got, tt.wantParked)
+				}
+			}
+			if len(sender.sent) != len(tt.wantSent) {
+				t.Fatalf("sent %v, want %v", sender.sent, tt.wantSent)
+			}
+			for i := range tt.wantSent {
+				if sender.sent[i] != tt.wantSent[i] {
+					t.Errorf("send %d = %+v, want %+v", i, sender.sent[i], tt.wantSent[i])
+				}
+			}
+			if (len(reviews.sent) > 0) != tt.wantMarked {
+				t.Errorf("review marked sent = %v, want %v", reviews.sent, tt.wantMarked)
+			}
+			if store.saved != tt.wantWritten {
+				t.Errorf("task rows written = %v, want %v", store.saved, tt.wantWritten)
+			}
+		})
+	}
+}
+
+func TestPipelineIncrementalSendsReadyTasks(t *testing.T) {
+	tests := []struct {
+		name      string
+		tasks     [7]*time.Time
+		generated map[int]bool
+		completed map[int]bool
+		maxSent   int64
+		wantSent  []int
+	}{
+		{
+			name:      "generated tasks wait for a later record",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40")},
+			generated: map[int]bool{3: true, 4: true},
+			wantSent:  []int{1, 2},
+		},
+		{
+			name:      "later record releases the generated tasks before it",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50")},
+			generated: map[int]bool{3: true, 4: true},
+			completed: map[int]bool{1: true, 2: true},
+			maxSent:   ms("08:20"),
+			wantSent:  []int{3, 4, 5},
+		},
+		{
+			name:     "lone pharmacy task waits for the other",
+			tasks:    [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50"), at("09:00")},
+			wantSent: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:      "nothing ready sends nothing",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30")},
+			generated: map[int]bool{3: true},
+			completed: map[int]bool{1: true, 2: true},
+			maxSent:   ms("08:20"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{
+				tasks:     tt.tasks,
+				generated: tt.generated,
+				completed: tt.completed,
+				maxSent:   tt.maxSent,
+				status:    map[int]string{},
+			}
+			if store.completed == nil {
+				store.completed = map[int]bool{}
+			}
+			sender := &fakeSender{script: map[int][]fakeAnswer{}}
+			p := &Pipeline{store: store, sender: sender, processor: NewAutoOrderProcessor(), results: &fakeResults{}}
+			entry := models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1"}
+
+			ready, err := p.readyTaskIDs(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(ready) != fmt.Sprint(tt.wantSent) {
+				t.Errorf("ready %v, want %v", ready, tt.wantSent)
+			}
+
+			p.Process(context.Background(), entry, modeIncremental)
+
+			var sent []int
+			for _, s := range sender.sent {
+				sent = append(sent, s.taskID)
+			}
+			if fmt.Sprint(sent) != fmt.Sprint(tt.wantSent) {
+				t.Errorf("sent %v, want %v", sent, tt.wantSent)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package service
 
 import (
+	"fmt"
 	"math/rand"
 	"time"
+
+	"gotrol/internal/models"
 )
 
 type AutoOrderProcessor struct{}
@@ -11,36 +14,80 @@ func NewAutoOrderProcessor() *AutoOrderProcessor {
 	return &AutoOrderProcessor{}
 }
 
-func (p *AutoOrderProcessor) ProcessTasks(tasks [7]*time.Time) [7]*time.Time {
-	result := tasks
+// Rule names reported in OrderResult.Rules.
+const (
+	RulePharmacyIdentical   = "pharmacy_identical"
+	RuleClampOpeningHour    = "clamp_opening_hour"
+	RuleTask4AfterTask3     = "task4_after_task3"
+	RuleAfterPrevious       = "after_previous_task"
+	RulePharmacyIncomplete  = "pharmacy_incomplete"
+	RulePharmacyAtAdmission = "pharmacy_at_admission"
+)
+
+// OrderResult is the outcome of ProcessTasks: the ordered times and every
+// rule that changed one of them, in the order the rules fired.
+type OrderResult struct {
+	Tasks [7]*time.Time
+	Rules []models.AutoOrderRule
+}
+
+// Adjustments returns the changes made to task i as provenance entries.
+func (r OrderResult) Adjustments(i int) []models.TaskAdjustment {
+	var adjustments []models.TaskAdjustment
+	for _, rule := range r.Rules {
+		if rule.TaskID == i+1 {
+			adjustments = append(adjustments, models.TaskAdjustment{
+				Reason: rule.Reason,
+				Before: rule.Before,
+				After:  rule.After,
+			})
+		}
+	}
+	return adjustments
+}
+
+func (p *AutoOrderProcessor) ProcessTasks(tasks [7]*time.Time) OrderResult {
+	result := OrderResult{Tasks: tasks, Rules: []models.AutoOrderRule{}}
+	fire := func(i int, rule, reason string, after *time.Time) {
+		adj := models.NewTaskAdjustment(reason, result.Tasks[i], after)
+		result.Rules = append(result.Rules, models.AutoOrderRule{
+			Rule:   rule,
+			TaskID: i + 1,
+			Reason: reason,
+			Before: adj.Before,
+			After:  adj.After,
+		})
+		result.Tasks[i] = after
+	}
+	t := &result.Tasks
 
-	if result[5] != nil && result[6] != nil {
-		if result[5].Equal(*result[6]) {
-			result[5] = nil
-			result[6] = nil
+	if t[5] != nil && t[6] != nil {
+		if t[5].Equal(*t[6]) {
+			fire(5, RulePharmacyIdentical, "Task 6 equals Task 7, cleared", nil)
+			fire(6, RulePharmacyIdentical, "Task 6 equals Task 7, cleared", nil)
 		}
 	}
 
 	for i := 0; i < 7; i++ {
-		if result[i] != nil {
-			t := *result[i]
-			if t.Hour() < 8 {
-				t = time.Date(t.Year(), t.Month(), t.Day(), 8, 0, 0, 0, t.Location())
-				result[i] = &t
+		if t[i] != nil {
+			tm := *t[i]
+			if tm.Hour() < 8 {
+				tm = time.Date(tm.Year(), tm.Month(), tm.Day(), 8, 0, 0, 0, tm.Location())
+				fire(i, RuleClampOpeningHour, "before 08:00, clamped", &tm)
 			}
 		}
 	}
 
-	if result[2] != nil && result[3] != nil {
-		task3 := *result[2]
-		task4 := *result[3]
+	if t[2] != nil && t[3] != nil {
+		task3 := *t[2]
+		task4 := *t[3]
 		if task4.Before(task3) || task4.Equal(task3) {
 
 			randomMinutes := rand.Intn(5) + 1
 			newTask4 := task3.Add(time.Duration(randomMinutes) * time.Minute)
 
-			if result[4] != nil {
-				task5 := *result[4]
+			if t[4] != nil {
+				task5 := *t[4]
 				if newTask4.After(task5) || newTask4.Equal(task5) {
 					maxAllowed := int(task5.Sub(task3).Minutes()) - 1
 					if maxAllowed < 1 {
@@ -49,21 +96,21 @@ func (p *AutoOrderProcessor) ProcessTasks(tasks [7]*time.Time) [7]*time.Time {
 					newTask4 = task3.Add(time.Duration(maxAllowed) * time.Minute)
 				}
 			}
-			result[3] = &newTask4
+			fire(3, RuleTask4AfterTask3, "not after Task 3, moved after it", &newTask4)
 		}
 	}
 
 	for i := 1; i < 7; i++ {
-		if result[i-1] != nil && result[i] != nil {
-			prev := *result[i-1]
-			curr := *result[i]
+		if t[i-1] != nil && t[i] != nil {
+			prev := *t[i-1]
+			curr := *t[i]
 			if curr.Before(prev) || curr.Equal(prev) {
 
 				randomMinutes := rand.Intn(5) + 1
 				newTime := prev.Add(time.Duration(randomMinutes) * time.Minute)
 
-				if i+1 < 7 && result[i+1] != nil {
-					nextTask := *result[i+1]
+				if i+1 < 7 && t[i+1] != nil {
+					nextTask := *t[i+1]
 					if newTime.After(nextTask) || newTime.Equal(nextTask) {
 						maxAllowed := int(nextTask.Sub(prev).Minutes()) - 1
 						if maxAllowed < 1 {
@@ -72,21 +119,25 @@ func (p *AutoOrderProcessor) ProcessTasks(tasks [7]*time.Time) [7]*time.Time {
 						newTime = prev.Add(time.Duration(maxAllowed) * time.Minute)
 					}
 				}
-				result[i] = &newTime
+				fire(i, RuleAfterPrevious, fmt.Sprintf("not after Task %d, moved after it", i), &newTime)
 			}
 		}
 	}
 
-	if result[5] == nil || result[6] == nil {
-		result[5] = nil
-		result[6] = nil
+	if t[5] == nil || t[6] == nil {
+		if t[5] != nil {
+			fire(5, RulePharmacyIncomplete, "Task 7 missing, pharmacy tasks cleared", nil)
+		}
+		if t[6] != nil {
+			fire(6, RulePharmacyIncomplete, "Task 6 missing, pharmacy tasks cleared", nil)
+		}
 	}
 
-	if result[5] != nil && result[6] != nil {
-		task1 := result[0]
-		task2 := result[1]
-		task6 := result[5]
-		task7 := result[6]
+	if t[5] != nil && t[6] != nil {
+		task1 := t[0]
+		task2 := t[1]
+		task6 := t[5]
+		task7 := t[6]
 
 		shouldClear := false
 		if task1 != nil && (task6.Equal(*task1) || task7.Equal(*task1)) {
@@ -96,8 +147,8 @@ func (p *AutoOrderProcessor) ProcessTasks(tasks [7]*time.Time) [7]*time.Time {
 			shouldClear = true
 		}
 		if shouldClear {
-			result[5] = nil
-			result[6] = nil
+			fire(5, RulePharmacyAtAdmission, "pharmacy time equals Task 1 or 2, cleared", nil)
+			fire(6, RulePharmacyAtAdmission, "pharmacy time equals Task 1 or 2, cleared", nil)
 		}
 	}
 
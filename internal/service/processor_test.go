@@ -0,0 +1,81 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcessTasksReportsRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		tasks     [7]*time.Time
+		wantRules []string
+		wantTasks map[int]string
+	}{
+		{
+			name:      "ordered times fire nothing",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50"), at("09:00"), at("09:10")},
+			wantRules: nil,
+			wantTasks: map[int]string{1: "08:10", 7: "09:10"},
+		},
+		{
+			name:      "clamped to opening hour",
+			tasks:     [7]*time.Time{at("07:30"), at("08:20")},
+			wantRules: []string{RuleClampOpeningHour},
+			wantTasks: map[int]string{1: "08:00", 2: "08:20"},
+		},
+		{
+			name:      "identical pharmacy times cleared",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), nil, nil, nil, at("09:00"), at("09:00")},
+			wantRules: []string{RulePharmacyIdentical, RulePharmacyIdentical},
+			wantTasks: map[int]string{6: "", 7: ""},
+		},
+		{
+			name:      "lone pharmacy task cleared",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), nil, nil, nil, at("09:00")},
+			wantRules: []string{RulePharmacyIncomplete},
+			wantTasks: map[int]string{6: ""},
+		},
+		{
+			name:      "pharmacy at admission time cleared",
+			tasks:     [7]*time.Time{at("08:10"), at("08:20"), nil, nil, nil, at("08:10"), at("09:00")},
+			wantRules: []string{RulePharmacyAtAdmission, RulePharmacyAtAdmission},
+			wantTasks: map[int]string{6: "", 7: ""},
+		},
+		{
+			name:      "task 4 moved after task 3 within task 5",
+			tasks:     [7]*time.Time{nil, nil, at("09:00"), at("08:50"), at("09:02")},
+			wantRules: []string{RuleTask4AfterTask3},
+			wantTasks: map[int]string{4: "09:01"},
+		},
+	}
+
+	p := NewAutoOrderProcessor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.ProcessTasks(tt.tasks)
+
+			if len(got.Rules) != len(tt.wantRules) {
+				t.Fatalf("rules %+v, want %v", got.Rules, tt.wantRules)
+			}
+			for i, rule := range got.Rules {
+				if rule.Rule != tt.wantRules[i] {
+					t.Errorf("rule %d = %s, want %s", i, rule.Rule, tt.wantRules[i])
+				}
+				before := tt.tasks[rule.TaskID-1]
+				if i == 0 && before != nil && rule.Before != FormatTime(before) {
+					t.Errorf("rule %d before = %q, want %q", i, rule.Before, FormatTime(before))
+				}
+			}
+			for taskID, want := range tt.wantTasks {
+				gotTask := got.Tasks[taskID-1]
+				switch {
+				case want == "" && gotTask != nil:
+					t.Errorf("task %d = %s, want cleared", taskID, FormatTime(gotTask))
+				case want != "" && (gotTask == nil || gotTask.Format("15:04") != want):
+					t.Errorf("task %d = %s, want %s", taskID, FormatTime(gotTask), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+	"gotrol/internal/report"
+)
+
+// Waktu differences up to this size are rounding between our millisecond
+// timestamps and the second-resolution strings BPJS returns.
+const reconcileTolerance = time.Second
+
+type Reconciler struct {
+	repo        database.Repository
+	bpjsClient  *bpjs.Client
+	reportStore *report.Store
+}
+
+func NewReconciler(repo database.Repository, bpjsClient *bpjs.Client, reportStore *report.Store) *Reconciler {
+	return &Reconciler{
+		repo:        repo,
+		bpjsClient:  bpjsClient,
+		reportStore: reportStore,
+	}
+}
+
+// Reconcile compares every BPJS entry of the date against antrean/getlisttask.
+// When fix is true, tasks BPJS already holds are marked Sudah locally with
+// the time BPJS recorded.
+func (r *Reconciler) Reconcile(date string, fix bool) (*models.ReconcileReport, error) {
+	log.Printf("🔍 Starting reconciliation for date: %s", date)
+
+	entries, err := r.repo.BookedEntries(date)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("📋 Found %d BPJS patients", len(entries))
+
+	results, err := r.reportStore.GetResultsByDate(date)
+	if err != nil {
+		return nil, fmt.Errorf("reading report results: %w", err)
+	}
+	reportStatus := make(map[string]map[int]string)
+	for _, res := range results {
+		statuses := make(map[int]string)
+		for taskID, t := range res.Tasks {
+			statuses[taskID] = t.BPJSStatus
+		}
+		reportStatus[res.NomorReferensi] = statuses
+	}
+
+	rep := &models.ReconcileReport{Date: date}
+
+	for idx, entry := range entries {
+		log.Printf("[%d/%d] %s - %s | %s", idx+1, len(entries), entry.NoRkmMedis, entry.NamaPasien, entry.KodeBooking)
+
+		remote, resp, err := r.bpjsClient.GetListTaskContext(bpjs.WithCorrelation(context.Background(), entry.NomorReferensi, 0), entry.KodeBooking)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", entry.KodeBooking, err))
+			continue
+		}
+		switch resp.Category() {
+		case bpjs.CategorySuccess:
+		case bpjs.CategoryKodeBookingNotFound:
+			// BPJS holds no task for this booking yet.
+			remote = nil
+		default:
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %d %s", entry.KodeBooking, resp.Metadata.Code, resp.Metadata.Message))
+			continue
+		}
+
+		remoteTimes := make(map[int]*time.Time)
+		for _, t := range remote {
+			if t.TaskID < 1 || t.TaskID > 7 {
+				continue
+			}
+			tm := parseListTaskTime(t.WaktuRS)
+			if tm == nil {
+				tm = parseListTaskTime(t.Waktu)
+			}
+			remoteTimes[t.TaskID] = tm
+		}
+
+		local := make(map[int]models.TaskID)
+		existing, err := r.repo.TaskIDs(entry.NomorReferensi)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", entry.KodeBooking, err))
+			continue
+		}
+		for _, t := range existing {
+			local[t.TaskID] = t
+		}
+
+		rep.TotalChecked++
+
+		for taskID := 1; taskID <= 7; taskID++ {
+			lt, hasLocal := local[taskID]
+			rt, hasRemote := remoteTimes[taskID]
+			repStatus := reportStatus[entry.NomorReferensi][taskID]
+
+			diff := models.ReconcileDiff{
+				NomorReferensi: entry.NomorReferensi,
+				KodeBooking:    entry.KodeBooking,
+				NoRkmMedis:     entry.NoRkmMedis,
+				NamaPasien:     entry.NamaPasien,
+				TaskID:         taskID,
+				ReportStatus:   repStatus,
+			}
+			if hasLocal {
+				diff.LocalStatus = lt.Status
+				diff.LocalWaktu = FormatTime(MillisToTime(lt.Waktu))
+			}
+			if hasRemote {
+				diff.BPJSWaktu = FormatTime(rt)
+			}
+
+			localSudah := hasLocal && lt.Status == "Sudah"
+			switch {
+			case !hasRemote && (localSudah || repStatus == "success"):
+				rep.MissingOnBPJS = append(rep.MissingOnBPJS, diff)
+
+			case hasRemote && !localSudah:
+				if fix {
+					waktu := rt
+					if waktu == nil && hasLocal {
+						waktu = MillisToTime(lt.Waktu)
+					}
+					if err := r.markAccepted(entry, taskID, waktu); err != nil {
+						rep.Errors = append(rep.Errors, fmt.Sprintf("%s task %d: %v", entry.KodeBooking, taskID, err))
+					} else {
+						diff.Fixed = true
+					}
+				}
+				rep.BelumButOnBPJS = append(rep.BelumButOnBPJS, diff)
+
+			case hasRemote && localSudah && rt != nil:
+				delta := time.Duration(TimeToMillis(rt)-lt.Waktu) * time.Millisecond
+				if delta < -reconcileTolerance || delta > reconcileTolerance {
+					rep.TimeMismatch = append(rep.TimeMismatch, diff)
+				}
+			}
+		}
+	}
+
+	log.Printf("✅ Reconciliation complete: %d checked, %d missing on BPJS, %d Belum but on BPJS, %d time mismatch",
+		rep.TotalChecked, len(rep.MissingOnBPJS), len(rep.BelumButOnBPJS), len(rep.TimeMismatch))
+	return rep, nil
+}
+
+// markAccepted stores a task BPJS holds as Sudah with waktu, the time BPJS
+// recorded or, when it sent none readable, the local one.
+func (r *Reconciler) markAccepted(entry models.AntrianReferensi, taskID int, waktu *time.Time) error {
+	if waktu == nil {
+		return errors.New("BPJS sent no readable waktu and there is no local one")
+	}
+	tanggal := entry.TanggalPeriksa
+	if len(tanggal) >= 10 {
+		tanggal = tanggal[:10]
+	}
+	return r.repo.AcceptTask(tanggal, entry.NomorReferensi, taskID, TimeToMillis(waktu), "Rekonsiliasi dengan BPJS.")
+}
+
+// parseListTaskTime parses the "16-03-2021 11:32:49 WIB" format used by
+// antrean/getlisttask. The zone suffix is dropped and the local zone used.
+func parseListTaskTime(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, " "); i > 0 && len(s)-i <= 5 {
+		s = s[:i]
+	}
+	t, err := time.ParseInLocation("02-01-2006 15:04:05", s, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/bpjsmock"
+	"gotrol/internal/config"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+	"gotrol/internal/report"
+)
+
+type fakeReconcileRepo struct {
+	database.Repository
+	entry     models.AntrianReferensi
+	tasks     []models.TaskID
+	acceptErr error
+	accepted  map[int]int64
+}
+
+func (f *fakeReconcileRepo) BookedEntries(string) ([]models.AntrianReferensi, error) {
+	return []models.AntrianReferensi{f.entry}, nil
+}
+
+func (f *fakeReconcileRepo) TaskIDs(string) ([]models.TaskID, error) { return f.tasks, nil }
+
+func (f *fakeReconcileRepo) AcceptTask(tanggal, nomorReferensi string, taskID int, waktuMs int64, keterangan string) error {
+	if f.acceptErr != nil {
+		return f.acceptErr
+	}
+	f.accepted[taskID] = waktuMs
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	bpjsWaktu := time.Date(2025, 12, 28, 8, 20, 0, 0, time.Local).UnixMilli()
+	task := func(id int, status string, waktu int64) models.TaskID {
+		return models.TaskID{TanggalPeriksa: "2025-12-28", NomorReferensi: "REF1", TaskID: id, Status: status, Waktu: waktu}
+	}
+
+	tests := []struct {
+		name         string
+		local        []models.TaskID
+		remote       []int
+		reported     map[int]string
+		fix          bool
+		acceptErr    error
+		wantMissing  []int
+		wantBelum    []int
+		wantMismatch []int
+		wantFixed    bool
+		wantAccepted map[int]int64
+		wantErrors   int
+	}{
+		{
+			name:        "Sudah locally but missing on BPJS",
+			local:       []models.TaskID{task(3, "Sudah", bpjsWaktu)},
+			wantMissing: []int{3},
+		},
+		{
+			name:        "reported success but missing on BPJS",
+			reported:    map[int]string{3: "success"},
+			wantMissing: []int{3},
+		},
+		{
+			name:         "Belum but on BPJS without fix",
+			local:        []models.TaskID{task(3, "Belum", bpjsWaktu+60000)},
+			remote:       []int{3},
+			wantBelum:    []int{3},
+			wantAccepted: map[int]int64{},
+		},
+		{
+			name:         "Belum but on BPJS takes the BPJS time with fix",
+			local:        []models.TaskID{task(3, "Belum", bpjsWaktu+60000)},
+			remote:       []int{3},
+			fix:          true,
+			wantBelum:    []int{3},
+			wantFixed:    true,
+			wantAccepted: map[int]int64{3: bpjsWaktu},
+		},
+		{
+			name:         "no local row is added with fix",
+			remote:       []int{3},
+			fix:          true,
+			wantBelum:    []int{3},
+			wantFixed:    true,
+			wantAccepted: map[int]int64{3: bpjsWaktu},
+		},
+		{
+			name:         "failed fix is not reported fixed",
+			remote:       []int{3},
+			fix:          true,
+			acceptErr:    errors.New("connection reset"),
+			wantBelum:    []int{3},
+			wantAccepted: map[int]int64{},
+			wantErrors:   1,
+		},
+		{
+			name:   "difference within the tolerance",
+			local:  []models.TaskID{task(3, "Sudah", bpjsWaktu+400)},
+			remote: []int{3},
+		},
+		{
+			name:         "difference beyond the tolerance",
+			local:        []models.TaskID{task(3, "Sudah", bpjsWaktu+5000)},
+			remote:       []int{3},
+			wantMismatch: []int{3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, _ := bpjsmock.NewTestServer(bpjsmock.Options{ConsID: "1234", SecretKey: "secret", AutoRegister: true})
+			defer ts.Close()
+			client := bpjs.NewClient(&config.BPJSCredentials{ConsID: "1234", SecretKey: "secret", AntrianURL: ts.URL + "/"}, config.BPJSConfig{}, nil)
+			for _, id := range tt.remote {
+				if _, err := client.UpdateWaktu("KB1", id, bpjsWaktu); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			store, err := report.NewStore(filepath.Join(t.TempDir(), "reports", "gotrol.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.reported != nil {
+				result := models.ProcessResult{NomorReferensi: "REF1", KodeBooking: "KB1", ProcessedAt: time.UnixMilli(bpjsWaktu), Tasks: map[int]models.TaskResult{}}
+				for id, status := range tt.reported {
+					result.Tasks[id] = models.TaskResult{BPJSStatus: status}
+				}
+				if err := store.SaveResult(result); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			repo := &fakeReconcileRepo{
+				entry:     models.AntrianReferensi{TanggalPeriksa: "2025-12-28", NomorReferensi: "REF1", KodeBooking: "KB1"},
+				tasks:     tt.local,
+				acceptErr: tt.acceptErr,
+				accepted:  map[int]int64{},
+			}
+			rep, err := NewReconciler(repo, client, store).Reconcile("2025-12-28", tt.fix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			taskIDs := func(diffs []models.ReconcileDiff) []int {
+				var ids []int
+				for _, d := range diffs {
+					ids = append(ids, d.TaskID)
+				}
+				return ids
+			}
+			if got := taskIDs(rep.MissingOnBPJS); !equalInts(got, tt.wantMissing) {
+				t.Errorf("missing on BPJS = %v, want %v", got, tt.wantMissing)
+			}
+			if got := taskIDs(rep.BelumButOnBPJS); !equalInts(got, tt.wantBelum) {
+				t.Errorf("Belum but on BPJS = %v, want %v", got, tt.wantBelum)
+			}
+			if got := taskIDs(rep.TimeMismatch); !equalInts(got, tt.wantMismatch) {
+				t.Errorf("time mismatch = %v, want %v", got, tt.wantMismatch)
+			}
+			for _, d := range rep.BelumButOnBPJS {
+				if d.Fixed != tt.wantFixed {
+					t.Errorf("task %d fixed = %v, want %v", d.TaskID, d.Fixed, tt.wantFixed)
+				}
+			}
+			if len(rep.Errors) != tt.wantErrors {
+				t.Errorf("errors = %v, want %d", rep.Errors, tt.wantErrors)
+			}
+			if tt.wantAccepted != nil && !equalAccepted(repo.accepted, tt.wantAccepted) {
+				t.Errorf("accepted = %v, want %v", repo.accepted, tt.wantAccepted)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalAccepted(a, b map[int]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReconcileFailsOnUnreadableReport(t *testing.T) {
+	dir := t.TempDir()
+	store, err := report.NewStore(filepath.Join(dir, "gotrol.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A directory where the day's report file belongs cannot be read.
+	if err := os.Mkdir(filepath.Join(dir, "2025-12-28.json"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeReconcileRepo{entry: models.AntrianReferensi{NomorReferensi: "REF1", KodeBooking: "KB1"}}
+	if _, err := NewReconciler(repo, nil, store).Reconcile("2025-12-28", false); err == nil {
+		t.Error("want the report store error")
+	}
+}
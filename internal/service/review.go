@@ -0,0 +1,123 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/models"
+)
+
+// reviewQueue is where entries wait for a supervisor. *database.MySQL
+// implements it with the gotrol_review_queue table.
+type reviewQueue interface {
+	GetReview(nomorReferensi string) (*models.ReviewEntry, error)
+	ParkReview(review models.ReviewEntry) error
+	MarkReviewSent(id int64) error
+}
+
+// checkReview looks up the review of an entry. An approved review replaces
+// the computed times of the tasks it covers. It returns the reasons the
+// entry has to be parked, if any: for every wanted task without a review,
+// and for the wanted tasks an approved review does not cover, so a task that
+// appears after the approval is not sent unreviewed.
+func (p *Pipeline) checkReview(entry models.AntrianReferensi, ordered *[7]*time.Time, prov *[7]models.TaskProvenance, rules []models.AutoOrderRule, wanted func(taskNum int) bool) (*models.ReviewEntry, []string, error) {
+	review, err := p.reviews.GetReview(entry.NomorReferensi)
+	if err != nil {
+		return nil, nil, err
+	}
+	unreviewed := wanted
+	if review != nil {
+		if review.Status != models.ReviewApproved && review.Status != models.ReviewSent {
+			return review, nil, nil
+		}
+		if err := applyReview(review, ordered, prov); err != nil {
+			return nil, nil, err
+		}
+		covered := make(map[int]bool)
+		for _, rt := range review.Tasks {
+			covered[rt.TaskID] = true
+		}
+		unreviewed = func(taskNum int) bool {
+			return wanted(taskNum) && !covered[taskNum]
+		}
+	}
+
+	var reasons []string
+	for _, rule := range rules {
+		if unreviewed(rule.TaskID) {
+			reasons = append(reasons, models.ReviewReasonAutoOrder)
+			break
+		}
+	}
+	if len(missingSourceData(*ordered, *prov, rules, unreviewed)) > 0 {
+		reasons = append(reasons, models.ReviewReasonMissingData)
+	}
+	return review, reasons, nil
+}
+
+func applyReview(review *models.ReviewEntry, ordered *[7]*time.Time, prov *[7]models.TaskProvenance) error {
+	for _, rt := range review.Tasks {
+		if rt.TaskID < 1 || rt.TaskID > 7 {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", rt.Waktu, time.Local)
+		if err != nil {
+			return fmt.Errorf("review %d task %d: %w", review.ID, rt.TaskID, err)
+		}
+		ordered[rt.TaskID-1] = &t
+		prov[rt.TaskID-1] = rt.Provenance
+	}
+	return nil
+}
+
+// parkReview proposes the wanted tasks of an entry for review.
+func (p *Pipeline) parkReview(entry models.AntrianReferensi, ordered [7]*time.Time, prov [7]models.TaskProvenance, wanted func(taskNum int) bool, reasons []string, message string) error {
+	tanggal := entry.TanggalPeriksa
+	if len(tanggal) >= 10 {
+		tanggal = tanggal[:10]
+	}
+	review := models.ReviewEntry{
+		NomorReferensi: entry.NomorReferensi,
+		KodeBooking:    entry.KodeBooking,
+		NoRkmMedis:     entry.NoRkmMedis,
+		NamaPasien:     entry.NamaPasien,
+		NoRawat:        entry.NoRawat,
+		Tanggal:        tanggal,
+		Reasons:        reasons,
+		Message:        message,
+		Tasks:          []models.ReviewTask{},
+	}
+	for i := 0; i < 7; i++ {
+		if ordered[i] == nil || !wanted(i+1) {
+			continue
+		}
+		rt, err := newReviewTask(entry.KodeBooking, i+1, *ordered[i], prov[i])
+		if err != nil {
+			return err
+		}
+		review.Tasks = append(review.Tasks, rt)
+	}
+	return p.reviews.ParkReview(review)
+}
+
+// newReviewTask builds a proposed task with the payload that would be sent.
+func newReviewTask(kodeBooking string, taskID int, waktu time.Time, prov models.TaskProvenance) (models.ReviewTask, error) {
+	payload, err := json.Marshal(bpjs.UpdateWaktuRequest{
+		KodeBooking: kodeBooking,
+		TaskID:      taskID,
+		Waktu:       waktu.UnixMilli(),
+	})
+	if err != nil {
+		return models.ReviewTask{}, err
+	}
+	prov.TaskID = taskID
+	prov.Final = FormatTime(&waktu)
+	return models.ReviewTask{
+		TaskID:     taskID,
+		Waktu:      FormatTime(&waktu),
+		Payload:    payload,
+		Provenance: prov,
+	}, nil
+}
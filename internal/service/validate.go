@@ -0,0 +1,90 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"gotrol/internal/models"
+)
+
+// Violation rules reported by validatePlan.
+const (
+	ViolationNotAfterPrevious   = "not_after_previous"
+	ViolationConflictsAccepted  = "conflicts_accepted"
+	ViolationOtherDay           = "other_day"
+	ViolationPharmacyIncomplete = "pharmacy_incomplete"
+	ViolationPharmacyNoExam     = "pharmacy_without_exam"
+)
+
+// validatePlan checks the tasks an entry is about to send against the rules
+// BPJS enforces on antrean/updatewaktu, so an entry that would be rejected is
+// held instead of sent. accepted are the tasks BPJS already holds; they are
+// never resent, so the planned tasks have to fit around them. tanggal is the
+// visit date, and an empty one skips the same-day check.
+func validatePlan(tanggal string, planned [7]*time.Time, accepted map[int]time.Time, wanted func(taskNum int) bool) []models.TaskViolation {
+	var times [7]*time.Time
+	var isAccepted [7]bool
+	for i := 0; i < 7; i++ {
+		if t, ok := accepted[i+1]; ok {
+			t := t
+			times[i] = &t
+			isAccepted[i] = true
+		} else {
+			times[i] = planned[i]
+		}
+	}
+
+	var violations []models.TaskViolation
+	add := func(i int, rule string, against int, format string, args ...interface{}) {
+		violations = append(violations, models.TaskViolation{
+			TaskID:  i + 1,
+			Rule:    rule,
+			Waktu:   FormatTime(planned[i]),
+			Against: against,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	for i := 0; i < 7; i++ {
+		if isAccepted[i] || planned[i] == nil || !wanted(i+1) {
+			continue
+		}
+		t := *planned[i]
+
+		if tanggal != "" && t.Format("2006-01-02") != tanggal {
+			add(i, ViolationOtherDay, 0, "Task %d on %s is not on the visit date %s", i+1, t.Format("2006-01-02"), tanggal)
+		}
+
+		for k := i - 1; k >= 0; k-- {
+			if times[k] == nil {
+				continue
+			}
+			if !t.After(*times[k]) {
+				if isAccepted[k] {
+					add(i, ViolationConflictsAccepted, k+1, "Task %d at %s is not after Task %d accepted at %s", i+1, FormatTime(&t), k+1, FormatTime(times[k]))
+				} else {
+					add(i, ViolationNotAfterPrevious, k+1, "Task %d at %s is not after Task %d at %s", i+1, FormatTime(&t), k+1, FormatTime(times[k]))
+				}
+			}
+			break
+		}
+
+		for k := i + 1; k < 7; k++ {
+			if isAccepted[k] && !times[k].After(t) {
+				add(i, ViolationConflictsAccepted, k+1, "Task %d at %s is not before Task %d accepted at %s", i+1, FormatTime(&t), k+1, FormatTime(times[k]))
+				break
+			}
+		}
+
+		if i == 5 || i == 6 {
+			other := 11 - i
+			if times[other] == nil {
+				add(i, ViolationPharmacyIncomplete, other+1, "Task %d without Task %d", i+1, other+1)
+			}
+			if times[4] == nil {
+				add(i, ViolationPharmacyNoExam, 5, "Task %d without Task 5", i+1)
+			}
+		}
+	}
+	return violations
+}
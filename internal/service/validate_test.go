@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestValidatePlan(t *testing.T) {
+	all := func(int) bool { return true }
+	nextDay := at("08:30").AddDate(0, 0, 1)
+
+	tests := []struct {
+		name     string
+		planned  [7]*time.Time
+		accepted map[int]time.Time
+		wanted   func(int) bool
+		want     []string
+	}{
+		{
+			name:    "ordered plan",
+			planned: [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50"), at("09:00"), at("09:10")},
+		},
+		{
+			name:    "equal to the previous task",
+			planned: [7]*time.Time{at("08:10"), at("08:10")},
+			want:    []string{"2:" + ViolationNotAfterPrevious},
+		},
+		{
+			name:    "gap is compared with the nearest earlier task",
+			planned: [7]*time.Time{at("08:10"), nil, at("08:05")},
+			want:    []string{"3:" + ViolationNotAfterPrevious},
+		},
+		{
+			name:     "after an accepted later task",
+			planned:  [7]*time.Time{nil, nil, at("08:30")},
+			accepted: map[int]time.Time{2: *at("08:20"), 4: *at("08:25")},
+			want:     []string{"3:" + ViolationConflictsAccepted},
+		},
+		{
+			name:     "accepted time wins over the planned one",
+			planned:  [7]*time.Time{at("08:10"), at("08:20")},
+			accepted: map[int]time.Time{1: *at("08:30")},
+			want:     []string{"2:" + ViolationConflictsAccepted},
+		},
+		{
+			name:    "other day",
+			planned: [7]*time.Time{at("08:10"), &nextDay},
+			want:    []string{"2:" + ViolationOtherDay},
+		},
+		{
+			name:    "lone pharmacy task",
+			planned: [7]*time.Time{at("08:10"), at("08:20"), at("08:30"), at("08:40"), at("08:50"), at("09:00")},
+			want:    []string{"6:" + ViolationPharmacyIncomplete},
+		},
+		{
+			name:     "pharmacy without an exam",
+			planned:  [7]*time.Time{nil, nil, nil, nil, nil, nil, at("09:10")},
+			accepted: map[int]time.Time{6: *at("09:00")},
+			want:     []string{"7:" + ViolationPharmacyNoExam},
+		},
+		{
+			name:    "tasks that are not sent are not checked",
+			planned: [7]*time.Time{at("08:10"), at("08:10")},
+			wanted:  func(taskNum int) bool { return taskNum == 1 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wanted := tt.wanted
+			if wanted == nil {
+				wanted = all
+			}
+			var got []string
+			for _, v := range validatePlan("2025-12-28", tt.planned, tt.accepted, wanted) {
+				got = append(got, fmt.Sprintf("%d:%s", v.TaskID, v.Rule))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("violations %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
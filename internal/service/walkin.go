@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+var hariKerja = [...]string{"AKHAD", "SENIN", "SELASA", "RABU", "KAMIS", "JUMAT", "SABTU"}
+
+type antreanAdder interface {
+	TambahAntreanContext(ctx context.Context, req bpjs.AddAntreanRequest) (*bpjs.BPJSResponse, error)
+}
+
+// WalkInRegistrar gives JKN visits registered at the counter the antrean a
+// Mobile JKN booking gets. Once BPJS accepts antrean/add the visit is stored
+// as a booking and the task pipeline picks it up like any other.
+type WalkInRegistrar struct {
+	repo              database.Repository
+	adder             antreanAdder
+	minutesPerPatient int
+
+	mu sync.Mutex
+	// held remembers why a visit was not registered, so each reason is
+	// logged once.
+	held map[string]string
+}
+
+func NewWalkInRegistrar(repo database.Repository, bpjsClient *bpjs.Client, minutesPerPatient int) *WalkInRegistrar {
+	return &WalkInRegistrar{
+		repo:              repo,
+		adder:             bpjsClient,
+		minutesPerPatient: minutesPerPatient,
+		held:              make(map[string]string),
+	}
+}
+
+// Register sends antrean/add for every walk-in visit of date and returns how
+// many BPJS accepted.
+func (r *WalkInRegistrar) Register(ctx context.Context, date string) (int, error) {
+	visits, err := r.repo.WalkIns(date)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, v := range visits {
+		req, reason, err := r.buildRequest(v)
+		if err != nil {
+			r.hold(v.NoRawat, err.Error())
+			continue
+		}
+		if reason != "" {
+			r.hold(v.NoRawat, reason)
+			continue
+		}
+
+		log.Printf("🚶 Walk-in: %s (No. Rawat %s) → antrean/add %s", v.NoRkmMedis, v.NoRawat, req.NomorAntrean)
+		resp, err := r.adder.TambahAntreanContext(ctx, *req)
+		category := bpjs.ClassifyError(err)
+		message := ""
+		if err == nil {
+			category = resp.Category()
+			message = resp.Metadata.Message
+		} else {
+			message = err.Error()
+		}
+		switch {
+		case category.IsAccepted():
+		case transient(category):
+			log.Printf("   └──  Error: %s, retrying next poll", message)
+			continue
+		default:
+			log.Printf("   └── BPJS: %s [%s]", message, category)
+			if err := r.repo.RejectWalkIn(v.NoRawat, v.Tanggal, string(category), message); err != nil {
+				log.Printf("   └──  Error saving rejection: %v", err)
+			}
+			continue
+		}
+
+		if err := r.saveReferensi(req); err != nil {
+			log.Printf("   └──  Error saving referensi: %v", err)
+			continue
+		}
+		log.Printf("   └── Registered as %s", req.KodeBooking)
+		added++
+	}
+	return added, nil
+}
+
+// DryRun lists the antrean/add requests Register would send for date, and
+// why the other walk-in visits would wait, without sending or storing
+// anything.
+func (r *WalkInRegistrar) DryRun(date string) (*models.DryRunReport, error) {
+	visits, err := r.repo.WalkIns(date)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &models.DryRunReport{
+		Mode:    "walkin",
+		Date:    date,
+		Entries: []models.DryRunEntry{},
+		Errors:  []string{},
+	}
+	for _, v := range visits {
+		planned := models.DryRunEntry{
+			KodeBooking: strings.ReplaceAll(v.NoRawat, "/", ""),
+			NoRkmMedis:  v.NoRkmMedis,
+			NamaPasien:  v.NmPasien,
+			Tasks:       []models.DryRunTask{},
+		}
+		req, reason, err := r.buildRequest(v)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", v.NoRawat, err))
+			continue
+		}
+		if reason != "" {
+			planned.Skipped = reason
+		} else {
+			planned.NomorReferensi = req.NomorReferensi
+			if planned.Payload, err = json.Marshal(req); err != nil {
+				return nil, err
+			}
+		}
+		rep.Entries = append(rep.Entries, planned)
+	}
+	return rep, nil
+}
+
+func (r *WalkInRegistrar) hold(noRawat, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.held[noRawat] == reason {
+		return
+	}
+	r.held[noRawat] = reason
+	log.Printf("⚠️ Walk-in %s not registered: %s", noRawat, reason)
+}
+
+// buildRequest fills antrean/add from the registration, the doctor's
+// session in jadwal and the SEP. A non-empty reason means the SIMRS data is
+// not complete enough yet.
+func (r *WalkInRegistrar) buildRequest(v models.WalkIn) (*bpjs.AddAntreanRequest, string, error) {
+	if v.KdPoliBPJS == "" {
+		return nil, "poli " + v.KdPoli + " has no maping_poli_bpjs", nil
+	}
+	kodeDokter, err := strconv.Atoi(v.KdDokterBPJS)
+	if err != nil {
+		return nil, "dokter " + v.KdDokter + " has no maping_dokter_dpjpvclaim", nil
+	}
+	if v.NoPeserta == "" {
+		return nil, "patient has no no_peserta", nil
+	}
+
+	tanggal, err := time.ParseInLocation("2006-01-02", v.Tanggal, time.Local)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hari := hariKerja[tanggal.Weekday()]
+	session, err := r.repo.NearestSession(v.KdPoli, v.KdDokter, hari, v.JamReg)
+	if err != nil {
+		return nil, "", err
+	}
+	if session == nil {
+		return nil, "no jadwal for dokter " + v.KdDokter + " on " + hari, nil
+	}
+
+	nomorReferensi, jenisKunjungan, err := r.findRujukan(v.NoRawat)
+	if err != nil {
+		return nil, "", err
+	}
+	if nomorReferensi == "" {
+		return nil, "no SEP with a rujukan yet", nil
+	}
+
+	count, err := r.repo.QueueCount(v.KdPoli, v.KdDokter, v.Tanggal)
+	if err != nil {
+		return nil, "", err
+	}
+
+	angka, _ := strconv.Atoi(v.NoReg)
+	mulai, err := time.ParseInLocation("2006-01-02 15:04", v.Tanggal+" "+session.JamMulai, time.Local)
+	if err != nil {
+		return nil, "", err
+	}
+	estimasi := mulai.Add(time.Duration((angka-1)*r.minutesPerPatient) * time.Minute)
+
+	pasienBaru := 0
+	if v.SttsDaftar == "Baru" {
+		pasienBaru = 1
+	}
+
+	return &bpjs.AddAntreanRequest{
+		KodeBooking:      strings.ReplaceAll(v.NoRawat, "/", ""),
+		JenisPasien:      "JKN",
+		NomorKartu:       v.NoPeserta,
+		NIK:              v.NIK,
+		NoHP:             v.NoTelp,
+		KodePoli:         v.KdPoliBPJS,
+		NamaPoli:         v.NmPoliBPJS,
+		PasienBaru:       pasienBaru,
+		NoRM:             v.NoRkmMedis,
+		TanggalPeriksa:   v.Tanggal,
+		KodeDokter:       kodeDokter,
+		NamaDokter:       v.NmDokterBPJS,
+		JamPraktek:       session.JamMulai + "-" + session.JamSelesai,
+		JenisKunjungan:   jenisKunjungan,
+		NomorReferensi:   nomorReferensi,
+		NomorAntrean:     fmt.Sprintf("%s-%03d", v.KdPoliBPJS, angka),
+		AngkaAntrean:     angka,
+		EstimasiDilayani: estimasi.UnixMilli(),
+		SisaKuotaJKN:     max(session.Kuota-count.JKN, 0),
+		KuotaJKN:         session.Kuota,
+		SisaKuotaNonJKN:  max(session.Kuota-(count.Total-count.JKN), 0),
+		KuotaNonJKN:      session.Kuota,
+		Keterangan:       "Peserta harap 30 menit lebih awal guna pencatatan administrasi.",
+	}, "", nil
+}
+
+// findRujukan reads the referral of the visit's SEP: a surat kontrol makes
+// it a kontrol visit, a referral from another hospital jenis kunjungan 4.
+func (r *WalkInRegistrar) findRujukan(noRawat string) (string, int, error) {
+	sep, err := r.repo.SEPReferral(noRawat)
+	if err != nil || sep == nil {
+		return "", 0, err
+	}
+	switch {
+	case sep.NoSKDP != "":
+		return sep.NoSKDP, 3, nil
+	case strings.HasPrefix(sep.AsalRujukan, "2"):
+		return sep.NoRujukan, 4, nil
+	default:
+		return sep.NoRujukan, 1, nil
+	}
+}
+
+func (r *WalkInRegistrar) saveReferensi(req *bpjs.AddAntreanRequest) error {
+	return r.repo.AddBooking(models.AntrianReferensi{
+		TanggalPeriksa: req.TanggalPeriksa,
+		NoRkmMedis:     req.NoRM,
+		NomorKartu:     req.NomorKartu,
+		NomorReferensi: req.NomorReferensi,
+		KodeBooking:    req.KodeBooking,
+		JenisKunjungan: strconv.Itoa(req.JenisKunjungan),
+		Keterangan:     "Walk-in",
+	})
+}
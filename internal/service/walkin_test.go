@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gotrol/internal/bpjs"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+// fakeWalkInRepo answers the walk-in reads; any other Repository method
+// panics on the nil embedded interface.
+type fakeWalkInRepo struct {
+	database.Repository
+	visits   []models.WalkIn
+	sessions map[string]*models.DoctorSession
+	seps     map[string]*models.SEPReferral
+	bookings []models.AntrianReferensi
+	rejected map[string]string
+}
+
+func (f *fakeWalkInRepo) WalkIns(string) ([]models.WalkIn, error) {
+	var visits []models.WalkIn
+	for _, v := range f.visits {
+		if _, ok := f.rejected[v.NoRawat]; !ok {
+			visits = append(visits, v)
+		}
+	}
+	return visits, nil
+}
+
+func (f *fakeWalkInRepo) RejectWalkIn(noRawat, _, category, _ string) error {
+	if f.rejected == nil {
+		f.rejected = make(map[string]string)
+	}
+	f.rejected[noRawat] = category
+	return nil
+}
+
+func (f *fakeWalkInRepo) NearestSession(_, kdDokter, _, _ string) (*models.DoctorSession, error) {
+	return f.sessions[kdDokter], nil
+}
+
+func (f *fakeWalkInRepo) SEPReferral(noRawat string) (*models.SEPReferral, error) {
+	return f.seps[noRawat], nil
+}
+
+func (f *fakeWalkInRepo) QueueCount(string, string, string) (models.QueueCount, error) {
+	return models.QueueCount{Total: 12, JKN: 8}, nil
+}
+
+func (f *fakeWalkInRepo) AddBooking(e models.AntrianReferensi) error {
+	f.bookings = append(f.bookings, e)
+	return nil
+}
+
+func TestWalkInDryRun(t *testing.T) {
+	visit := func(noRawat, kdDokter, kdPoliBPJS string) models.WalkIn {
+		return models.WalkIn{
+			NoRawat: noRawat, NoReg: "003", NoRkmMedis: "000123", NmPasien: "BUDI", Tanggal: "2025-12-29",
+			JamReg: "08:05:00", SttsDaftar: "Lama", KdPoli: "INT", KdDokter: kdDokter, NoPeserta: "0001234567890",
+			KdPoliBPJS: kdPoliBPJS, NmPoliBPJS: "PENYAKIT DALAM", KdDokterBPJS: "12345", NmDokterBPJS: "dr. A",
+		}
+	}
+	repo := &fakeWalkInRepo{
+		visits: []models.WalkIn{
+			visit("2025/12/29/000001", "D1", "INT"),
+			visit("2025/12/29/000002", "D1", ""),
+			visit("2025/12/29/000003", "D2", "INT"),
+			visit("2025/12/29/000004", "D1", "INT"),
+		},
+		sessions: map[string]*models.DoctorSession{"D1": {JamMulai: "08:00", JamSelesai: "12:00", Kuota: 30}},
+		seps: map[string]*models.SEPReferral{
+			"2025/12/29/000001": {NoRujukan: "R1", AsalRujukan: "2. Faskes 2", NoSKDP: ""},
+		},
+	}
+	r := NewWalkInRegistrar(repo, nil, 10)
+
+	rep, err := r.DryRun("2025-12-29")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"", "poli INT has no maping_poli_bpjs", "no jadwal for dokter D2 on SENIN", "no SEP with a rujukan yet"}
+	if len(rep.Entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(rep.Entries), len(want))
+	}
+	for i, e := range rep.Entries {
+		if e.Skipped != want[i] {
+			t.Errorf("entry %d skipped = %q, want %q", i, e.Skipped, want[i])
+		}
+	}
+
+	var req bpjs.AddAntreanRequest
+	if err := json.Unmarshal(rep.Entries[0].Payload, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.KodeBooking != "20251229000001" || req.NomorAntrean != "INT-003" || req.JenisKunjungan != 4 || req.NomorReferensi != "R1" {
+		t.Errorf("payload %+v", req)
+	}
+	if req.JamPraktek != "08:00-12:00" || req.SisaKuotaJKN != 22 || req.SisaKuotaNonJKN != 26 {
+		t.Errorf("session in payload %+v", req)
+	}
+	estimasi, _ := time.ParseInLocation("2006-01-02 15:04", "2025-12-29 08:20", time.Local)
+	if req.EstimasiDilayani != estimasi.UnixMilli() {
+		t.Errorf("estimasi %d, want %d", req.EstimasiDilayani, estimasi.UnixMilli())
+	}
+	if len(repo.bookings) > 0 {
+		t.Errorf("dry run added bookings %v", repo.bookings)
+	}
+}
+
+type fakeAdder struct {
+	answers map[string]fakeAnswer
+	sent    []string
+}
+
+func (f *fakeAdder) TambahAntreanContext(_ context.Context, req bpjs.AddAntreanRequest) (*bpjs.BPJSResponse, error) {
+	f.sent = append(f.sent, req.KodeBooking)
+	a := f.answers[req.KodeBooking]
+	if a.err != nil {
+		return nil, a.err
+	}
+	resp := &bpjs.BPJSResponse{}
+	resp.Metadata.Code, resp.Metadata.Message = a.code, a.message
+	return resp, nil
+}
+
+func TestWalkInRegisterRemembersRejections(t *testing.T) {
+	visit := func(noRawat string) models.WalkIn {
+		return models.WalkIn{
+			NoRawat: noRawat, NoReg: "001", NoRkmMedis: "000123", Tanggal: "2025-12-29", JamReg: "08:05:00",
+			KdPoli: "INT", KdDokter: "D1", NoPeserta: "0001234567890", KdPoliBPJS: "INT", KdDokterBPJS: "12345",
+		}
+	}
+	repo := &fakeWalkInRepo{
+		visits:   []models.WalkIn{visit("2025/12/29/000001"), visit("2025/12/29/000002"), visit("2025/12/29/000003")},
+		sessions: map[string]*models.DoctorSession{"D1": {JamMulai: "08:00", JamSelesai: "12:00", Kuota: 30}},
+		seps: map[string]*models.SEPReferral{
+			"2025/12/29/000001": {NoRujukan: "R1"},
+			"2025/12/29/000002": {NoRujukan: "R2"},
+			"2025/12/29/000003": {NoRujukan: "R3"},
+		},
+	}
+	adder := &fakeAdder{answers: map[string]fakeAnswer{
+		"20251229000001": {code: 200, message: "Ok."},
+		"20251229000002": {code: 201, message: "Rujukan tidak valid"},
+		"20251229000003": {err: errors.New("connection reset")},
+	}}
+
+	r := &WalkInRegistrar{repo: repo, adder: adder, minutesPerPatient: 10, held: make(map[string]string)}
+	added, err := r.Register(context.Background(), "2025-12-29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 || len(repo.bookings) != 1 || repo.bookings[0].KodeBooking != "20251229000001" {
+		t.Errorf("added %d, bookings %+v", added, repo.bookings)
+	}
+	if len(repo.rejected) != 1 || repo.rejected["2025/12/29/000002"] != string(bpjs.CategoryRejected) {
+		t.Errorf("rejected %v, want only visit 2", repo.rejected)
+	}
+
+	// A new registrar, as after a restart, still skips the rejected visit
+	// and retries the one that failed in transit.
+	repo.visits = repo.visits[1:]
+	adder.sent = nil
+	r = &WalkInRegistrar{repo: repo, adder: adder, minutesPerPatient: 10, held: make(map[string]string)}
+	if _, err := r.Register(context.Background(), "2025-12-29"); err != nil {
+		t.Fatal(err)
+	}
+	if len(adder.sent) != 1 || adder.sent[0] != "20251229000003" {
+		t.Errorf("sent %v after restart, want only visit 3", adder.sent)
+	}
+}
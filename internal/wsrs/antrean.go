@@ -0,0 +1,366 @@
+package wsrs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+var hariKerja = [...]string{"AKHAD", "SENIN", "SELASA", "RABU", "KAMIS", "JUMAT", "SABTU"}
+
+// findJadwal resolves the BPJS poli and doctor codes to the SIMRS session
+// starting at the beginning of jamPraktek ("08:00-12:00").
+func (s *Server) findJadwal(kodePoli string, kodeDokter int, tanggal time.Time, jamPraktek string) (*models.Praktek, error) {
+	jamMulai, _, _ := strings.Cut(jamPraktek, "-")
+	return s.repo.FindPraktek(kodePoli, kodeDokter, hariKerja[tanggal.Weekday()], strings.TrimSpace(jamMulai))
+}
+
+func nomorAntrean(kodePoli string, noReg int) string {
+	return fmt.Sprintf("%s-%03d", kodePoli, noReg)
+}
+
+// parseTanggal accepts today or later.
+func (s *Server) parseTanggal(tanggal string) (time.Time, bool) {
+	t, err := time.ParseInLocation("2006-01-02", tanggal, time.Local)
+	if err != nil {
+		return t, false
+	}
+	today := s.now().Format("2006-01-02")
+	return t, tanggal >= today
+}
+
+type statusAntreanRequest struct {
+	KodePoli       string `json:"kodepoli"`
+	KodeDokter     int    `json:"kodedokter"`
+	TanggalPeriksa string `json:"tanggalperiksa"`
+	JamPraktek     string `json:"jampraktek"`
+}
+
+func (s *Server) handleStatusAntrean(w http.ResponseWriter, r *http.Request) {
+	var req statusAntreanRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	tanggal, ok := s.parseTanggal(req.TanggalPeriksa)
+	if !ok {
+		writeMeta(w, 201, "Tanggal Periksa Tidak Berlaku")
+		return
+	}
+	jadwal, err := s.findJadwal(req.KodePoli, req.KodeDokter, tanggal, req.JamPraktek)
+	if err != nil {
+		log.Printf("   └──  Error reading jadwal: %v", err)
+		writeMeta(w, 201, "Gagal membaca jadwal")
+		return
+	}
+	if jadwal == nil {
+		writeMeta(w, 201, "Jadwal Dokter Tidak Ditemukan")
+		return
+	}
+	count, err := s.repo.QueueCount(jadwal.KdPoli, jadwal.KdDokter, req.TanggalPeriksa)
+	if err != nil {
+		log.Printf("   └──  Error counting antrean: %v", err)
+		writeMeta(w, 201, "Gagal membaca antrean")
+		return
+	}
+
+	antreanPanggil := "-"
+	if count.Dipanggil > 0 {
+		antreanPanggil = nomorAntrean(req.KodePoli, count.Dipanggil)
+	}
+	writeResponse(w, map[string]interface{}{
+		"namapoli":        jadwal.NmPoli,
+		"namadokter":      jadwal.NmDokter,
+		"totalantrean":    count.Total,
+		"sisaantrean":     count.Sisa,
+		"antreanpanggil":  antreanPanggil,
+		"sisakuotajkn":    jadwal.Kuota - count.JKN,
+		"kuotajkn":        jadwal.Kuota,
+		"sisakuotanonjkn": jadwal.Kuota - (count.Total - count.JKN),
+		"kuotanonjkn":     jadwal.Kuota,
+		"keterangan":      "",
+	})
+}
+
+type ambilAntreanRequest struct {
+	NomorKartu     string `json:"nomorkartu"`
+	NIK            string `json:"nik"`
+	NoHP           string `json:"nohp"`
+	KodePoli       string `json:"kodepoli"`
+	NoRM           string `json:"norm"`
+	TanggalPeriksa string `json:"tanggalperiksa"`
+	KodeDokter     int    `json:"kodedokter"`
+	JamPraktek     string `json:"jampraktek"`
+	JenisKunjungan int    `json:"jeniskunjungan"`
+	NomorReferensi string `json:"nomorreferensi"`
+}
+
+func (s *Server) handleAmbilAntrean(w http.ResponseWriter, r *http.Request) {
+	var req ambilAntreanRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	switch {
+	case len(req.NomorKartu) != 13 || !isDigits(req.NomorKartu):
+		writeMeta(w, 201, "Format Nomor Kartu Tidak Sesuai")
+		return
+	case len(req.NIK) != 16 || !isDigits(req.NIK):
+		writeMeta(w, 201, "Format NIK Tidak Sesuai")
+		return
+	case req.JenisKunjungan < 1 || req.JenisKunjungan > 4:
+		writeMeta(w, 201, "Jenis Kunjungan Tidak Valid")
+		return
+	}
+	tanggal, ok := s.parseTanggal(req.TanggalPeriksa)
+	if !ok {
+		writeMeta(w, 201, "Tanggal Periksa Tidak Berlaku")
+		return
+	}
+
+	jadwal, err := s.findJadwal(req.KodePoli, req.KodeDokter, tanggal, req.JamPraktek)
+	if err != nil {
+		log.Printf("   └──  Error reading jadwal: %v", err)
+		writeMeta(w, 201, "Gagal membaca jadwal")
+		return
+	}
+	if jadwal == nil {
+		writeMeta(w, 201, "Jadwal Dokter Tidak Ditemukan")
+		return
+	}
+
+	p, err := s.repo.FindPasien(req.NoRM, req.NomorKartu)
+	if err != nil {
+		log.Printf("   └──  Error reading pasien: %v", err)
+		writeMeta(w, 201, "Gagal membaca data pasien")
+		return
+	}
+	if p == nil {
+		writeMeta(w, 202, "Data pasien ini tidak ditemukan, silahkan Melakukan Registrasi Pasien Baru")
+		return
+	}
+
+	b, msg, err := s.registerBooking(req, jadwal, p, tanggal)
+	if err != nil {
+		log.Printf("   └──  Error registering booking: %v", err)
+		writeMeta(w, 201, "Gagal menyimpan antrean")
+		return
+	}
+	if msg != "" {
+		writeMeta(w, 201, msg)
+		return
+	}
+
+	log.Printf("   └── Booking %s for %s (%s)", b.KodeBooking, p.NoRkmMedis, jadwal.KdPoli)
+	writeResponse(w, map[string]interface{}{
+		"nomorantrean":     nomorAntrean(req.KodePoli, b.NoReg),
+		"angkaantrean":     b.NoReg,
+		"kodebooking":      b.KodeBooking,
+		"norm":             p.NoRkmMedis,
+		"namapoli":         jadwal.NmPoli,
+		"namadokter":       jadwal.NmDokter,
+		"estimasidilayani": b.Estimasi,
+		"sisakuotajkn":     jadwal.Kuota - b.Count.JKN - 1,
+		"kuotajkn":         jadwal.Kuota,
+		"sisakuotanonjkn":  jadwal.Kuota - (b.Count.Total - b.Count.JKN),
+		"kuotanonjkn":      jadwal.Kuota,
+		"keterangan":       "Peserta harap 60 menit lebih awal guna pencatatan administrasi.",
+	})
+}
+
+// registerBooking stores the visit and its booking row. A non-empty message
+// is a refusal to pass on to Mobile JKN.
+func (s *Server) registerBooking(req ambilAntreanRequest, jadwal *models.Praktek, p *models.Pasien, tanggal time.Time) (*models.BookedVisit, string, error) {
+	mulai, err := time.ParseInLocation("2006-01-02 15:04", req.TanggalPeriksa+" "+jadwal.JamMulai, time.Local)
+	if err != nil {
+		return nil, "", err
+	}
+	jamReg := mulai
+	if now := s.now(); now.Format("2006-01-02") == req.TanggalPeriksa {
+		jamReg = now
+	}
+	umur, sttsUmur := umurDaftar(p.TglLahir, tanggal)
+
+	visit, err := s.repo.RegisterBooking(models.NewBooking{
+		TanggalPeriksa:    req.TanggalPeriksa,
+		JamReg:            jamReg.Format("15:04:05"),
+		JamMulai:          jadwal.JamMulai,
+		Pasien:            *p,
+		KdPoli:            jadwal.KdPoli,
+		KdDokter:          jadwal.KdDokter,
+		Kuota:             jadwal.Kuota,
+		KdPj:              s.kdPjBPJS,
+		Umur:              umur,
+		SttsUmur:          sttsUmur,
+		NomorKartu:        req.NomorKartu,
+		NIK:               req.NIK,
+		NoHP:              req.NoHP,
+		KodePoli:          req.KodePoli,
+		KodeDokter:        req.KodeDokter,
+		JamPraktek:        req.JamPraktek,
+		NomorReferensi:    req.NomorReferensi,
+		JenisKunjungan:    req.JenisKunjungan,
+		MinutesPerPatient: s.minutesPerPatient,
+		Keterangan:        "Mobile JKN",
+	})
+	switch {
+	case errors.Is(err, database.ErrAlreadyBooked):
+		return nil, "Nomor Antrean Hanya Dapat Diambil 1 Kali Pada Tanggal Dan Poli Yang Sama", nil
+	case errors.Is(err, database.ErrQuotaFull):
+		return nil, "Kuota Habis", nil
+	case err != nil:
+		return nil, "", err
+	}
+	return visit, "", nil
+}
+
+// umurDaftar is the age at registration the way SIMRS stores it: years,
+// or months or days for infants.
+func umurDaftar(lahir, tanggal time.Time) (int, string) {
+	years := tanggal.Year() - lahir.Year()
+	months := int(tanggal.Month()) - int(lahir.Month())
+	if tanggal.Day() < lahir.Day() {
+		months--
+	}
+	months += years * 12
+	switch {
+	case months >= 12:
+		return months / 12, "Th"
+	case months > 0:
+		return months, "Bl"
+	default:
+		return int(tanggal.Sub(lahir).Hours() / 24), "Hr"
+	}
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+type kodeBookingRequest struct {
+	KodeBooking string `json:"kodebooking"`
+	Keterangan  string `json:"keterangan"`
+	Waktu       int64  `json:"waktu"`
+}
+
+func (s *Server) lookupBooking(w http.ResponseWriter, kodeBooking string) *models.Booking {
+	b, err := s.repo.FindBooking(kodeBooking)
+	if err != nil {
+		log.Printf("   └──  Error reading booking: %v", err)
+		writeMeta(w, 201, "Gagal membaca antrean")
+		return nil
+	}
+	if b == nil || b.Stts == "Batal" {
+		writeMeta(w, 201, "Antrean Tidak Ditemukan atau Sudah Dibatalkan")
+		return nil
+	}
+	return b
+}
+
+func (s *Server) handleSisaAntrean(w http.ResponseWriter, r *http.Request) {
+	var req kodeBookingRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	b := s.lookupBooking(w, req.KodeBooking)
+	if b == nil {
+		return
+	}
+
+	sisa, err := s.repo.QueueAhead(b.KdPoli, b.KdDokter, b.Tanggal, b.NoReg)
+	if err != nil {
+		log.Printf("   └──  Error counting antrean: %v", err)
+		writeMeta(w, 201, "Gagal membaca antrean")
+		return
+	}
+	count, err := s.repo.QueueCount(b.KdPoli, b.KdDokter, b.Tanggal)
+	if err != nil {
+		log.Printf("   └──  Error counting antrean: %v", err)
+		writeMeta(w, 201, "Gagal membaca antrean")
+		return
+	}
+
+	antreanPanggil := "-"
+	if count.Dipanggil > 0 {
+		antreanPanggil = nomorAntrean(b.KodePoli, count.Dipanggil)
+	}
+	writeResponse(w, map[string]interface{}{
+		"nomorantrean":   nomorAntrean(b.KodePoli, b.NoReg),
+		"namapoli":       b.NmPoli,
+		"namadokter":     b.NmDokter,
+		"sisaantrean":    sisa,
+		"antreanpanggil": antreanPanggil,
+		"waktutunggu":    sisa * s.minutesPerPatient * 60,
+		"keterangan":     "",
+	})
+}
+
+func (s *Server) handleBatalAntrean(w http.ResponseWriter, r *http.Request) {
+	var req kodeBookingRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	b := s.lookupBooking(w, req.KodeBooking)
+	if b == nil {
+		return
+	}
+	if b.Stts != "Belum" {
+		writeMeta(w, 201, "Pasien Sudah Dilayani, Antrean Tidak Dapat Dibatalkan")
+		return
+	}
+	checkin, err := s.db.CheckinTime(req.KodeBooking)
+	if err != nil {
+		log.Printf("   └──  Error reading checkin: %v", err)
+		writeMeta(w, 201, "Gagal membaca antrean")
+		return
+	}
+	if checkin > 0 {
+		writeMeta(w, 201, "Pasien Sudah Checkin, Antrean Tidak Dapat Dibatalkan")
+		return
+	}
+
+	err = s.repo.CancelBooking(*b, req.KodeBooking, "Batal Mobile JKN: "+req.Keterangan)
+	if errors.Is(err, database.ErrAlreadyServed) {
+		writeMeta(w, 201, "Pasien Sudah Dilayani, Antrean Tidak Dapat Dibatalkan")
+		return
+	}
+	if err != nil {
+		log.Printf("   └──  Error cancelling booking: %v", err)
+		writeMeta(w, 201, "Gagal membatalkan antrean")
+		return
+	}
+	writeMeta(w, 200, "Ok")
+}
+
+// handleCheckin keeps the first checkin time per booking. The watcher
+// prefers it over every other Task 3 source.
+func (s *Server) handleCheckin(w http.ResponseWriter, r *http.Request) {
+	var req kodeBookingRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	b := s.lookupBooking(w, req.KodeBooking)
+	if b == nil {
+		return
+	}
+	if req.Waktu <= 0 || time.UnixMilli(req.Waktu).Format("2006-01-02") != b.Tanggal {
+		writeMeta(w, 201, "Waktu Checkin Tidak Sesuai Tanggal Periksa")
+		return
+	}
+
+	if err := s.db.SaveCheckin(req.KodeBooking, b.NomorReferensi, req.Waktu); err != nil {
+		log.Printf("   └──  Error saving checkin: %v", err)
+		writeMeta(w, 201, "Gagal menyimpan checkin")
+		return
+	}
+	writeMeta(w, 200, "Ok")
+}
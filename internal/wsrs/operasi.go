@@ -0,0 +1,103 @@
+package wsrs
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"gotrol/internal/models"
+)
+
+type jadwalOperasi struct {
+	KodeBooking    string `json:"kodebooking"`
+	TanggalOperasi string `json:"tanggaloperasi"`
+	JenisTindakan  string `json:"jenistindakan"`
+	KodePoli       string `json:"kodepoli"`
+	NamaPoli       string `json:"namapoli"`
+	Terlaksana     int    `json:"terlaksana"`
+	NoPeserta      string `json:"nopeserta,omitempty"`
+	LastUpdate     int64  `json:"lastupdate,omitempty"`
+}
+
+// toJadwalOperasi converts the schedule to the answer format; a done
+// surgery is terlaksana 1.
+func toJadwalOperasi(list []models.JadwalOperasi) []jadwalOperasi {
+	out := []jadwalOperasi{}
+	for _, o := range list {
+		j := jadwalOperasi{
+			KodeBooking:    o.KodeBooking,
+			TanggalOperasi: o.TanggalOperasi,
+			JenisTindakan:  o.JenisTindakan,
+			KodePoli:       o.KodePoli,
+			NamaPoli:       o.NamaPoli,
+			NoPeserta:      o.NoPeserta,
+		}
+		if o.Terlaksana {
+			j.Terlaksana = 1
+		}
+		out = append(out, j)
+	}
+	return out
+}
+
+type jadwalOperasiRSRequest struct {
+	TanggalAwal  string `json:"tanggalawal"`
+	TanggalAkhir string `json:"tanggalakhir"`
+}
+
+func (s *Server) handleJadwalOperasiRS(w http.ResponseWriter, r *http.Request) {
+	var req jadwalOperasiRSRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	awal, err1 := time.Parse("2006-01-02", req.TanggalAwal)
+	akhir, err2 := time.Parse("2006-01-02", req.TanggalAkhir)
+	if err1 != nil || err2 != nil {
+		writeMeta(w, 201, "Format Tanggal Tidak Sesuai")
+		return
+	}
+	if akhir.Before(awal) {
+		writeMeta(w, 201, "Tanggal Akhir Tidak Boleh Lebih Kecil dari Tanggal Awal")
+		return
+	}
+
+	schedule, err := s.repo.JadwalOperasi(req.TanggalAwal, req.TanggalAkhir)
+	if err != nil {
+		log.Printf("   └──  Error reading jadwal operasi: %v", err)
+		writeMeta(w, 201, "Gagal membaca jadwal operasi")
+		return
+	}
+	list := toJadwalOperasi(schedule)
+	lastUpdate := s.now().UnixMilli()
+	for i := range list {
+		list[i].LastUpdate = lastUpdate
+	}
+	writeResponse(w, map[string]interface{}{"list": list})
+}
+
+type jadwalOperasiPasienRequest struct {
+	NoPeserta string `json:"nopeserta"`
+}
+
+func (s *Server) handleJadwalOperasiPasien(w http.ResponseWriter, r *http.Request) {
+	var req jadwalOperasiPasienRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if len(req.NoPeserta) != 13 || !isDigits(req.NoPeserta) {
+		writeMeta(w, 201, "Format Nomor Kartu Tidak Sesuai")
+		return
+	}
+
+	schedule, err := s.repo.JadwalOperasiPasien(req.NoPeserta)
+	if err != nil {
+		log.Printf("   └──  Error reading jadwal operasi: %v", err)
+		writeMeta(w, 201, "Gagal membaca jadwal operasi")
+		return
+	}
+	list := toJadwalOperasi(schedule)
+	for i := range list {
+		list[i].NoPeserta = ""
+	}
+	writeResponse(w, map[string]interface{}{"list": list})
+}
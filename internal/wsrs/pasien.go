@@ -0,0 +1,104 @@
+package wsrs
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+type pasienBaruRequest struct {
+	NomorKartu   string `json:"nomorkartu"`
+	NIK          string `json:"nik"`
+	NomorKK      string `json:"nomorkk"`
+	Nama         string `json:"nama"`
+	JenisKelamin string `json:"jeniskelamin"`
+	TanggalLahir string `json:"tanggallahir"`
+	NoHP         string `json:"nohp"`
+	Alamat       string `json:"alamat"`
+	KodeProp     string `json:"kodeprop"`
+	NamaProp     string `json:"namaprop"`
+	KodeDati2    string `json:"kodedati2"`
+	NamaDati2    string `json:"namadati2"`
+	KodeKec      string `json:"kodekec"`
+	NamaKec      string `json:"namakec"`
+	KodeKel      string `json:"kodekel"`
+	NamaKel      string `json:"namakel"`
+	RW           string `json:"rw"`
+	RT           string `json:"rt"`
+}
+
+func (req pasienBaruRequest) validate(now time.Time) string {
+	switch {
+	case len(req.NomorKartu) != 13 || !isDigits(req.NomorKartu):
+		return "Format Nomor Kartu Tidak Sesuai"
+	case len(req.NIK) != 16 || !isDigits(req.NIK):
+		return "Format NIK Tidak Sesuai"
+	case strings.TrimSpace(req.Nama) == "":
+		return "Nama Belum Diisi"
+	case req.JenisKelamin != "L" && req.JenisKelamin != "P":
+		return "Jenis Kelamin Tidak Sesuai"
+	case strings.TrimSpace(req.Alamat) == "":
+		return "Alamat Belum Diisi"
+	case req.NamaProp == "" || req.NamaDati2 == "" || req.NamaKec == "" || req.NamaKel == "":
+		return "Wilayah Belum Diisi"
+	}
+	lahir, err := time.ParseInLocation("2006-01-02", req.TanggalLahir, time.Local)
+	if err != nil || lahir.After(now) {
+		return "Format Tanggal Lahir Tidak Sesuai"
+	}
+	return ""
+}
+
+func (s *Server) handlePasienBaru(w http.ResponseWriter, r *http.Request) {
+	var req pasienBaruRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if msg := req.validate(s.now()); msg != "" {
+		writeMeta(w, 201, msg)
+		return
+	}
+
+	now := s.now()
+	lahir, _ := time.ParseInLocation("2006-01-02", req.TanggalLahir, time.Local)
+	umur, sttsUmur := umurDaftar(lahir, now)
+	norm, err := s.repo.RegisterPasien(models.NewPasien{
+		NomorKartu:   req.NomorKartu,
+		NIK:          req.NIK,
+		Nama:         req.Nama,
+		JenisKelamin: req.JenisKelamin,
+		TanggalLahir: req.TanggalLahir,
+		NoHP:         req.NoHP,
+		Alamat:       req.Alamat,
+		NamaProp:     req.NamaProp,
+		NamaDati2:    req.NamaDati2,
+		NamaKec:      req.NamaKec,
+		NamaKel:      req.NamaKel,
+		RW:           req.RW,
+		RT:           req.RT,
+		Umur:         umur,
+		SttsUmur:     sttsUmur,
+		KdPj:         s.kdPjBPJS,
+		TglDaftar:    now.Format("2006-01-02"),
+	})
+	if errors.Is(err, database.ErrPasienExists) {
+		writeMeta(w, 201, "Data Peserta Sudah Pernah Dientrikan")
+		return
+	}
+	if err != nil {
+		log.Printf("   └──  Error registering pasien: %v", err)
+		writeMeta(w, 201, "Gagal menyimpan data pasien")
+		return
+	}
+
+	log.Printf("   └── Pasien baru %s", norm)
+	writeJSON(w, map[string]interface{}{
+		"response": map[string]string{"norm": norm},
+		"metadata": map[string]interface{}{"code": 200, "message": "Harap datang ke admisi untuk melengkapi data rekam medis"},
+	})
+}
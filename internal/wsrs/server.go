@@ -0,0 +1,140 @@
+// Package wsrs is the hospital-side web service BPJS Mobile JKN calls to
+// book, check and cancel queues. It reads and writes the same SIMRS tables
+// the legacy PHP service did, so bookings land where the watcher finds them.
+package wsrs
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/database"
+)
+
+// checkinStore keeps Mobile JKN checkins. *database.MySQL implements it with
+// the gotrol_checkin table.
+type checkinStore interface {
+	CheckinTime(kodeBooking string) (int64, error)
+	SaveCheckin(kodeBooking, nomorReferensi string, waktu int64) error
+}
+
+type Server struct {
+	db                checkinStore
+	repo              database.Repository
+	cfg               config.WSRSConfig
+	tokens            *tokenIssuer
+	kdPjBPJS          string
+	minutesPerPatient int
+	now               func() time.Time
+	mux               *http.ServeMux
+}
+
+// NewServer builds the WS. kdPjBPJS is the penjab code bookings are
+// registered under; quota counts use every code in db.PayerCodes.
+func NewServer(db *database.MySQL, repo database.Repository, cfg config.WSRSConfig, kdPjBPJS string) *Server {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		log.Println("   ├── wsrs.secret not set, tokens are invalidated on restart")
+	}
+	if kdPjBPJS == "" {
+		kdPjBPJS = "BPJ"
+	}
+	s := &Server{
+		db:                db,
+		repo:              repo,
+		cfg:               cfg,
+		kdPjBPJS:          kdPjBPJS,
+		minutesPerPatient: cfg.GetMinutesPerPatient(),
+		now:               time.Now,
+	}
+	s.tokens = &tokenIssuer{secret: secret, ttl: cfg.GetTokenTTL(), now: func() time.Time { return s.now() }}
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/token", s.handleToken)
+	s.mux.HandleFunc("POST /statusantrean", s.authorized(s.handleStatusAntrean))
+	s.mux.HandleFunc("POST /ambilantrean", s.authorized(s.handleAmbilAntrean))
+	s.mux.HandleFunc("POST /sisaantrean", s.authorized(s.handleSisaAntrean))
+	s.mux.HandleFunc("POST /batalantrean", s.authorized(s.handleBatalAntrean))
+	s.mux.HandleFunc("POST /checkin", s.authorized(s.handleCheckin))
+	s.mux.HandleFunc("POST /pasienbaru", s.authorized(s.handlePasienBaru))
+	s.mux.HandleFunc("POST /jadwaloperasirs", s.authorized(s.handleJadwalOperasiRS))
+	s.mux.HandleFunc("POST /jadwaloperasipasien", s.authorized(s.handleJadwalOperasiPasien))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("📲 WS RS %s %s", r.Method, r.URL.Path)
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	username := r.Header.Get("x-username")
+	password := r.Header.Get("x-password")
+	if s.cfg.Username == "" ||
+		subtle.ConstantTimeCompare([]byte(username), []byte(s.cfg.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.cfg.Password)) != 1 {
+		writeMeta(w, 201, "Username atau Password Tidak Sesuai")
+		return
+	}
+	writeResponse(w, map[string]string{"token": s.tokens.issue(username)})
+}
+
+// authorized checks x-token and x-username before the handler runs.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := r.Header.Get("x-username")
+		token := r.Header.Get("x-token")
+		if username == "" || token == "" {
+			writeMeta(w, 201, "x-token dan x-username wajib diisi")
+			return
+		}
+		if username != s.cfg.Username {
+			writeMeta(w, 201, "Username Tidak Sesuai")
+			return
+		}
+		if err := s.tokens.verify(token, username); err != nil {
+			writeMeta(w, 201, err.Error())
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decode reads the JSON body into v and answers 201 when it is malformed.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeMeta(w, 201, "Format Request Tidak Valid")
+		return false
+	}
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, response interface{}) {
+	writeJSON(w, map[string]interface{}{
+		"response": response,
+		"metadata": map[string]interface{}{"code": 200, "message": "Ok"},
+	})
+}
+
+func writeMeta(w http.ResponseWriter, code int, message string) {
+	if code != 200 {
+		log.Printf("   └── %d %s", code, message)
+	}
+	writeJSON(w, map[string]interface{}{
+		"metadata": map[string]interface{}{"code": code, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,409 @@
+package wsrs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gotrol/internal/config"
+	"gotrol/internal/database"
+	"gotrol/internal/models"
+)
+
+type fakeWSRSRepo struct {
+	database.Repository
+	registerErr  error
+	bookings     map[string]*models.Booking
+	cancelErr    error
+	cancelled    []string
+	pasienExists bool
+	registered   []models.NewBooking
+	jadwal       []models.JadwalOperasi
+}
+
+func (f *fakeWSRSRepo) FindPraktek(kodePoli string, kodeDokter int, hariKerja, jamMulai string) (*models.Praktek, error) {
+	if kodePoli != "INT" || kodeDokter != 101 || jamMulai != "08:00" {
+		return nil, nil
+	}
+	return &models.Praktek{KdPoli: "U0001", NmPoli: "PENYAKIT DALAM", KdDokter: "D001", NmDokter: "dr. Sari", JamMulai: "08:00", Kuota: 10}, nil
+}
+
+func (f *fakeWSRSRepo) FindPasien(norm, nomorKartu string) (*models.Pasien, error) {
+	if norm == "000123" || (norm == "" && nomorKartu == "0001234567890") {
+		return &models.Pasien{NoRkmMedis: "000123", TglLahir: time.Date(1980, 5, 1, 0, 0, 0, 0, time.Local)}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeWSRSRepo) RegisterBooking(b models.NewBooking) (*models.BookedVisit, error) {
+	if f.registerErr != nil {
+		return nil, f.registerErr
+	}
+	f.registered = append(f.registered, b)
+	return &models.BookedVisit{
+		NoRawat:     "2025/12/29/000001",
+		KodeBooking: "20251229000001",
+		NoReg:       3,
+		Estimasi:    time.Date(2025, 12, 29, 8, 20, 0, 0, time.Local).UnixMilli(),
+		Count:       models.QueueCount{Total: 2, JKN: 1},
+	}, nil
+}
+
+func (f *fakeWSRSRepo) QueueCount(kdPoli, kdDokter, date string) (models.QueueCount, error) {
+	return models.QueueCount{Total: 5, Sisa: 3, JKN: 2, Dipanggil: 2}, nil
+}
+
+func (f *fakeWSRSRepo) FindBooking(kodeBooking string) (*models.Booking, error) {
+	return f.bookings[kodeBooking], nil
+}
+
+func (f *fakeWSRSRepo) QueueAhead(kdPoli, kdDokter, date string, noReg int) (int, error) {
+	return noReg - 3, nil
+}
+
+func (f *fakeWSRSRepo) CancelBooking(b models.Booking, kodeBooking, keterangan string) error {
+	if f.cancelErr != nil {
+		return f.cancelErr
+	}
+	f.cancelled = append(f.cancelled, kodeBooking+" "+keterangan)
+	return nil
+}
+
+func (f *fakeWSRSRepo) RegisterPasien(p models.NewPasien) (string, error) {
+	if f.pasienExists {
+		return "", database.ErrPasienExists
+	}
+	return "000124", nil
+}
+
+func (f *fakeWSRSRepo) JadwalOperasi(tanggalAwal, tanggalAkhir string) ([]models.JadwalOperasi, error) {
+	return f.jadwal, nil
+}
+
+func (f *fakeWSRSRepo) JadwalOperasiPasien(noPeserta string) ([]models.JadwalOperasi, error) {
+	return f.jadwal, nil
+}
+
+type fakeCheckins map[string]int64
+
+func (f fakeCheckins) CheckinTime(kodeBooking string) (int64, error) { return f[kodeBooking], nil }
+
+func (f fakeCheckins) SaveCheckin(kodeBooking, nomorReferensi string, waktu int64) error {
+	if _, ok := f[kodeBooking]; !ok {
+		f[kodeBooking] = waktu
+	}
+	return nil
+}
+
+type wsrsAnswer struct {
+	Response json.RawMessage `json:"response"`
+	Metadata struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"metadata"`
+}
+
+func TestHandlers(t *testing.T) {
+	now := time.Date(2025, 12, 28, 7, 0, 0, 0, time.Local)
+	checkinAt := time.Date(2025, 12, 28, 7, 30, 0, 0, time.Local).UnixMilli()
+	booking := func(stts string) *models.Booking {
+		return &models.Booking{NomorReferensi: "REF1", NoRawat: "2025/12/28/000005", NoRkmMedis: "000123", Tanggal: "2025-12-28",
+			KdPoli: "U0001", KdDokter: "D001", NoReg: 5, Stts: stts, KodePoli: "INT", NmPoli: "PENYAKIT DALAM", NmDokter: "dr. Sari"}
+	}
+	ambil := func(norm, tanggal string) string {
+		return `{"nomorkartu":"0001234567890","nik":"3201010101010001","nohp":"08123","kodepoli":"INT","norm":"` + norm +
+			`","tanggalperiksa":"` + tanggal + `","kodedokter":101,"jampraktek":"08:00-12:00","jeniskunjungan":1,"nomorreferensi":"RUJ1"}`
+	}
+	pasienBaru := `{"nomorkartu":"0001234567891","nik":"3201010101010002","nomorkk":"3201010101010000","nama":"Budi","jeniskelamin":"L",
+		"tanggallahir":"1990-01-01","nohp":"08123","alamat":"Jl. Mawar","namaprop":"JAWA BARAT","namadati2":"BOGOR",
+		"namakec":"CIBINONG","namakel":"PAKANSARI","rw":"01","rt":"02"}`
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		repo     *fakeWSRSRepo
+		checkins fakeCheckins
+		wantCode int
+		wantMsg  string
+		check    func(t *testing.T, answer wsrsAnswer, repo *fakeWSRSRepo, checkins fakeCheckins)
+	}{
+		{
+			name:     "ambilantrean books the visit",
+			path:     "/ambilantrean",
+			body:     ambil("000123", "2025-12-29"),
+			wantCode: 200,
+			check: func(t *testing.T, answer wsrsAnswer, repo *fakeWSRSRepo, _ fakeCheckins) {
+				var resp map[string]interface{}
+				json.Unmarshal(answer.Response, &resp)
+				if resp["nomorantrean"] != "INT-003" || resp["kodebooking"] != "20251229000001" || resp["sisakuotajkn"] != float64(8) {
+					t.Errorf("response = %v", resp)
+				}
+				if len(repo.registered) != 1 || repo.registered[0].JamReg != "08:00:00" || repo.registered[0].NIK != "3201010101010001" {
+					t.Errorf("registered %+v", repo.registered)
+				}
+			},
+		},
+		{
+			name:     "ambilantrean refuses a duplicate booking",
+			path:     "/ambilantrean",
+			body:     ambil("000123", "2025-12-29"),
+			repo:     &fakeWSRSRepo{registerErr: database.ErrAlreadyBooked},
+			wantCode: 201,
+			wantMsg:  "Nomor Antrean Hanya Dapat Diambil 1 Kali Pada Tanggal Dan Poli Yang Sama",
+		},
+		{
+			name:     "ambilantrean refuses when the quota is full",
+			path:     "/ambilantrean",
+			body:     ambil("000123", "2025-12-29"),
+			repo:     &fakeWSRSRepo{registerErr: database.ErrQuotaFull},
+			wantCode: 201,
+			wantMsg:  "Kuota Habis",
+		},
+		{
+			name:     "ambilantrean asks an unknown patient to register",
+			path:     "/ambilantrean",
+			body:     ambil("999999", "2025-12-29"),
+			wantCode: 202,
+		},
+		{
+			name:     "ambilantrean refuses a past date",
+			path:     "/ambilantrean",
+			body:     ambil("000123", "2025-12-27"),
+			wantCode: 201,
+			wantMsg:  "Tanggal Periksa Tidak Berlaku",
+		},
+		{
+			name:     "sisaantrean counts the visits ahead",
+			path:     "/sisaantrean",
+			body:     `{"kodebooking":"KB1"}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Belum")}},
+			wantCode: 200,
+			check: func(t *testing.T, answer wsrsAnswer, _ *fakeWSRSRepo, _ fakeCheckins) {
+				var resp map[string]interface{}
+				json.Unmarshal(answer.Response, &resp)
+				if resp["nomorantrean"] != "INT-005" || resp["sisaantrean"] != float64(2) || resp["antreanpanggil"] != "INT-002" {
+					t.Errorf("response = %v", resp)
+				}
+			},
+		},
+		{
+			name:     "sisaantrean of an unknown kodebooking",
+			path:     "/sisaantrean",
+			body:     `{"kodebooking":"KB9"}`,
+			wantCode: 201,
+			wantMsg:  "Antrean Tidak Ditemukan atau Sudah Dibatalkan",
+		},
+		{
+			name:     "batalantrean cancels the booking",
+			path:     "/batalantrean",
+			body:     `{"kodebooking":"KB1","keterangan":"berhalangan"}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Belum")}},
+			wantCode: 200,
+			check: func(t *testing.T, _ wsrsAnswer, repo *fakeWSRSRepo, _ fakeCheckins) {
+				if len(repo.cancelled) != 1 || repo.cancelled[0] != "KB1 Batal Mobile JKN: berhalangan" {
+					t.Errorf("cancelled %v", repo.cancelled)
+				}
+			},
+		},
+		{
+			name:     "batalantrean refuses after checkin",
+			path:     "/batalantrean",
+			body:     `{"kodebooking":"KB1","keterangan":"berhalangan"}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Belum")}},
+			checkins: fakeCheckins{"KB1": checkinAt},
+			wantCode: 201,
+			wantMsg:  "Pasien Sudah Checkin, Antrean Tidak Dapat Dibatalkan",
+			check: func(t *testing.T, _ wsrsAnswer, repo *fakeWSRSRepo, _ fakeCheckins) {
+				if len(repo.cancelled) != 0 {
+					t.Errorf("cancelled %v", repo.cancelled)
+				}
+			},
+		},
+		{
+			name:     "batalantrean refuses a served patient",
+			path:     "/batalantrean",
+			body:     `{"kodebooking":"KB1"}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Sudah")}},
+			wantCode: 201,
+			wantMsg:  "Pasien Sudah Dilayani, Antrean Tidak Dapat Dibatalkan",
+		},
+		{
+			name:     "batalantrean refuses a patient served meanwhile",
+			path:     "/batalantrean",
+			body:     `{"kodebooking":"KB1"}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Belum")}, cancelErr: database.ErrAlreadyServed},
+			wantCode: 201,
+			wantMsg:  "Pasien Sudah Dilayani, Antrean Tidak Dapat Dibatalkan",
+		},
+		{
+			name:     "batalantrean of an unknown kodebooking",
+			path:     "/batalantrean",
+			body:     `{"kodebooking":"KB9"}`,
+			wantCode: 201,
+			wantMsg:  "Antrean Tidak Ditemukan atau Sudah Dibatalkan",
+		},
+		{
+			name:     "batalantrean of a cancelled booking",
+			path:     "/batalantrean",
+			body:     `{"kodebooking":"KB1"}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Batal")}},
+			wantCode: 201,
+			wantMsg:  "Antrean Tidak Ditemukan atau Sudah Dibatalkan",
+		},
+		{
+			name:     "checkin keeps the first time",
+			path:     "/checkin",
+			body:     `{"kodebooking":"KB1","waktu":` + strconv.FormatInt(checkinAt+60000, 10) + `}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Belum")}},
+			checkins: fakeCheckins{"KB1": checkinAt},
+			wantCode: 200,
+			check: func(t *testing.T, _ wsrsAnswer, _ *fakeWSRSRepo, checkins fakeCheckins) {
+				if checkins["KB1"] != checkinAt {
+					t.Errorf("checkin = %d, want %d", checkins["KB1"], checkinAt)
+				}
+			},
+		},
+		{
+			name:     "checkin is saved",
+			path:     "/checkin",
+			body:     `{"kodebooking":"KB1","waktu":` + strconv.FormatInt(checkinAt, 10) + `}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Belum")}},
+			wantCode: 200,
+			check: func(t *testing.T, _ wsrsAnswer, _ *fakeWSRSRepo, checkins fakeCheckins) {
+				if checkins["KB1"] != checkinAt {
+					t.Errorf("checkin = %d, want %d", checkins["KB1"], checkinAt)
+				}
+			},
+		},
+		{
+			name:     "checkin on another day",
+			path:     "/checkin",
+			body:     `{"kodebooking":"KB1","waktu":` + strconv.FormatInt(checkinAt+24*3600*1000, 10) + `}`,
+			repo:     &fakeWSRSRepo{bookings: map[string]*models.Booking{"KB1": booking("Belum")}},
+			wantCode: 201,
+			wantMsg:  "Waktu Checkin Tidak Sesuai Tanggal Periksa",
+		},
+		{
+			name:     "checkin of an unknown kodebooking",
+			path:     "/checkin",
+			body:     `{"kodebooking":"KB9","waktu":` + strconv.FormatInt(checkinAt, 10) + `}`,
+			wantCode: 201,
+			wantMsg:  "Antrean Tidak Ditemukan atau Sudah Dibatalkan",
+		},
+		{
+			name:     "pasienbaru registers the patient",
+			path:     "/pasienbaru",
+			body:     pasienBaru,
+			wantCode: 200,
+			check: func(t *testing.T, answer wsrsAnswer, _ *fakeWSRSRepo, _ fakeCheckins) {
+				var resp map[string]string
+				json.Unmarshal(answer.Response, &resp)
+				if resp["norm"] != "000124" {
+					t.Errorf("response = %v", resp)
+				}
+			},
+		},
+		{
+			name:     "pasienbaru refuses a known patient",
+			path:     "/pasienbaru",
+			body:     pasienBaru,
+			repo:     &fakeWSRSRepo{pasienExists: true},
+			wantCode: 201,
+			wantMsg:  "Data Peserta Sudah Pernah Dientrikan",
+		},
+		{
+			name:     "pasienbaru refuses a bad NIK",
+			path:     "/pasienbaru",
+			body:     strings.Replace(pasienBaru, "3201010101010002", "320101", 1),
+			wantCode: 201,
+			wantMsg:  "Format NIK Tidak Sesuai",
+		},
+		{
+			name:     "jadwaloperasirs lists the schedule",
+			path:     "/jadwaloperasirs",
+			body:     `{"tanggalawal":"2025-12-28","tanggalakhir":"2025-12-31"}`,
+			repo:     &fakeWSRSRepo{jadwal: []models.JadwalOperasi{{KodeBooking: "2025/12/28/000005", TanggalOperasi: "2025-12-30", KodePoli: "BED", Terlaksana: true, NoPeserta: "0001234567890"}}},
+			wantCode: 200,
+			check: func(t *testing.T, answer wsrsAnswer, _ *fakeWSRSRepo, _ fakeCheckins) {
+				var resp struct{ List []jadwalOperasi }
+				json.Unmarshal(answer.Response, &resp)
+				if len(resp.List) != 1 || resp.List[0].Terlaksana != 1 || resp.List[0].LastUpdate != now.UnixMilli() {
+					t.Errorf("response = %+v", resp)
+				}
+			},
+		},
+		{
+			name:     "jadwaloperasirs refuses a reversed range",
+			path:     "/jadwaloperasirs",
+			body:     `{"tanggalawal":"2025-12-31","tanggalakhir":"2025-12-28"}`,
+			wantCode: 201,
+			wantMsg:  "Tanggal Akhir Tidak Boleh Lebih Kecil dari Tanggal Awal",
+		},
+		{
+			name:     "jadwaloperasipasien hides the card number",
+			path:     "/jadwaloperasipasien",
+			body:     `{"nopeserta":"0001234567890"}`,
+			repo:     &fakeWSRSRepo{jadwal: []models.JadwalOperasi{{KodeBooking: "2025/12/28/000005", NoPeserta: "0001234567890"}}},
+			wantCode: 200,
+			check: func(t *testing.T, answer wsrsAnswer, _ *fakeWSRSRepo, _ fakeCheckins) {
+				var resp struct{ List []jadwalOperasi }
+				json.Unmarshal(answer.Response, &resp)
+				if len(resp.List) != 1 || resp.List[0].NoPeserta != "" {
+					t.Errorf("response = %+v", resp)
+				}
+			},
+		},
+		{
+			name:     "jadwaloperasipasien refuses a bad card",
+			path:     "/jadwaloperasipasien",
+			body:     `{"nopeserta":"123"}`,
+			wantCode: 201,
+			wantMsg:  "Format Nomor Kartu Tidak Sesuai",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := tt.repo
+			if repo == nil {
+				repo = &fakeWSRSRepo{}
+			}
+			checkins := tt.checkins
+			if checkins == nil {
+				checkins = fakeCheckins{}
+			}
+			s := &Server{
+				db:                checkins,
+				repo:              repo,
+				cfg:               config.WSRSConfig{Username: "jkn"},
+				kdPjBPJS:          "BPJ",
+				minutesPerPatient: 10,
+				now:               func() time.Time { return now },
+			}
+			s.tokens = &tokenIssuer{secret: []byte("secret"), ttl: time.Hour, now: s.now}
+			s.routes()
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("x-username", "jkn")
+			r.Header.Set("x-token", s.tokens.issue("jkn"))
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			var answer wsrsAnswer
+			if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+				t.Fatal(err)
+			}
+			if answer.Metadata.Code != tt.wantCode || (tt.wantMsg != "" && answer.Metadata.Message != tt.wantMsg) {
+				t.Fatalf("metadata = %d %q, want %d %q", answer.Metadata.Code, answer.Metadata.Message, tt.wantCode, tt.wantMsg)
+			}
+			if tt.check != nil {
+				tt.check(t, answer, repo, checkins)
+			}
+		})
+	}
+}
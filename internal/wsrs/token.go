@@ -0,0 +1,64 @@
+package wsrs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errTokenInvalid = errors.New("Token Tidak Valid")
+	errTokenExpired = errors.New("Token Expired")
+)
+
+// tokenIssuer signs stateless tokens of the form base64(username|expiry).mac,
+// so tokens survive nothing but a change of secret.
+type tokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func (t *tokenIssuer) issue(username string) string {
+	payload := username + "|" + strconv.FormatInt(t.now().Add(t.ttl).Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + t.mac(payload)
+}
+
+// verify checks the token was issued by us for username and is not expired.
+func (t *tokenIssuer) verify(token, username string) error {
+	encoded, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return errTokenInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return errTokenInvalid
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(mac), []byte(t.mac(payload))) {
+		return errTokenInvalid
+	}
+	user, exp, ok := strings.Cut(payload, "|")
+	if !ok || user != username {
+		return errTokenInvalid
+	}
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errTokenInvalid
+	}
+	if t.now().Unix() > expiry {
+		return errTokenExpired
+	}
+	return nil
+}
+
+func (t *tokenIssuer) mac(payload string) string {
+	h := hmac.New(sha256.New, t.secret)
+	h.Write([]byte(payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
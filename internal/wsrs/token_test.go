@@ -0,0 +1,35 @@
+package wsrs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	now := time.Date(2025, 12, 28, 8, 0, 0, 0, time.Local)
+	issuer := &tokenIssuer{secret: []byte("secret"), ttl: time.Hour, now: func() time.Time { return now }}
+	token := issuer.issue("jkn")
+
+	if err := issuer.verify(token, "jkn"); err != nil {
+		t.Fatalf("fresh token rejected: %v", err)
+	}
+	if err := issuer.verify(token, "other"); err != errTokenInvalid {
+		t.Errorf("token for another username: got %v, want %v", err, errTokenInvalid)
+	}
+
+	encoded, mac, _ := strings.Cut(token, ".")
+	if err := issuer.verify(encoded+"."+strings.Repeat("0", len(mac)), "jkn"); err != errTokenInvalid {
+		t.Errorf("forged mac: got %v, want %v", err, errTokenInvalid)
+	}
+
+	other := &tokenIssuer{secret: []byte("different"), ttl: time.Hour, now: issuer.now}
+	if err := other.verify(token, "jkn"); err != errTokenInvalid {
+		t.Errorf("token from another secret: got %v, want %v", err, errTokenInvalid)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if err := issuer.verify(token, "jkn"); err != errTokenExpired {
+		t.Errorf("expired token: got %v, want %v", err, errTokenExpired)
+	}
+}
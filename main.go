@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"gotrol/internal/bpjs"
 	"gotrol/internal/config"
 	"gotrol/internal/database"
+	"gotrol/internal/events"
+	"gotrol/internal/models"
 	"gotrol/internal/report"
 	"gotrol/internal/service"
 )
@@ -29,6 +36,8 @@ func main() {
 		runService()
 	case "batch":
 		runBatch()
+	case "reconcile":
+		runReconcile()
 	case "status":
 		checkStatus()
 	case "help", "-h", "--help":
@@ -42,7 +51,7 @@ func main() {
 }
 
 func printUsage() {
-	fmt.Println(`
+	fmt.Print(`
 ╔══════════════════════════════════════════════════════════════╗
 ║               goTrol - JKN Task ID Auto Service              ║
 ╚══════════════════════════════════════════════════════════════╝
@@ -52,6 +61,7 @@ Usage: gotrol <command> [options]
 Commands:
   run                          Start the background service (auto monitoring)
   batch <type> <options>       Run manual batch operations
+  reconcile <date> [--fix]     Compare local task status with BPJS getlisttask
   status                       Check service status
   version                      Show version
   help                         Show this help
@@ -65,12 +75,23 @@ Batch Types:
   batch all --date YYYY-MM-DD
   batch retrytask3 --today     Retry kirim Task 3 yang gagal
   batch retrytask3 --date YYYY-MM-DD
+  batch walkin --today         Daftarkan pasien JKN walk-in ke antrean/add
+  batch walkin --date YYYY-MM-DD
+  batch <type> ... --dry-run   Preview payloads and writes, touch nothing
+  batch <type> ... --dry-run --format json
+
+Reconcile:
+  reconcile --today            Report differences only
+  reconcile --date YYYY-MM-DD --fix
+                               Also mark tasks accepted by BPJS as Sudah
 
 Examples:
   gotrol run
   gotrol batch autoorder --today
   gotrol batch updatewaktu --date 2025-12-28
   gotrol batch all --today
+  gotrol batch all --today --dry-run --format json
+  gotrol reconcile --date 2025-12-28 --fix
 `)
 }
 
@@ -89,11 +110,26 @@ func runService() {
 	defer db.Close()
 	log.Println(" Connected to MySQL database")
 
-	creds, err := db.GetBPJSCredentials()
+	if err := db.EnsureSchema(); err != nil {
+		log.Fatalf(" Failed to prepare gotrol tables: %v", err)
+	}
+
+	repo, err := database.NewRepository(db, cfg.Database.Schema, cfg.Tasks)
+	if err != nil {
+		log.Fatalf(" %v", err)
+	}
+
+	creds, err := repo.Credentials()
 	if err != nil {
 		log.Fatalf(" Failed to load BPJS credentials: %v", err)
 	}
-	log.Println(" BPJS credentials loaded from settings")
+	cfg.BPJS.ApplyCredentials(creds)
+	log.Println(" BPJS credentials loaded")
+
+	if err := db.LoadPayerCodes(cfg.BPJS.PayerCodes, creds.KdPjBPJS); err != nil {
+		log.Fatalf(" Failed to load payer codes: %v", err)
+	}
+	log.Printf(" JKN payer codes: %s", strings.Join(db.PayerCodes(), ", "))
 
 	reportStore, err := report.NewStore(cfg.Report.DBPath)
 	if err != nil {
@@ -103,7 +139,35 @@ func runService() {
 
 	log.Println(" Run Dashboard @ GoTrolDashboard.exe")
 
-	watcher := service.NewWatcher(db, creds, reportStore, cfg.Watcher.GetPollDuration())
+	limiter := bpjs.NewRateLimiter(cfg.BPJS.RateLimit, cfg.BPJS.RateBurst)
+	bpjsClient := bpjs.NewClient(creds, cfg.BPJS, limiter)
+	bpjsClient.SetRecorder(reportStore)
+
+	if cfg.Tasks.Faithful {
+		log.Println(" Faithful mode: entries without SIMRS records are held, see /api/needs-data")
+	}
+	if cfg.Watcher.Incremental {
+		log.Println(" Incremental mode: each task is sent as soon as its record appears")
+	}
+
+	watcher := service.NewWatcher(db, repo, creds, bpjsClient, reportStore, cfg.Watcher, cfg.Tasks)
+	if cfg.Watcher.WalkIn {
+		if cfg.Database.Schema == database.SchemaKhanza {
+			log.Fatalf(" watcher.walk_in registers visits in mLITE tables and needs database.schema mlite")
+		}
+		watcher.SetWalkIn(service.NewWalkInRegistrar(repo, bpjsClient, cfg.WSRS.GetMinutesPerPatient()))
+		log.Println(" Walk-in JKN visits are registered with antrean/add")
+	}
+
+	var eventServer *events.Server
+	if cfg.Events.Enabled {
+		eventServer = events.NewServer(db, repo, cfg.Events, watcher)
+		go func() {
+			if err := eventServer.Start(); err != nil && err != http.ErrServerClosed {
+				log.Printf(" Event API stopped: %v", err)
+			}
+		}()
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -112,6 +176,9 @@ func runService() {
 		<-sigChan
 		log.Println("\n Shutting down...")
 		watcher.Stop()
+		if eventServer != nil {
+			eventServer.Stop()
+		}
 		os.Exit(0)
 	}()
 
@@ -120,23 +187,47 @@ func runService() {
 
 func runBatch() {
 	if len(os.Args) < 4 {
-		fmt.Println("Usage: gotrol batch <type> --today|--date YYYY-MM-DD")
+		fmt.Println("Usage: gotrol batch <type> --today|--date YYYY-MM-DD [--dry-run [--format table|json]]")
 		fmt.Println("Types: autoorder, updatewaktu, all")
 		return
 	}
 
 	batchType := os.Args[2]
-	dateFlag := os.Args[3]
 
 	var date string
-	if dateFlag == "--today" {
-		date = time.Now().Format("2006-01-02")
-	} else if dateFlag == "--date" && len(os.Args) > 4 {
-		date = os.Args[4]
-	} else {
+	dryRun := false
+	format := "table"
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--today":
+			date = time.Now().Format("2006-01-02")
+		case "--date":
+			if i+1 < len(os.Args) {
+				date = os.Args[i+1]
+				i++
+			}
+		case "--dry-run":
+			dryRun = true
+		case "--format":
+			if i+1 < len(os.Args) {
+				format = os.Args[i+1]
+				i++
+			}
+		}
+	}
+	if date == "" {
 		fmt.Println("Invalid date flag. Use --today or --date YYYY-MM-DD")
 		return
 	}
+	if format != "table" && format != "json" {
+		fmt.Println("Invalid format. Use --format table or --format json")
+		return
+	}
+
+	if dryRun {
+		runBatchDryRun(batchType, date, format)
+		return
+	}
 
 	printBanner()
 
@@ -152,11 +243,26 @@ func runBatch() {
 	defer db.Close()
 	log.Println("Connected to MySQL database")
 
-	creds, err := db.GetBPJSCredentials()
+	if err := db.EnsureSchema(); err != nil {
+		log.Fatalf("Failed to prepare gotrol tables: %v", err)
+	}
+
+	repo, err := database.NewRepository(db, cfg.Database.Schema, cfg.Tasks)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	creds, err := repo.Credentials()
 	if err != nil {
 		log.Fatalf("Failed to load BPJS credentials: %v", err)
 	}
-	log.Println("BPJS credentials loaded from settings")
+	cfg.BPJS.ApplyCredentials(creds)
+	log.Println("BPJS credentials loaded")
+
+	if err := db.LoadPayerCodes(cfg.BPJS.PayerCodes, creds.KdPjBPJS); err != nil {
+		log.Fatalf("Failed to load payer codes: %v", err)
+	}
+	log.Printf("JKN payer codes: %s", strings.Join(db.PayerCodes(), ", "))
 
 	reportStore, err := report.NewStore(cfg.Report.DBPath)
 	if err != nil {
@@ -164,7 +270,11 @@ func runBatch() {
 	}
 	defer reportStore.Close()
 
-	batch := service.NewBatchHandler(db, creds, reportStore)
+	limiter := bpjs.NewRateLimiter(cfg.BPJS.RateLimit, cfg.BPJS.RateBurst)
+	bpjsClient := bpjs.NewClient(creds, cfg.BPJS, limiter)
+	bpjsClient.SetRecorder(reportStore)
+
+	batch := service.NewBatchHandler(db, repo, bpjsClient, reportStore, cfg.Tasks)
 
 	switch batchType {
 	case "autoorder":
@@ -194,9 +304,236 @@ func runBatch() {
 			log.Fatalf("Batch error: %v", err)
 		}
 		fmt.Printf("\nResult: %d/%d Task 3 resent successfully\n", success, total)
+
+	case "walkin":
+		if cfg.Database.Schema == database.SchemaKhanza {
+			log.Fatalf("Walk-in registration needs database.schema mlite")
+		}
+		registrar := service.NewWalkInRegistrar(repo, bpjsClient, cfg.WSRS.GetMinutesPerPatient())
+		added, err := registrar.Register(context.Background(), date)
+		if err != nil {
+			log.Fatalf("Batch error: %v", err)
+		}
+		fmt.Printf("\nResult: %d walk-in visit(s) registered\n", added)
 	default:
 		fmt.Printf("Unknown batch type: %s\n", batchType)
-		fmt.Println("Types: autoorder, updatewaktu, all, retrytask3")
+		fmt.Println("Types: autoorder, updatewaktu, all, retrytask3, walkin")
+	}
+}
+
+// runBatchDryRun only reads MySQL and never builds a BPJS client, so nothing
+// can be written or sent whatever the batch type does.
+func runBatchDryRun(batchType, date, format string) {
+	if format == "table" {
+		printBanner()
+	}
+
+	cfg, err := config.Load("config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := database.NewMySQL(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to MySQL: %v", err)
+	}
+	defer db.Close()
+	log.Println("Connected to MySQL database")
+
+	repo, err := database.NewRepository(db, cfg.Database.Schema, cfg.Tasks)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	creds, err := repo.Credentials()
+	if err != nil {
+		log.Fatalf("Failed to load settings: %v", err)
+	}
+	if err := db.LoadPayerCodes(cfg.BPJS.PayerCodes, creds.KdPjBPJS); err != nil {
+		log.Fatalf("Failed to load payer codes: %v", err)
+	}
+
+	reportStore, err := report.NewStore(cfg.Report.DBPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize report store: %v", err)
+	}
+	defer reportStore.Close()
+
+	var rep *models.DryRunReport
+	if batchType == "walkin" {
+		if cfg.Database.Schema == database.SchemaKhanza {
+			log.Fatalf("Walk-in registration needs database.schema mlite")
+		}
+		rep, err = service.NewWalkInRegistrar(repo, nil, cfg.WSRS.GetMinutesPerPatient()).DryRun(date)
+	} else {
+		batch := service.NewBatchHandler(db, repo, nil, reportStore, cfg.Tasks)
+		rep, err = batch.DryRun(batchType, date)
+	}
+	if err != nil {
+		log.Fatalf("Dry run error: %v", err)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			log.Fatalf("Failed to write JSON: %v", err)
+		}
+		return
+	}
+	printDryRun(rep)
+}
+
+func printDryRun(rep *models.DryRunReport) {
+	writes, sends := 0, 0
+	for _, e := range rep.Entries {
+		fmt.Printf("\n%s  %s  %s - %s\n", e.KodeBooking, e.NomorReferensi, e.NoRkmMedis, e.NamaPasien)
+		if e.Skipped != "" {
+			fmt.Printf("  skip: %s\n", e.Skipped)
+			for _, n := range e.NeedsData {
+				fmt.Printf("  T%d  no %s record (%s)\n", n.TaskID, n.Unit, n.Source)
+			}
+			continue
+		}
+		if e.Payload != nil {
+			fmt.Printf("  antrean/add %s\n", e.Payload)
+			sends++
+			continue
+		}
+		for _, r := range e.AutoOrderRules {
+			fmt.Printf("  rule %-22s T%d  %-19s -> %s\n", r.Rule, r.TaskID, r.Before, r.After)
+		}
+		for _, t := range e.Tasks {
+			action := "send"
+			if !t.Send {
+				action = "skip: " + t.Skip
+			}
+			generated := ""
+			if t.Generated {
+				generated = " [generated]"
+			}
+			if t.Replaces != "" {
+				action += " (replaces " + t.Replaces + ")"
+			}
+			fmt.Printf("  T%d  %-19s -> %-19s%-12s  %s\n", t.TaskID, t.Original, t.Waktu, generated, action)
+			if t.Send {
+				fmt.Printf("      %s\n", t.Payload)
+				sends++
+			}
+			if t.Write {
+				writes++
+			}
+		}
+	}
+	for _, e := range rep.Errors {
+		fmt.Printf("  ! %s\n", e)
+	}
+
+	if rep.Mode == "walkin" {
+		fmt.Printf("\nDry run walkin %s: %d visits, %d would be registered\n", rep.Date, len(rep.Entries), sends)
+		return
+	}
+	fmt.Printf("\nDry run %s %s: %d entries, %d rows would be written, %d tasks would be sent\n",
+		rep.Mode, rep.Date, len(rep.Entries), writes, sends)
+}
+
+func runReconcile() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: gotrol reconcile --today|--date YYYY-MM-DD [--fix]")
+		return
+	}
+
+	var date string
+	fix := false
+	for i := 2; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--today":
+			date = time.Now().Format("2006-01-02")
+		case "--date":
+			if i+1 < len(os.Args) {
+				date = os.Args[i+1]
+				i++
+			}
+		case "--fix":
+			fix = true
+		}
+	}
+	if date == "" {
+		fmt.Println("Invalid date flag. Use --today or --date YYYY-MM-DD")
+		return
+	}
+
+	printBanner()
+
+	cfg, err := config.Load("config.yaml")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := database.NewMySQL(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to MySQL: %v", err)
+	}
+	defer db.Close()
+	log.Println("Connected to MySQL database")
+
+	if err := db.EnsureSchema(); err != nil {
+		log.Fatalf("Failed to prepare gotrol tables: %v", err)
+	}
+
+	repo, err := database.NewRepository(db, cfg.Database.Schema, cfg.Tasks)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	creds, err := repo.Credentials()
+	if err != nil {
+		log.Fatalf("Failed to load BPJS credentials: %v", err)
+	}
+	cfg.BPJS.ApplyCredentials(creds)
+	log.Println("BPJS credentials loaded")
+
+	if err := db.LoadPayerCodes(cfg.BPJS.PayerCodes, creds.KdPjBPJS); err != nil {
+		log.Fatalf("Failed to load payer codes: %v", err)
+	}
+	log.Printf("JKN payer codes: %s", strings.Join(db.PayerCodes(), ", "))
+
+	reportStore, err := report.NewStore(cfg.Report.DBPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize report store: %v", err)
+	}
+	defer reportStore.Close()
+
+	limiter := bpjs.NewRateLimiter(cfg.BPJS.RateLimit, cfg.BPJS.RateBurst)
+	bpjsClient := bpjs.NewClient(creds, cfg.BPJS, limiter)
+	bpjsClient.SetRecorder(reportStore)
+
+	reconciler := service.NewReconciler(repo, bpjsClient, reportStore)
+	rep, err := reconciler.Reconcile(date, fix)
+	if err != nil {
+		log.Fatalf("Reconcile error: %v", err)
+	}
+
+	printReconcileGroup("Sudah lokal, tidak ada di BPJS", rep.MissingOnBPJS)
+	printReconcileGroup("Belum lokal, sudah ada di BPJS", rep.BelumButOnBPJS)
+	printReconcileGroup("Waktu berbeda", rep.TimeMismatch)
+	for _, e := range rep.Errors {
+		fmt.Printf("  ! %s\n", e)
+	}
+
+	fmt.Printf("\nResult: %d checked, %d missing on BPJS, %d Belum but on BPJS, %d time mismatch\n",
+		rep.TotalChecked, len(rep.MissingOnBPJS), len(rep.BelumButOnBPJS), len(rep.TimeMismatch))
+}
+
+func printReconcileGroup(title string, diffs []models.ReconcileDiff) {
+	fmt.Printf("\n%s (%d)\n", title, len(diffs))
+	for _, d := range diffs {
+		fixed := ""
+		if d.Fixed {
+			fixed = " [fixed]"
+		}
+		fmt.Printf("  %-30s %-10s T%d  local=%-6s %-19s  bpjs=%-19s%s\n",
+			d.KodeBooking, d.NoRkmMedis, d.TaskID, d.LocalStatus, d.LocalWaktu, d.BPJSWaktu, fixed)
 	}
 }
 
@@ -219,7 +556,7 @@ func checkStatus() {
 }
 
 func printBanner() {
-	fmt.Println(`
+	fmt.Print(`
 ╔══════════════════════════════════════════════════════════════╗
 ║               GoTrol - Task ID Auto Service RSHAA            ║
 ║                       Version ` + version + `                ║